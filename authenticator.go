@@ -0,0 +1,162 @@
+package soratun
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// tokenTimeoutSeconds is the lifetime of SORACOM API token issued for soratun.
+const tokenTimeoutSeconds = 5 * 60
+
+// An Authenticator obtains SORACOM API key and token for DefaultSoracomClient.
+type Authenticator interface {
+	Authenticate(c *DefaultSoracomClient) (apiKey, token string, err error)
+}
+
+// AuthKeyAuthenticator authenticates with SORACOM API auth key ID and auth key secret.
+type AuthKeyAuthenticator struct {
+	AuthKeyID string
+	AuthKey   string
+}
+
+// SAMUserAuthenticator authenticates with SAM user name and password.
+type SAMUserAuthenticator struct {
+	OperatorID string
+	UserName   string
+	Password   string
+}
+
+// RootUserAuthenticator authenticates with email address and password of the root user. If MFACode is set, it will be
+// called to get one-time password for the root user with MFA enabled. Empty code means MFA is not enabled.
+type RootUserAuthenticator struct {
+	Email    string
+	Password string
+	MFACode  func() (string, error)
+}
+
+// TokenAuthenticator uses an existing pair of SORACOM API key and token as is, without calling SORACOM API.
+type TokenAuthenticator struct {
+	APIKey string
+	Token  string
+}
+
+// Authenticator returns an Authenticator for the Profile. If more than one method is configured, they are chosen in
+// following order: API key and token, auth key, SAM user, and root user.
+func (p *Profile) Authenticator() (Authenticator, error) {
+	switch {
+	case p.APIKey != "" || p.Token != "":
+		return &TokenAuthenticator{APIKey: p.APIKey, Token: p.Token}, nil
+	case p.AuthKeyID != "" || p.AuthKey != "":
+		return &AuthKeyAuthenticator{AuthKeyID: p.AuthKeyID, AuthKey: p.AuthKey}, nil
+	case p.OperatorID != "" || p.UserName != "":
+		return &SAMUserAuthenticator{OperatorID: p.OperatorID, UserName: p.UserName, Password: p.Password}, nil
+	case p.Email != "":
+		return &RootUserAuthenticator{Email: p.Email, Password: p.Password, MFACode: p.MFACodeProvider}, nil
+	default:
+		return nil, errors.New("no credentials found in the profile. Specify auth key, SAM user, root user, or API key and token")
+	}
+}
+
+// Authenticate calls SORACOM API with auth key.
+func (a *AuthKeyAuthenticator) Authenticate(c *DefaultSoracomClient) (string, string, error) {
+	if a.AuthKeyID == "" || !strings.HasPrefix(a.AuthKeyID, "keyId-") {
+		return "", "", fmt.Errorf("invalid AuthKeyId is provided. It must starts with \"keyId-\"")
+	}
+
+	if a.AuthKey == "" || !strings.HasPrefix(a.AuthKey, "secret-") {
+		return "", "", fmt.Errorf("invalid AuthKey is provided. It must starts with \"secret-\"")
+	}
+
+	return c.Auth(struct {
+		AuthKeyID           string `json:"authKeyId"`
+		AuthKey             string `json:"authKey"`
+		TokenTimeoutSeconds int    `json:"tokenTimeoutSeconds"`
+	}{
+		AuthKeyID:           a.AuthKeyID,
+		AuthKey:             a.AuthKey,
+		TokenTimeoutSeconds: tokenTimeoutSeconds,
+	})
+}
+
+// Authenticate calls SORACOM API with SAM user credentials.
+func (a *SAMUserAuthenticator) Authenticate(c *DefaultSoracomClient) (string, string, error) {
+	if a.OperatorID == "" || a.UserName == "" || a.Password == "" {
+		return "", "", errors.New("operator ID, user name and password are required for SAM user authentication")
+	}
+
+	return c.Auth(struct {
+		OperatorID          string `json:"operatorId"`
+		UserName            string `json:"userName"`
+		Password            string `json:"password"`
+		TokenTimeoutSeconds int    `json:"tokenTimeoutSeconds"`
+	}{
+		OperatorID:          a.OperatorID,
+		UserName:            a.UserName,
+		Password:            a.Password,
+		TokenTimeoutSeconds: tokenTimeoutSeconds,
+	})
+}
+
+// Authenticate calls SORACOM API with root user credentials, and MFA code if required.
+func (a *RootUserAuthenticator) Authenticate(c *DefaultSoracomClient) (string, string, error) {
+	if a.Email == "" || a.Password == "" {
+		return "", "", errors.New("email and password are required for root user authentication")
+	}
+
+	mfaCode := ""
+	if a.MFACode != nil {
+		code, err := a.MFACode()
+		if err != nil {
+			return "", "", fmt.Errorf("failed to get MFA code: %w", err)
+		}
+		mfaCode = strings.TrimSpace(code)
+	}
+
+	return c.Auth(struct {
+		Email               string `json:"email"`
+		Password            string `json:"password"`
+		MFAOTPCode          string `json:"mfaOTPCode,omitempty"`
+		TokenTimeoutSeconds int    `json:"tokenTimeoutSeconds"`
+	}{
+		Email:               a.Email,
+		Password:            a.Password,
+		MFAOTPCode:          mfaCode,
+		TokenTimeoutSeconds: tokenTimeoutSeconds,
+	})
+}
+
+// Authenticate returns API key and token as is.
+func (a *TokenAuthenticator) Authenticate(_ *DefaultSoracomClient) (string, string, error) {
+	if a.APIKey == "" || a.Token == "" {
+		return "", "", errors.New("both API key and API token are required")
+	}
+	return a.APIKey, a.Token, nil
+}
+
+// Auth calls SORACOM API /auth with the request, and returns API key and token.
+func (c *DefaultSoracomClient) Auth(request interface{}) (string, string, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return "", "", err
+	}
+
+	res, err := c.callAPI(&apiParams{
+		method: "POST",
+		path:   "/auth",
+		body:   string(body),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	ar := struct {
+		APIKey string `json:"apiKey"`
+		Token  string `json:"token"`
+	}{}
+	if err := decodeResponse(res, &ar); err != nil {
+		return "", "", fmt.Errorf("failed to decode auth response: %w", err)
+	}
+	return ar.APIKey, ar.Token, nil
+}
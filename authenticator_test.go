@@ -0,0 +1,80 @@
+package soratun
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfile_Authenticator(t *testing.T) {
+	mfaCode := func() (string, error) { return "123456", nil }
+
+	tests := []struct {
+		name     string
+		profile  Profile
+		want     string
+		wantBody string
+	}{
+		{
+			name:     "auth key",
+			profile:  Profile{AuthKeyID: "keyId-test", AuthKey: "secret-test"},
+			wantBody: `{"authKeyId":"keyId-test","authKey":"secret-test","tokenTimeoutSeconds":300}`,
+		},
+		{
+			name:     "SAM user",
+			profile:  Profile{OperatorID: "OP0000000000", UserName: "arc", Password: "p@ssw0rd"},
+			wantBody: `{"operatorId":"OP0000000000","userName":"arc","password":"p@ssw0rd","tokenTimeoutSeconds":300}`,
+		},
+		{
+			name:     "root user",
+			profile:  Profile{Email: "user@example.com", Password: "p@ssw0rd"},
+			wantBody: `{"email":"user@example.com","password":"p@ssw0rd","tokenTimeoutSeconds":300}`,
+		},
+		{
+			name:     "root user with MFA",
+			profile:  Profile{Email: "user@example.com", Password: "p@ssw0rd", MFACodeProvider: mfaCode},
+			wantBody: `{"email":"user@example.com","password":"p@ssw0rd","mfaOTPCode":"123456","tokenTimeoutSeconds":300}`,
+		},
+		{
+			name:    "API key and token take precedence",
+			profile: Profile{APIKey: "api-existing", Token: "existing-token", AuthKeyID: "keyId-test", AuthKey: "secret-test"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				assert.Equal(t, "/v1/auth", r.URL.Path)
+				body, err := io.ReadAll(r.Body)
+				assert.NoError(t, err)
+				assert.JSONEq(t, tt.wantBody, string(body))
+				_, _ = w.Write([]byte(`{"apiKey":"api-key","token":"token"}`))
+			}))
+			defer server.Close()
+
+			tt.profile.Endpoint = server.URL
+			c, err := NewDefaultSoracomClient(tt.profile)
+			assert.NoError(t, err)
+			client := c.(*DefaultSoracomClient)
+			assert.Equal(t, tt.wantBody != "", called)
+
+			if tt.wantBody == "" {
+				assert.Equal(t, "api-existing", client.apiKey)
+				assert.Equal(t, "existing-token", client.token)
+			} else {
+				assert.Equal(t, "api-key", client.apiKey)
+				assert.Equal(t, "token", client.token)
+			}
+		})
+	}
+}
+
+func TestProfile_AuthenticatorWithoutCredentials(t *testing.T) {
+	_, err := (&Profile{Endpoint: "https://api.soracom.io"}).Authenticator()
+	assert.Error(t, err)
+}
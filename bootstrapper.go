@@ -4,3 +4,18 @@ package soratun
 type Bootstrapper interface {
 	Execute(config *Config) (*Config, error)
 }
+
+// A Planner is a Bootstrapper which can tell what it will do before Execute, without changing anything.
+type Planner interface {
+	Plan(config *Config) (*BootstrapPlan, error)
+}
+
+// BootstrapPlan describes the action which a Bootstrapper will take with SORACOM.
+type BootstrapPlan struct {
+	// CreateSim is true if a new virtual SIM, which is billable, will be created.
+	CreateSim bool
+	// SimId is ID of the existing virtual SIM which a new Arc session will be created for. Empty if CreateSim is true.
+	SimId string
+	// Description is human-readable description of the action.
+	Description string
+}
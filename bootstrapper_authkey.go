@@ -1,6 +1,7 @@
 package soratun
 
 import (
+	"errors"
 	"fmt"
 	"os"
 )
@@ -8,26 +9,68 @@ import (
 // AuthKeyBootstrapper defines bootstrap method with SORACOM API authentication. Needs Profile information.
 type AuthKeyBootstrapper struct {
 	Profile *Profile
+	// If GenerateKey is true, WireGuard key pair will be generated locally and only the public key is registered with
+	// the Arc session.
+	GenerateKey bool
+	// SimOptions holds name, tags, group and subscription for a new virtual SIM.
+	SimOptions VirtualSimOptions
+	// ReuseSimId is ID of an existing virtual SIM. If set, a new Arc session is created for the SIM instead of creating
+	// a new virtual SIM.
+	ReuseSimId string
+	// If Force is true, a new virtual SIM is created even if the configuration has SIM ID which is no longer usable.
+	Force bool
+	// Confirm is called with description of the action before calling SORACOM API which creates a virtual SIM or an Arc
+	// session. The bootstrap is aborted if it returns an error.
+	Confirm func(action string) error
+
+	client SoracomClient
 }
 
 // Execute calls SORACOM API to create a new standalone virtual subscriber.
 func (b *AuthKeyBootstrapper) Execute(config *Config) (*Config, error) {
-	client, err := NewDefaultSoracomClient(*b.Profile)
+	client, err := b.soracomClient()
 	if err != nil {
 		return nil, err
 	}
 
-	if v := os.Getenv("SORACOM_VERBOSE"); v != "" {
-		client.SetVerbose(true)
+	plan, err := b.plan(client, config)
+	if err != nil {
+		return nil, err
 	}
 
-	if config == nil {
-		// if no config, bootstrap with API call
-		sim, err := client.CreateVirtualSim()
+	if err := b.confirm(plan.Description); err != nil {
+		return nil, err
+	}
+
+	if plan.CreateSim {
+		// if no config or no usable virtual SIM in the config, bootstrap with API call
+		options, err := b.SimOptions.Expand()
 		if err != nil {
 			return nil, err
 		}
 
+		sim, err := client.CreateVirtualSim(options)
+		if err != nil {
+			return nil, err
+		}
+
+		config = b.prepareConfig(config)
+		config.SimId = sim.SimId
+		config.ArcSession = &sim.ArcSession
+		if !b.SimOptions.isZero() {
+			simOptions := b.SimOptions
+			config.VirtualSim = &simOptions
+		}
+
+		if b.GenerateKey {
+			// discard the key pair generated by the server, and register our own public key with a new session
+			if err := RotateKeys(client, config); err != nil {
+				return nil, fmt.Errorf("virtual SIM/subscriber %s was created but failed to create a new Arc session with locally generated key: %w. "+
+					"Please retry with \"soratun bootstrap authkey --generate-key --reuse-sim %s\"", sim.SimId, err, sim.SimId)
+			}
+			return config, nil
+		}
+
 		privateKey, err := NewKey(sim.Profiles[sim.SimId].ArcClientPeerPrivateKey)
 		if err != nil {
 			return nil, fmt.Errorf("virtual SIM/subscriber %s was created but failed to create a configuration. "+
@@ -44,22 +87,30 @@ func (b *AuthKeyBootstrapper) Execute(config *Config) (*Config, error) {
 				"You have to create arc.json manually", sim.SimId)
 		}
 
-		config = &Config{
-			PrivateKey:           privateKey,
-			PublicKey:            publicKey,
-			SimId:                sim.SimId,
-			LogLevel:             LogLevelVerbose,
-			EnableMetrics:        true,
-			Interface:            DefaultInterfaceName(),
-			AdditionalAllowedIPs: nil,
-			Mtu:                  DefaultMTU,
-			PersistentKeepalive:  DefaultPersistentKeepaliveInterval,
-			Profile:              b.Profile,
-			ArcSession:           &sim.ArcSession,
+		config.PrivateKey = privateKey
+		config.PublicKey = publicKey
+		return config, nil
+	}
+
+	if config == nil || config.SimId != plan.SimId {
+		// attach to the existing virtual SIM. As the private key for the SIM is unknown, generate a new key pair.
+		config = b.prepareConfig(config)
+		config.SimId = plan.SimId
+		if err := RotateKeys(client, config); err != nil {
+			return nil, err
+		}
+	} else if b.GenerateKey {
+		// or update arcSession with new key pair
+		if err := RotateKeys(client, config); err != nil {
+			return nil, err
 		}
 	} else {
 		// or just update arcSession
-		arcSession, err := client.CreateArcSession(config.SimId, config.PublicKey.AsWgKey().String())
+		publicKey := ""
+		if config.PublicKey != (Key{}) {
+			publicKey = config.PublicKey.String()
+		}
+		arcSession, err := client.CreateArcSession(config.SimId, publicKey)
 		if err != nil {
 			return nil, err
 		}
@@ -68,3 +119,130 @@ func (b *AuthKeyBootstrapper) Execute(config *Config) (*Config, error) {
 
 	return config, nil
 }
+
+// Plan authenticates with SORACOM API and returns whether Execute will create a new virtual SIM or only a new Arc
+// session for the config. Nothing is changed.
+func (b *AuthKeyBootstrapper) Plan(config *Config) (*BootstrapPlan, error) {
+	client, err := b.soracomClient()
+	if err != nil {
+		return nil, err
+	}
+	return b.plan(client, config)
+}
+
+func (b *AuthKeyBootstrapper) plan(client SoracomClient, config *Config) (*BootstrapPlan, error) {
+	simId, err := b.targetSimId(client, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if simId != "" {
+		return &BootstrapPlan{
+			SimId:       simId,
+			Description: fmt.Sprintf("Create a new Arc session for virtual SIM %s. Current session of the SIM will be replaced", simId),
+		}, nil
+	}
+
+	options, err := b.SimOptions.Expand()
+	if err != nil {
+		return nil, err
+	}
+	return &BootstrapPlan{
+		CreateSim:   true,
+		Description: fmt.Sprintf("Create a new virtual SIM with subscription %q. This is billable", options.Subscription),
+	}, nil
+}
+
+// targetSimId returns ID of the virtual SIM to create a new Arc session for, or empty string if a new virtual SIM
+// should be created. It returns an error if the SIM is specified but not usable, to avoid creating a duplicate virtual
+// SIM by mistake.
+func (b *AuthKeyBootstrapper) targetSimId(client SoracomClient, config *Config) (string, error) {
+	if b.ReuseSimId != "" {
+		if err := checkSimUsable(client, b.ReuseSimId); err != nil {
+			return "", err
+		}
+		return b.ReuseSimId, nil
+	}
+
+	if config == nil || config.SimId == "" {
+		return "", nil
+	}
+
+	err := checkSimUsable(client, config.SimId)
+	if err == nil {
+		return config.SimId, nil
+	}
+	if errors.Is(err, errSimNotUsable) && b.Force {
+		fmt.Fprintf(os.Stderr, "WARNING: %v. Creating a new virtual SIM as forced\n", err)
+		return "", nil
+	}
+	return "", fmt.Errorf("%w. Refusing to create a new virtual SIM to avoid duplication. "+
+		"Use \"--reuse-sim\" to use another existing virtual SIM, or \"--force\" to create a new one", err)
+}
+
+var errSimNotUsable = errors.New("SIM is not usable")
+
+// checkSimUsable returns errSimNotUsable if the SIM does not exist or is terminated. The SIM is assumed to be usable if
+// the credential is not allowed to call Sim:getSim, which was not required before.
+func checkSimUsable(client SoracomClient, simId string) error {
+	sim, err := client.GetSim(simId)
+	if errors.Is(err, ErrSimForbidden) {
+		fmt.Fprintf(os.Stderr, "WARNING: failed to check status of virtual SIM %s as Sim:getSim is not allowed. Add it to the permission to avoid creating an Arc session for a terminated SIM\n", simId)
+		return nil
+	}
+	if errors.Is(err, ErrSimNotFound) {
+		return fmt.Errorf("%w: virtual SIM %s is not found", errSimNotUsable, simId)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get virtual SIM %s: %w", simId, err)
+	}
+	if sim.Status == "terminated" {
+		return fmt.Errorf("%w: virtual SIM %s is terminated", errSimNotUsable, simId)
+	}
+	return nil
+}
+
+// prepareConfig returns config for a virtual SIM which is not in the config yet, with default values.
+func (b *AuthKeyBootstrapper) prepareConfig(config *Config) *Config {
+	if config == nil {
+		config = &Config{
+			LogLevel:             LogLevelVerbose,
+			EnableMetrics:        true,
+			Interface:            DefaultInterfaceName(),
+			AdditionalAllowedIPs: nil,
+			Mtu:                  DefaultMTU,
+			PersistentKeepalive:  DefaultPersistentKeepaliveInterval,
+		}
+	} else if config.Interface == "" {
+		config.Interface = DefaultInterfaceName()
+	}
+	config.Profile = b.Profile
+	if b.Profile.Token != "" {
+		// API token expires, and later commands would fail with an authentication error
+		config.Profile = nil
+	}
+	return config
+}
+
+func (b *AuthKeyBootstrapper) confirm(action string) error {
+	if b.Confirm == nil {
+		return nil
+	}
+	return b.Confirm(action)
+}
+
+func (b *AuthKeyBootstrapper) soracomClient() (SoracomClient, error) {
+	if b.client != nil {
+		return b.client, nil
+	}
+
+	client, err := NewDefaultSoracomClient(*b.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	if v := os.Getenv("SORACOM_VERBOSE"); v != "" {
+		client.SetVerbose(true)
+	}
+	return client, nil
+}
@@ -0,0 +1,153 @@
+package soratun
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthKeyBootstrapper_Execute(t *testing.T) {
+	_, serverPublicKey, err := GenerateKeyPair()
+	assert.NoError(t, err)
+	privateKey, publicKey, err := GenerateKeyPair()
+	assert.NoError(t, err)
+
+	arcSession := map[string]interface{}{
+		"arcServerPeerPublicKey": serverPublicKey.String(),
+		"arcServerEndpoint":      "192.0.2.1:11010",
+		"arcAllowedIPs":          []string{"100.127.0.0/16"},
+		"arcClientPeerIpAddress": "10.0.0.1",
+	}
+
+	tests := []struct {
+		name       string
+		config     *Config
+		reuseSimId string
+		force      bool
+		wantCalls  []string
+		wantSimId  string
+		wantErr    bool
+	}{
+		{
+			name:      "creates a new SIM without configuration",
+			config:    nil,
+			wantCalls: []string{"POST /v1/sims"},
+			wantSimId: "new",
+		},
+		{
+			name:      "refreshes session of the SIM in configuration",
+			config:    &Config{SimId: "active", PrivateKey: privateKey, PublicKey: publicKey},
+			wantCalls: []string{"GET /v1/sims/active", "POST /v1/sims/active/sessions/arc"},
+			wantSimId: "active",
+		},
+		{
+			name:      "refreshes session of the SIM if Sim:getSim is not allowed",
+			config:    &Config{SimId: "forbidden", PrivateKey: privateKey, PublicKey: publicKey},
+			wantCalls: []string{"GET /v1/sims/forbidden", "POST /v1/sims/forbidden/sessions/arc"},
+			wantSimId: "forbidden",
+		},
+		{
+			name:      "refuses terminated SIM in configuration",
+			config:    &Config{SimId: "terminated"},
+			wantCalls: []string{"GET /v1/sims/terminated"},
+			wantErr:   true,
+		},
+		{
+			name:      "refuses missing SIM in configuration",
+			config:    &Config{SimId: "missing"},
+			wantCalls: []string{"GET /v1/sims/missing"},
+			wantErr:   true,
+		},
+		{
+			name:      "creates a new SIM if forced",
+			config:    &Config{SimId: "terminated"},
+			force:     true,
+			wantCalls: []string{"GET /v1/sims/terminated", "POST /v1/sims"},
+			wantSimId: "new",
+		},
+		{
+			name:       "reuses existing SIM with a new key pair",
+			config:     &Config{SimId: "terminated"},
+			reuseSimId: "active",
+			wantCalls:  []string{"GET /v1/sims/active", "POST /v1/sims/active/sessions/arc"},
+			wantSimId:  "active",
+		},
+		{
+			name:       "refuses to reuse terminated SIM even if forced",
+			reuseSimId: "terminated",
+			force:      true,
+			wantCalls:  []string{"GET /v1/sims/terminated"},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, r.Method+" "+r.URL.Path)
+				switch r.Method + " " + r.URL.Path {
+				case "GET /v1/sims/active":
+					_, _ = w.Write([]byte(`{"simId":"active","status":"active"}`))
+				case "GET /v1/sims/terminated":
+					_, _ = w.Write([]byte(`{"simId":"terminated","status":"terminated"}`))
+				case "POST /v1/sims":
+					_, privateKey, _ := GenerateKeyPair()
+					_, publicKey, _ := GenerateKeyPair()
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{
+						"simId":            "new",
+						"status":           "active",
+						"arcSessionStatus": arcSession,
+						"profiles": map[string]interface{}{
+							"new": map[string]string{
+								"arcClientPeerPrivateKey": privateKey.String(),
+								"arcClientPeerPublicKey":  publicKey.String(),
+							},
+						},
+					})
+				case "GET /v1/sims/forbidden":
+					http.Error(w, `{"code":"AUM0001","message":"forbidden"}`, http.StatusForbidden)
+				case "POST /v1/sims/active/sessions/arc", "POST /v1/sims/forbidden/sessions/arc":
+					_ = json.NewEncoder(w).Encode(arcSession)
+				default:
+					http.NotFound(w, r)
+				}
+			})
+
+			var actions []string
+			b := &AuthKeyBootstrapper{
+				Profile:    &Profile{AuthKeyID: "keyId-test", AuthKey: "secret-test"},
+				ReuseSimId: tt.reuseSimId,
+				Force:      tt.force,
+				Confirm: func(action string) error {
+					actions = append(actions, action)
+					return nil
+				},
+				client: client,
+			}
+
+			config, err := b.Execute(tt.config)
+			assert.Equal(t, tt.wantCalls, calls)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Empty(t, actions)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, actions, 1)
+			assert.Equal(t, tt.wantSimId, config.SimId)
+			assert.NotEqual(t, Key{}, config.PrivateKey)
+			assert.Equal(t, "10.0.0.1", config.ArcSession.ArcClientPeerIpAddress.String())
+		})
+	}
+}
+
+func TestAuthKeyBootstrapper_prepareConfig(t *testing.T) {
+	b := &AuthKeyBootstrapper{Profile: &Profile{AuthKeyID: "keyId-test", AuthKey: "secret-test"}}
+	assert.Equal(t, b.Profile, b.prepareConfig(nil).Profile)
+
+	b = &AuthKeyBootstrapper{Profile: &Profile{APIKey: "api-test", Token: "token-test"}}
+	assert.Nil(t, b.prepareConfig(&Config{Profile: &Profile{APIKey: "api-old", Token: "token-old"}}).Profile)
+}
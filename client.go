@@ -2,24 +2,39 @@ package soratun
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httputil"
+	"net/url"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/soracom/soratun/internal"
 )
 
+// ErrSimNotFound is returned by SIM APIs if the SIM does not exist.
+var ErrSimNotFound = errors.New("SIM not found")
+
+// ErrSimForbidden is returned by SIM APIs if the credential is not allowed to call the API.
+var ErrSimForbidden = errors.New("SIM API is not allowed")
+
 // A SoracomClient represents an API client for SORACOM API. See
 // https://developers.soracom.io/en/docs/tools/api-reference/ or
 // https://dev.soracom.io/jp/docs/api_guide/
 //
 //go:generate mockgen -source client.go -destination internal/mock/client.go
 type SoracomClient interface {
-	CreateVirtualSim() (*VirtualSim, error)
+	CreateVirtualSim(options VirtualSimOptions) (*VirtualSim, error)
 	CreateArcSession(simId, publicKey string) (*ArcSession, error)
+	DeleteArcSession(simId string) error
+	GetSim(simId string) (*VirtualSim, error)
+	ListSims(simType string) ([]VirtualSim, error)
+	TerminateSim(simId string) (*VirtualSim, error)
+	PutSimTags(simId string, tags map[string]string) (*VirtualSim, error)
+	SetSimGroup(simId, groupId string) (*VirtualSim, error)
 	SetVerbose(v bool)
 	Verbose() bool
 }
@@ -33,14 +48,29 @@ type DefaultSoracomClient struct {
 	verbose  bool
 }
 
-// A Profile holds SORACOM API client related information.
+// A Profile holds SORACOM API client related information. Credentials for one of authentication methods, auth key,
+// SAM user, root user, or API key and token should be set. See Profile.Authenticator.
 type Profile struct {
 	// AuthKey is SORACOM API auth key secret.
 	AuthKey string `json:"authKey,omitempty"`
 	// AuthKeyID is SORACOM API auth key ID.
 	AuthKeyID string `json:"authKeyId,omitempty"`
+	// OperatorID is operator ID of the SAM user.
+	OperatorID string `json:"operatorId,omitempty"`
+	// UserName is name of the SAM user.
+	UserName string `json:"userName,omitempty"`
+	// Email is email address of the root user.
+	Email string `json:"email,omitempty"`
+	// Password is password of the SAM user or the root user.
+	Password string `json:"password,omitempty"`
+	// APIKey is an existing SORACOM API key, which is used with Token.
+	APIKey string `json:"apiKey,omitempty"`
+	// Token is an existing SORACOM API token, which is used with APIKey.
+	Token string `json:"token,omitempty"`
 	// Endpoint is SORACOM API endpoint.
 	Endpoint string `json:"endpoint,omitempty"`
+	// MFACodeProvider is called to get one-time password for the root user with MFA enabled. Not saved.
+	MFACodeProvider func() (string, error) `json:"-"`
 }
 
 type apiParams struct {
@@ -57,6 +87,12 @@ type VirtualSim struct {
 	Status string `json:"status"`
 	// SimId is SIM ID of the subscriber.
 	SimId string `json:"simId"`
+	// Type is type of the SIM, e.g. "virtual".
+	Type string `json:"type,omitempty"`
+	// Tags holds tags of the SIM. The SIM name is stored as "name" tag.
+	Tags map[string]string `json:"tags,omitempty"`
+	// GroupId is ID of the group which the SIM belongs to.
+	GroupId string `json:"groupId,omitempty"`
 	// ArcSession holds Arc connection information.
 	ArcSession ArcSession `json:"arcSessionStatus"`
 	// Profiles holds series of SimProfile, (not SORACOM API Profile).
@@ -75,19 +111,23 @@ type SimProfile struct {
 	PrimaryImsi string `json:"primaryImsi"`
 }
 
-// NewDefaultSoracomClient returns new SoracomClient for caller.
+// Name returns the name of the SIM, which is stored as "name" tag.
+func (s *VirtualSim) Name() string {
+	return s.Tags["name"]
+}
+
+// NewDefaultSoracomClient returns new SoracomClient for caller, authenticated with the Authenticator for the Profile.
 func NewDefaultSoracomClient(p Profile) (SoracomClient, error) {
-	authKeyId := p.AuthKeyID
-	if authKeyId == "" || !strings.HasPrefix(authKeyId, "keyId-") {
-		return nil, fmt.Errorf("invalid AuthKeyId is provided. It must starts with \"keyId-\"")
+	authenticator, err := p.Authenticator()
+	if err != nil {
+		return nil, err
 	}
 
-	authKey := p.AuthKey
-	if authKey == "" || !strings.HasPrefix(authKey, "secret-") {
-		return nil, fmt.Errorf("invalid AuthKey is provided. It must starts with \"secret-\"")
-	}
+	return NewDefaultSoracomClientWithAuthenticator(p.Endpoint, authenticator)
+}
 
-	endpoint := p.Endpoint
+// NewDefaultSoracomClientWithAuthenticator returns new SoracomClient for caller, authenticated with the Authenticator.
+func NewDefaultSoracomClientWithAuthenticator(endpoint string, authenticator Authenticator) (SoracomClient, error) {
 	if endpoint == "" {
 		endpoint = "https://api.soracom.io"
 	}
@@ -100,38 +140,13 @@ func NewDefaultSoracomClient(p Profile) (SoracomClient, error) {
 		verbose:  false,
 	}
 
-	body, err := json.Marshal(struct {
-		AuthKeyID           string `json:"authKeyId"`
-		AuthKey             string `json:"authKey"`
-		TokenTimeoutSeconds int    `json:"tokenTimeoutSeconds"`
-	}{
-		AuthKeyID:           authKeyId,
-		AuthKey:             authKey,
-		TokenTimeoutSeconds: 5 * 60,
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	res, err := c.callAPI(&apiParams{
-		method: "POST",
-		path:   "/auth",
-		body:   string(body),
-	})
+	apiKey, token, err := authenticator.Authenticate(&c)
 	if err != nil {
 		return nil, err
 	}
 
-	ar := struct {
-		APIKey string `json:"apiKey"`
-		Token  string `json:"token"`
-	}{}
-	if err := json.NewDecoder(res.Body).Decode(&ar); err != nil {
-		return nil, fmt.Errorf("failed to decode auth response: %w", err)
-	}
-
-	c.apiKey = ar.APIKey
-	c.token = ar.Token
+	c.apiKey = apiKey
+	c.token = token
 	return &c, nil
 }
 
@@ -145,14 +160,32 @@ func (c *DefaultSoracomClient) Verbose() bool {
 	return c.verbose
 }
 
-// CreateVirtualSim creates new virtual SIM.
-func (c *DefaultSoracomClient) CreateVirtualSim() (*VirtualSim, error) {
+// CreateVirtualSim creates new virtual SIM with name, tags, group and subscription specified with options. options
+// should be expanded with VirtualSimOptions.Expand in advance.
+func (c *DefaultSoracomClient) CreateVirtualSim(options VirtualSimOptions) (*VirtualSim, error) {
+	subscription := options.Subscription
+	if subscription == "" {
+		subscription = DefaultSubscription
+	}
+
+	tags := make(map[string]string, len(options.Tags)+1)
+	for k, v := range options.Tags {
+		tags[k] = v
+	}
+	if options.Name != "" {
+		tags["name"] = options.Name
+	}
+
 	body, err := json.Marshal(struct {
-		Type         string `json:"type"`
-		Subscription string `json:"subscription"`
+		Type         string            `json:"type"`
+		Subscription string            `json:"subscription"`
+		Tags         map[string]string `json:"tags,omitempty"`
+		GroupId      string            `json:"groupId,omitempty"`
 	}{
 		Type:         "virtual",
-		Subscription: "planArc01",
+		Subscription: subscription,
+		Tags:         tags,
+		GroupId:      options.GroupId,
 	})
 	if err != nil {
 		return nil, err
@@ -168,27 +201,181 @@ func (c *DefaultSoracomClient) CreateVirtualSim() (*VirtualSim, error) {
 	}
 
 	var subscriber VirtualSim
-	err = json.NewDecoder(res.Body).Decode(&subscriber)
+	err = decodeResponse(res, &subscriber)
 	return &subscriber, err
 }
 
-// CreateArcSession creates new Arc session.
+// CreateArcSession creates new Arc session. If publicKey is given, it will be registered as the WireGuard public key of
+// the client peer, and the server will not generate a private key for the client.
 func (c *DefaultSoracomClient) CreateArcSession(simId, publicKey string) (*ArcSession, error) {
-	// bootstrapped SIM will have attached credential. So we can just sent empty object.
+	// bootstrapped SIM will have attached credential. So we can just sent empty object if no public key is given.
+	body, err := json.Marshal(struct {
+		ArcClientPeerPublicKey string `json:"arcClientPeerPublicKey,omitempty"`
+	}{
+		ArcClientPeerPublicKey: publicKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	res, err := c.callAPI(&apiParams{
 		method: "POST",
 		path:   "/sims/" + simId + "/sessions/arc",
-		body:   "{}",
+		body:   string(body),
 	})
 	if err != nil {
 		return nil, err
 	}
 
 	var session ArcSession
-	err = json.NewDecoder(res.Body).Decode(&session)
+	err = decodeResponse(res, &session)
 	return &session, err
 }
 
+// DeleteArcSession deletes current Arc session of the SIM.
+func (c *DefaultSoracomClient) DeleteArcSession(simId string) error {
+	res, err := c.callAPI(&apiParams{
+		method: "DELETE",
+		path:   "/sims/" + url.PathEscape(simId) + "/sessions/arc",
+	})
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// GetSim gets the SIM.
+func (c *DefaultSoracomClient) GetSim(simId string) (*VirtualSim, error) {
+	return c.callSimAPI(&apiParams{
+		method: "GET",
+		path:   "/sims/" + url.PathEscape(simId),
+	})
+}
+
+// ListSims lists SIMs of the operator. If simType is not empty, only SIMs of the type, e.g. "virtual", are returned.
+func (c *DefaultSoracomClient) ListSims(simType string) ([]VirtualSim, error) {
+	var sims []VirtualSim
+	lastEvaluatedKey := ""
+	for {
+		query := url.Values{}
+		query.Set("limit", "100")
+		if lastEvaluatedKey != "" {
+			query.Set("last_evaluated_key", lastEvaluatedKey)
+		}
+
+		res, err := c.callAPI(&apiParams{
+			method: "GET",
+			path:   "/sims?" + query.Encode(),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var page []VirtualSim
+		if err := decodeResponse(res, &page); err != nil {
+			return nil, fmt.Errorf("failed to decode SIM list: %w", err)
+		}
+
+		for _, sim := range page {
+			if simType == "" || sim.Type == simType {
+				sims = append(sims, sim)
+			}
+		}
+
+		lastEvaluatedKey = res.Header.Get("X-Soracom-Next-Key")
+		if lastEvaluatedKey == "" {
+			return sims, nil
+		}
+	}
+}
+
+// TerminateSim terminates the SIM. Terminated SIM can not be used anymore.
+func (c *DefaultSoracomClient) TerminateSim(simId string) (*VirtualSim, error) {
+	return c.callSimAPI(&apiParams{
+		method: "POST",
+		path:   "/sims/" + url.PathEscape(simId) + "/terminate",
+	})
+}
+
+// PutSimTags adds or updates tags of the SIM. Use "name" tag to set the SIM name.
+func (c *DefaultSoracomClient) PutSimTags(simId string, tags map[string]string) (*VirtualSim, error) {
+	type tag struct {
+		TagName  string `json:"tagName"`
+		TagValue string `json:"tagValue"`
+	}
+
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	t := make([]tag, 0, len(tags))
+	for _, name := range names {
+		t = append(t, tag{TagName: name, TagValue: tags[name]})
+	}
+
+	body, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.callSimAPI(&apiParams{
+		method: "PUT",
+		path:   "/sims/" + url.PathEscape(simId) + "/tags",
+		body:   string(body),
+	})
+}
+
+// SetSimGroup sets the group of the SIM. If groupId is empty, the SIM will be removed from current group.
+func (c *DefaultSoracomClient) SetSimGroup(simId, groupId string) (*VirtualSim, error) {
+	if groupId == "" {
+		return c.callSimAPI(&apiParams{
+			method: "POST",
+			path:   "/sims/" + url.PathEscape(simId) + "/unset_group",
+		})
+	}
+
+	body, err := json.Marshal(struct {
+		GroupId string `json:"groupId"`
+	}{
+		GroupId: groupId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.callSimAPI(&apiParams{
+		method: "POST",
+		path:   "/sims/" + url.PathEscape(simId) + "/set_group",
+		body:   string(body),
+	})
+}
+
+// callSimAPI calls SORACOM API which returns a SIM object.
+func (c *DefaultSoracomClient) callSimAPI(params *apiParams) (*VirtualSim, error) {
+	res, err := c.callAPI(params)
+	if res != nil && res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %v", ErrSimNotFound, err)
+	}
+	if res != nil && res.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("%w: %v", ErrSimForbidden, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sim VirtualSim
+	err = decodeResponse(res, &sim)
+	return &sim, err
+}
+
+// decodeResponse decodes the JSON body of res into v, and closes the body so that the connection can be reused.
+func decodeResponse(res *http.Response, v interface{}) error {
+	defer res.Body.Close()
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
 func (c *DefaultSoracomClient) callAPI(params *apiParams) (*http.Response, error) {
 	req, err := c.makeRequest(params)
 	if err != nil {
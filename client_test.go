@@ -0,0 +1,109 @@
+package soratun
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) SoracomClient {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/auth", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"apiKey":"api-key","token":"token"}`))
+	})
+	mux.HandleFunc("/", handler)
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client, err := NewDefaultSoracomClient(Profile{
+		AuthKeyID: "keyId-test",
+		AuthKey:   "secret-test",
+		Endpoint:  server.URL,
+	})
+	assert.NoError(t, err)
+	return client
+}
+
+func TestDefaultSoracomClient_CreateArcSession(t *testing.T) {
+	_, publicKey, err := GenerateKeyPair()
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		publicKey string
+		want      string
+	}{
+		{name: "without public key", publicKey: "", want: "{}"},
+		{name: "with public key", publicKey: publicKey.String(), want: `{"arcClientPeerPublicKey":"` + publicKey.String() + `"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "POST", r.Method)
+				assert.Equal(t, "/v1/sims/8942310000000000000/sessions/arc", r.URL.Path)
+				assert.Equal(t, "api-key", r.Header.Get("X-Soracom-Api-Key"))
+				body, err := io.ReadAll(r.Body)
+				assert.NoError(t, err)
+				assert.JSONEq(t, tt.want, string(body))
+
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"arcServerPeerPublicKey": publicKey.String(),
+					"arcServerEndpoint":      "192.0.2.1:11010",
+					"arcAllowedIPs":          []string{"100.127.0.0/16"},
+					"arcClientPeerIpAddress": "10.0.0.1",
+				})
+			})
+
+			session, err := client.CreateArcSession("8942310000000000000", tt.publicKey)
+			assert.NoError(t, err)
+			assert.Equal(t, "10.0.0.1", session.ArcClientPeerIpAddress.String())
+			assert.Equal(t, 11010, session.ArcServerEndpoint.Port)
+		})
+	}
+}
+
+func TestDefaultSoracomClient_ListSims(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/sims", r.URL.Path)
+		switch r.URL.Query().Get("last_evaluated_key") {
+		case "":
+			w.Header().Set("X-Soracom-Next-Key", "8942310000000000001")
+			_, _ = w.Write([]byte(`[{"simId":"8942310000000000000","type":"virtual"},{"simId":"8942310000000000001","type":"standard"}]`))
+		case "8942310000000000001":
+			_, _ = w.Write([]byte(`[{"simId":"8942310000000000002","type":"virtual","tags":{"name":"device"}}]`))
+		default:
+			t.Errorf("unexpected last_evaluated_key: %s", r.URL.Query().Get("last_evaluated_key"))
+		}
+	})
+
+	sims, err := client.ListSims("virtual")
+	assert.NoError(t, err)
+	assert.Len(t, sims, 2)
+	assert.Equal(t, "8942310000000000000", sims[0].SimId)
+	assert.Equal(t, "device", sims[1].Name())
+
+	sims, err = client.ListSims("")
+	assert.NoError(t, err)
+	assert.Len(t, sims, 3)
+}
+
+func TestDefaultSoracomClient_PutSimTags(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "PUT", r.Method)
+		assert.Equal(t, "/v1/sims/8942310000000000000/tags", r.URL.Path)
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `[{"tagName":"location","tagValue":"tokyo"},{"tagName":"name","tagValue":"device"}]`, string(body))
+		_, _ = w.Write([]byte(`{"simId":"8942310000000000000","tags":{"name":"device","location":"tokyo"}}`))
+	})
+
+	sim, err := client.PutSimTags("8942310000000000000", map[string]string{"name": "device", "location": "tokyo"})
+	assert.NoError(t, err)
+	assert.Equal(t, "device", sim.Name())
+}
@@ -2,14 +2,23 @@ package cmd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"os"
 	"path/filepath"
 
+	"github.com/manifoldco/promptui"
+
 	"github.com/soracom/soratun"
 	"github.com/spf13/cobra"
 )
 
+var (
+	forceBootstrap bool
+	dryRun         bool
+)
+
 func bootstrapCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "bootstrap",
@@ -28,6 +37,8 @@ sim      current SIM             SIM Authentication   Compatible modem/SIM card
 		Args: cobra.NoArgs,
 	}
 
+	cmd.PersistentFlags().BoolVar(&forceBootstrap, "force", false, "Bootstrap even if the configuration file is invalid, or its virtual SIM is not usable. A new virtual SIM may be created")
+
 	cmd.AddCommand(bootstrapAuthKeyCmd())
 	cmd.AddCommand(bootstrapCellularCmd())
 	cmd.AddCommand(bootstrapSimCmd())
@@ -38,31 +49,76 @@ sim      current SIM             SIM Authentication   Compatible modem/SIM card
 // bootstrap do bootstrap with specified bootstrapper. If persist is set to true, save it to the path specified with "--config" flag
 func bootstrap(bootstrapper soratun.Bootstrapper) error {
 	var currentConfig *soratun.Config = nil
+	invalid := false
 
 	if !dumpConfig {
-		// Won't check error from `readConfig` because:
+		unlock, err := lockConfigurationFile()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		// In the very first run, there is no `arc.json` in the file system. Bootstrapper#Execute will create a fresh
+		// `soratun.Config` (it will vary on each bootstrap method) and can move the process forward.
 		//
-		// 1. In the very first run, which means no `arc.json` in the file system, the `readConfig` always fail.
-		//    We should move bootstrapping process forward.
-		// 2. Also bootstrap process—creating a new virtual SIM—should be finished successfully regardless of error
-		//    (read failure, invalid JSON format, etc.) Once failed (= `currentCOnfig` is `nil`), Bootstrapper#Execute
-		//    will create a fresh `soratun.Config` (it will vary on each bootstrap method) and can move the process
-		//    forward. Bootstrapper will update existing configuration.
-		currentConfig, _ = readConfig(configPath)
+		// If the configuration file exists but can not be read, we should not move forward because it may have a
+		// virtual SIM which has been created already, and bootstrapping again may create a duplicate, billed, virtual SIM.
+		// "--force" flag discards the configuration file.
+		exists, err := configExists()
+		if err != nil {
+			return err
+		}
+		if exists {
+			currentConfig, err = readConfig(configPath)
+			if err != nil {
+				if !forceBootstrap {
+					return fmt.Errorf("%w. Please fix or remove the configuration file, or use \"--force\" to bootstrap anyway", err)
+				}
+				fmt.Fprintf(os.Stderr, "WARNING: ignoring invalid configuration file as forced: %v\n", err)
+				invalid = true
+			}
+		}
+		// check before creating a new session, which makes the current private key unusable
+		if exists && !invalid && !dryRun {
+			if err := checkSecretRefUpdatable("privateKey"); err != nil {
+				return err
+			}
+		}
 	}
 
-	config, err := bootstrapper.Execute(currentConfig)
-	if err != nil {
-		return err
+	if dryRun {
+		planner, ok := bootstrapper.(soratun.Planner)
+		if !ok {
+			return errors.New("dry run is not supported by this bootstrap method")
+		}
+
+		plan, err := planner.Plan(currentConfig)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Dry run: %s. Nothing has been changed.\n", plan.Description)
+		return nil
 	}
 
-	b, err := json.MarshalIndent(config, "", "  ")
+	config, err := bootstrapper.Execute(currentConfig)
 	if err != nil {
 		return err
 	}
 
 	if !dumpConfig {
-		err = writeConfigurationToFile(string(b))
+		update, err := marshalConfig(config)
+		if err != nil {
+			return err
+		}
+		if invalid {
+			update.Current = nil
+		}
+
+		if err := printConfigDiff(update.Current, update.Content); err != nil {
+			return err
+		}
+
+		err = update.write()
 		if err != nil {
 			return err
 		}
@@ -71,18 +127,58 @@ func bootstrap(bootstrapper soratun.Bootstrapper) error {
 			fmt.Printf("Virtual subscriber SIM ID: %s\n", config.SimId)
 		}
 
-		printConfigurationFilePath()
+		printConfigurationFilePath(update.Path)
 	} else {
+		b, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			return err
+		}
 		fmt.Println(string(b))
 	}
 
 	return nil
 }
 
-func printConfigurationFilePath() {
-	path, err := filepath.Abs(configPath)
+// printConfigDiff prints redacted field-level differences between current and new configuration.
+func printConfigDiff(current, updated []byte) error {
+	lines, err := diffConfig(current, updated)
+	if err != nil {
+		return err
+	}
+
+	if len(lines) == 0 {
+		fmt.Println("No changes to the configuration file")
+		return nil
+	}
+
+	fmt.Println("Changes to the configuration file:")
+	for _, line := range lines {
+		fmt.Printf("  %s\n", line)
+	}
+	return nil
+}
+
+func printConfigurationFilePath(path string) {
+	path, err := filepath.Abs(path)
 	if err != nil {
 		log.Fatalf("Failed to get path to configuration file: %v\n", err)
 	}
 	fmt.Printf("Created/updated configuration file: %s\n", path)
 }
+
+// confirmBootstrapAction shows the action which bootstrap is about to take, and asks for confirmation if stdin is a
+// terminal and "--yes" is not specified.
+func confirmBootstrapAction(action string) error {
+	fmt.Fprintf(os.Stderr, "%s.\n", action)
+	if skipConfirm || !isTerminal(os.Stdin) {
+		return nil
+	}
+
+	if _, err := (&promptui.Prompt{
+		Label:     "Continue",
+		IsConfirm: true,
+	}).Run(); err != nil {
+		return errors.New("aborted")
+	}
+	return nil
+}
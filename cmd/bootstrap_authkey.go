@@ -3,7 +3,9 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"os"
 	"strings"
 
 	"github.com/manifoldco/promptui"
@@ -12,32 +14,85 @@ import (
 )
 
 var (
-	authKeyId string
-	authKey   string
-	coverage  string
-	endpoints = []string{"https://g.api.soracom.io", "https://api.soracom.io"}
+	authKeyId    string
+	authKey      string
+	authKeyFile  string
+	operatorId   string
+	samUserName  string
+	email        string
+	password     string
+	passwordFile string
+	apiKey       string
+	apiToken     string
+	mfaCode      string
+	coverage     string
+	generateKey  bool
+
+	soracomCliProfile string
+	reuseSimId        string
+
+	newSimName         string
+	newSimTags         map[string]string
+	newSimGroupId      string
+	newSimSubscription string
+	endpoints          = []string{"https://g.api.soracom.io", "https://api.soracom.io"}
+)
+
+// authentication methods for SORACOM API, in the order of the wizard.
+const (
+	authMethodAuthKey = iota
+	authMethodSAMUser
+	authMethodRootUser
+	authMethodToken
+	authMethodUnknown = -1
 )
 
 func bootstrapAuthKeyCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "authkey",
 		Short: "Create standalone virtual SIM with SORACOM API AuthKey",
-		Long:  "This command will create a new virtual SIM which is not associated with any physical SIM, then create configuration for soratun. If configuration file (arc.json by default, or specified by --config flag) contains \"profile\", that information will be used. Else if insufficient or no flags is provided, the command will guide your setup through interactive wizard.",
-		Args:  cobra.NoArgs,
+		Long: `This command will create a new virtual SIM which is not associated with any physical SIM, then create configuration for soratun.
+
+If the configuration file already has "simId", only a new Arc session will be created for the virtual SIM. If the virtual SIM is not found or terminated, this command stops instead of creating a new one. Use "--reuse-sim" to attach to another existing virtual SIM, or "--force" to create a new virtual SIM anyway. The action, and whether it is billable, is shown before calling SORACOM API. With "--dry-run", this command only shows the action without changing anything. Changes to the configuration file are shown before writing, with secrets redacted.
+
+SORACOM API credentials are taken from the first available source of:
+
+  1. The soracom-cli profile specified with "--profile" flag.
+  2. "profile" in the configuration file (arc.json by default, or specified by --config flag).
+  3. Flags, files specified with "--auth-key-file" or "--password-file", or environment variables.
+
+One of the following authentication methods can be used. If insufficient information is provided, the command will guide your setup through interactive wizard.
+
+METHOD      FLAGS                                          ENVIRONMENT VARIABLES
+----------- ---------------------------------------------- --------------------------------------------
+Auth key    --auth-key-id, --auth-key-file (--auth-key)    SORACOM_AUTH_KEY_ID, SORACOM_AUTH_KEY
+SAM user    --operator-id, --user-name, --password-file    SORACOM_OPERATOR_ID, SORACOM_USER_NAME, SORACOM_PASSWORD
+Root user   --email, --password-file, --mfa-code           SORACOM_EMAIL, SORACOM_PASSWORD
+API token   --api-key, --api-token                         SORACOM_API_KEY, SORACOM_API_TOKEN
+
+Coverage type is specified with "--coverage-type" or SORACOM_COVERAGE_TYPE environment variable.`,
+		Args: cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
 			var err error
 			var profile *soratun.Profile
 
 			// reuse current profile information
 			currentConfig, err := readConfig(configPath)
-			if err == nil && currentConfig != nil && currentConfig.Profile != nil {
+			if soracomCliProfile != "" {
+				profile, err = soratun.LoadSoracomCliProfile(soracomCliProfile)
+				if err != nil {
+					log.Fatalf("Error while setup: %v\n", err)
+				}
+			} else if err == nil && currentConfig != nil && currentConfig.Profile != nil {
 				profile = currentConfig.Profile
 			}
 
 			if profile == nil {
-				if cmd.Flag("auth-key-id").Value.String() == "" ||
-					cmd.Flag("auth-key").Value.String() == "" ||
-					cmd.Flag("coverage-type").Value.String() == "" {
+				if err := collectCredentials(cmd); err != nil {
+					log.Fatalf("Error while setup: %v\n", err)
+				}
+
+				if !hasSufficientCredentials() {
 					fmt.Println("Not enough information to bootstrap. Launching wizard.")
 					profile, err = collectProfileInformationInteractive()
 					if err != nil {
@@ -50,8 +105,25 @@ func bootstrapAuthKeyCmd() *cobra.Command {
 					}
 				}
 			}
+			setMFACodeProvider(profile)
+			if profile.Password != "" && !dumpConfig && !dryRun && !hasSecretRef("profile", "password") {
+				fmt.Fprintln(os.Stderr, "WARNING: password will be saved in plain text in the configuration file, and can be read by anyone who can read the file. Consider an auth key, or run \"soratun config encrypt\" after bootstrap.")
+			}
 
-			err = bootstrap(&soratun.AuthKeyBootstrapper{Profile: profile})
+			var simOptions soratun.VirtualSimOptions
+			if currentConfig != nil && currentConfig.VirtualSim != nil {
+				simOptions = *currentConfig.VirtualSim
+			}
+			collectVirtualSimOptionsFromFlags(cmd, &simOptions)
+
+			err = bootstrap(&soratun.AuthKeyBootstrapper{
+				Profile:     profile,
+				GenerateKey: generateKey,
+				SimOptions:  simOptions,
+				ReuseSimId:  reuseSimId,
+				Force:       forceBootstrap,
+				Confirm:     confirmBootstrapAction,
+			})
 			if err != nil {
 				log.Fatalf("failed to bootstrap: %v", err)
 			}
@@ -60,77 +132,292 @@ func bootstrapAuthKeyCmd() *cobra.Command {
 
 	cmd.Flags().StringVar(&authKeyId, "auth-key-id", "", "SORACOM API auth key ID")
 	cmd.Flags().StringVar(&authKey, "auth-key", "", "SORACOM API auth key")
+	cmd.Flags().StringVar(&authKeyFile, "auth-key-file", "", "Path to a file which contains SORACOM API auth key, or \"-\" to read from stdin")
+	cmd.Flags().StringVar(&operatorId, "operator-id", "", "Operator ID of the SAM user")
+	cmd.Flags().StringVar(&samUserName, "user-name", "", "Name of the SAM user")
+	cmd.Flags().StringVar(&email, "email", "", "Email address of the root user")
+	cmd.Flags().StringVar(&passwordFile, "password-file", "", "Path to a file which contains password of the SAM user or the root user, or \"-\" to read from stdin")
+	cmd.Flags().StringVar(&mfaCode, "mfa-code", "", "One-time password for the root user with MFA enabled. Will be asked if omitted on terminal")
+	cmd.Flags().StringVar(&apiKey, "api-key", "", "Existing SORACOM API key, which is used with --api-token instead of authentication")
+	cmd.Flags().StringVar(&apiToken, "api-token", "", "Existing SORACOM API token, which is used with --api-key instead of authentication")
 	cmd.Flags().StringVar(&coverage, "coverage-type", "", "Specify coverage type, \"g\" for Global, \"jp\" for Japan")
+	cmd.Flags().StringVar(&soracomCliProfile, "profile", "", "Name of soracom-cli profile to use, which is stored in ~/.soracom/<name>.json (or $SORACOM_PROFILE_DIR)")
+	cmd.Flags().BoolVar(&generateKey, "generate-key", false, "Generate WireGuard key pair locally and register only the public key with the Arc session")
+	cmd.Flags().StringVar(&newSimName, "sim-name", "", "Name of a new virtual SIM, which will override arc.json#virtualSim.name value. Can use {{hostname}}, {{machineId}} and {{env \"NAME\"}}")
+	cmd.Flags().StringToStringVar(&newSimTags, "sim-tag", nil, "Tag of a new virtual SIM in \"key=value\" form, which will be added to arc.json#virtualSim.tags. Can be specified multiple times. Value can use the same templates as --sim-name")
+	cmd.Flags().StringVar(&newSimGroupId, "group-id", "", "ID of the group which a new virtual SIM will belong to, which will override arc.json#virtualSim.groupId value")
+	cmd.Flags().StringVar(&reuseSimId, "reuse-sim", "", "ID of an existing virtual SIM to create a new Arc session for, instead of creating a new virtual SIM. A new key pair will be generated locally")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Authenticate and show whether a new virtual SIM would be created or only a new Arc session, without changing anything")
+	cmd.Flags().BoolVar(&skipConfirm, "yes", false, "Create a virtual SIM or an Arc session without confirmation")
+	cmd.Flags().StringVar(&newSimSubscription, "subscription", soratun.DefaultSubscription, "Subscription of a new virtual SIM, which will override arc.json#virtualSim.subscription value")
 
 	return cmd
 }
 
-func collectProfileInformationInteractive() (*soratun.Profile, error) {
-	authKeyId, err := askInput(promptui.Prompt{
-		Label: "SORACOM API auth key ID (starts with \"keyId-\")",
-		Validate: func(input string) error {
-			if !strings.HasPrefix(input, "keyId-") {
-				return errors.New("auth key ID should start with \"keyId-\"")
-			}
-			return nil
-		},
-		Mask: '*',
-	})
-	if err != nil {
-		return nil, err
+// collectVirtualSimOptionsFromFlags overrides options with flags explicitly set.
+func collectVirtualSimOptionsFromFlags(cmd *cobra.Command, options *soratun.VirtualSimOptions) {
+	if cmd.Flags().Changed("sim-name") {
+		options.Name = newSimName
 	}
 
-	authKey, err = askInput(promptui.Prompt{
-		Label: "SORACOM API auth key (starts with \"secret-\")",
-		Validate: func(input string) error {
-			if !strings.HasPrefix(input, "secret-") {
-				return errors.New("auth key should start with \"secret-\"")
-			}
-			return nil
-		},
-		Mask: '*',
-	})
-	if err != nil {
-		return nil, err
+	if len(newSimTags) > 0 {
+		tags := make(map[string]string, len(options.Tags)+len(newSimTags))
+		for k, v := range options.Tags {
+			tags[k] = v
+		}
+		for k, v := range newSimTags {
+			tags[k] = v
+		}
+		options.Tags = tags
 	}
 
-	selected, err := askOne(promptui.Select{
-		Label: "Coverage to create a new virtual SIM",
-		Items: []string{
-			"Global coverage (g.api.soracom.io)",
-			"Japan coverage (api.soracom.io)",
-		},
-	})
+	if cmd.Flags().Changed("group-id") {
+		options.GroupId = newSimGroupId
+	}
+
+	if cmd.Flags().Changed("subscription") {
+		options.Subscription = newSimSubscription
+	}
+}
+
+// collectCredentials fills credentials and coverage type which are not specified with flags, from files specified with
+// "--auth-key-file" or "--password-file" flag, or environment variables.
+func collectCredentials(cmd *cobra.Command) error {
+	if cmd.Flags().Changed("auth-key") {
+		fmt.Fprintln(os.Stderr, "WARNING: auth key specified with \"--auth-key\" may be leaked via shell history or process list. Consider using \"--auth-key-file\" or SORACOM_AUTH_KEY environment variable.")
+	}
+
+	fromEnv := func(value *string, name string) {
+		if *value == "" {
+			*value = os.Getenv(name)
+		}
+	}
+
+	fromEnv(&authKeyId, "SORACOM_AUTH_KEY_ID")
+	if authKey == "" && authKeyFile != "" {
+		secret, err := readSecretFile(authKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read auth key: %w", err)
+		}
+		authKey = secret
+	}
+	fromEnv(&authKey, "SORACOM_AUTH_KEY")
+
+	fromEnv(&operatorId, "SORACOM_OPERATOR_ID")
+	fromEnv(&samUserName, "SORACOM_USER_NAME")
+	fromEnv(&email, "SORACOM_EMAIL")
+	if passwordFile != "" {
+		secret, err := readSecretFile(passwordFile)
+		if err != nil {
+			return fmt.Errorf("failed to read password: %w", err)
+		}
+		password = secret
+	}
+	fromEnv(&password, "SORACOM_PASSWORD")
+
+	fromEnv(&apiKey, "SORACOM_API_KEY")
+	fromEnv(&apiToken, "SORACOM_API_TOKEN")
+
+	fromEnv(&coverage, "SORACOM_COVERAGE_TYPE")
+
+	return nil
+}
+
+// readSecretFile reads a secret from the file, or stdin if path is "-". Leading and trailing white spaces are removed.
+func readSecretFile(path string) (string, error) {
+	var b []byte
+	var err error
+	if path == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(path)
+	}
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	return strings.TrimSpace(string(b)), nil
+}
 
-	return &soratun.Profile{
-		AuthKey:   authKey,
-		AuthKeyID: authKeyId,
-		Endpoint:  endpoints[selected],
-	}, nil
+// authMethod returns the authentication method guessed from collected credentials.
+func authMethod() int {
+	switch {
+	case apiKey != "" || apiToken != "":
+		return authMethodToken
+	case authKeyId != "" || authKey != "":
+		return authMethodAuthKey
+	case operatorId != "" || samUserName != "":
+		return authMethodSAMUser
+	case email != "":
+		return authMethodRootUser
+	default:
+		return authMethodUnknown
+	}
 }
 
-func collectProfileInformationFromFlags() (*soratun.Profile, error) {
-	if !strings.HasPrefix(authKeyId, "keyId-") {
-		return nil, errors.New("auth key ID should start with \"keyId-\"")
+func hasSufficientCredentials() bool {
+	if coverage == "" {
+		return false
+	}
+
+	switch authMethod() {
+	case authMethodAuthKey:
+		return authKeyId != "" && authKey != ""
+	case authMethodSAMUser:
+		return operatorId != "" && samUserName != "" && password != ""
+	case authMethodRootUser:
+		return email != "" && password != ""
+	case authMethodToken:
+		return apiKey != "" && apiToken != ""
+	default:
+		return false
+	}
+}
+
+// collectProfileInformationInteractive asks authentication method, credentials and coverage type which are not
+// collected yet.
+func collectProfileInformationInteractive() (*soratun.Profile, error) {
+	method := authMethod()
+	if method == authMethodUnknown {
+		selected, err := askOne(promptui.Select{
+			Label: "SORACOM API authentication method",
+			Items: []string{
+				"Auth key (recommended)",
+				"SAM user name and password",
+				"Root user email and password",
+				"Existing API key and token",
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		method = selected
+	}
+
+	var err error
+	ask := func(value *string, prompt promptui.Prompt) {
+		if err != nil || *value != "" {
+			return
+		}
+		*value, err = askInput(prompt)
+	}
+
+	switch method {
+	case authMethodAuthKey:
+		ask(&authKeyId, promptui.Prompt{
+			Label: "SORACOM API auth key ID (starts with \"keyId-\")",
+			Validate: func(input string) error {
+				if !strings.HasPrefix(input, "keyId-") {
+					return errors.New("auth key ID should start with \"keyId-\"")
+				}
+				return nil
+			},
+			Mask: '*',
+		})
+		ask(&authKey, promptui.Prompt{
+			Label: "SORACOM API auth key (starts with \"secret-\")",
+			Validate: func(input string) error {
+				if !strings.HasPrefix(input, "secret-") {
+					return errors.New("auth key should start with \"secret-\"")
+				}
+				return nil
+			},
+			Mask: '*',
+		})
+	case authMethodSAMUser:
+		ask(&operatorId, promptui.Prompt{Label: "Operator ID (starts with \"OP\")"})
+		ask(&samUserName, promptui.Prompt{Label: "SAM user name"})
+		ask(&password, promptui.Prompt{Label: "Password", Mask: '*'})
+	case authMethodRootUser:
+		ask(&email, promptui.Prompt{Label: "Email address of the root user"})
+		ask(&password, promptui.Prompt{Label: "Password", Mask: '*'})
+	case authMethodToken:
+		ask(&apiKey, promptui.Prompt{Label: "SORACOM API key", Mask: '*'})
+		ask(&apiToken, promptui.Prompt{Label: "SORACOM API token", Mask: '*'})
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	if !strings.HasPrefix(authKey, "secret-") {
-		return nil, errors.New("auth key should start with \"secret-\"")
+	if coverage == "" {
+		selected, err := askOne(promptui.Select{
+			Label: "Coverage to create a new virtual SIM",
+			Items: []string{
+				"Global coverage (g.api.soracom.io)",
+				"Japan coverage (api.soracom.io)",
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		coverage = []string{"g", "jp"}[selected]
 	}
 
+	return collectProfileInformationFromFlags()
+}
+
+func collectProfileInformationFromFlags() (*soratun.Profile, error) {
 	endpoint := endpoints[1]
 	if strings.HasPrefix(coverage, "g") {
 		endpoint = endpoints[0]
 	}
 
-	return &soratun.Profile{
-		AuthKey:   authKey,
-		AuthKeyID: authKeyId,
-		Endpoint:  endpoint,
-	}, nil
+	switch authMethod() {
+	case authMethodAuthKey:
+		if !strings.HasPrefix(authKeyId, "keyId-") {
+			return nil, errors.New("auth key ID should start with \"keyId-\"")
+		}
+
+		if !strings.HasPrefix(authKey, "secret-") {
+			return nil, errors.New("auth key should start with \"secret-\"")
+		}
+
+		return &soratun.Profile{
+			AuthKey:   authKey,
+			AuthKeyID: authKeyId,
+			Endpoint:  endpoint,
+		}, nil
+	case authMethodSAMUser:
+		return &soratun.Profile{
+			OperatorID: operatorId,
+			UserName:   samUserName,
+			Password:   password,
+			Endpoint:   endpoint,
+		}, nil
+	case authMethodRootUser:
+		return &soratun.Profile{
+			Email:    email,
+			Password: password,
+			Endpoint: endpoint,
+		}, nil
+	case authMethodToken:
+		return &soratun.Profile{
+			APIKey:   apiKey,
+			Token:    apiToken,
+			Endpoint: endpoint,
+		}, nil
+	default:
+		return nil, errors.New("no credentials for SORACOM API is provided")
+	}
+}
+
+// setMFACodeProvider sets a provider of MFA one-time password to the profile for the root user, which returns the code
+// specified with "--mfa-code" flag, or asks it on terminal.
+func setMFACodeProvider(profile *soratun.Profile) {
+	if profile == nil || profile.Email == "" {
+		return
+	}
+
+	profile.MFACodeProvider = func() (string, error) {
+		if mfaCode != "" || !isTerminal(os.Stdin) {
+			return mfaCode, nil
+		}
+		return askInput(promptui.Prompt{Label: "MFA code (leave empty if MFA is not enabled)"})
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
 }
 
 func askInput(prompt promptui.Prompt) (string, error) {
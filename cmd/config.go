@@ -3,6 +3,7 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
@@ -12,7 +13,7 @@ import (
 )
 
 func configCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "config",
 		Short: "Create initial soratun configuration file without bootstrapping",
 		Args:  cobra.NoArgs,
@@ -50,29 +51,263 @@ func configCmd() *cobra.Command {
 			fmt.Println(string(b))
 		},
 	}
+
+	cmd.AddCommand(configShowCmd())
+	cmd.AddCommand(configValidateCmd())
+	cmd.AddCommand(configMigrateCmd())
+	cmd.AddCommand(configImportWireGuardCmd())
+	cmd.AddCommand(configEncryptCmd())
+	cmd.AddCommand(configDecryptCmd())
+
+	return cmd
+}
+
+func configShowCmd() *cobra.Command {
+	var effective, showSecrets bool
+
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show the configuration file",
+		Long:  "This command will show the configuration file, merged with drop-in configuration files if any. With \"--effective\", it shows the configuration which soratun actually uses, i.e. the configuration file overridden with SORATUN_* environment variables, filled with default values, and secret references resolved. The name of environment variable is SORATUN_ followed by the path to the field in upper snake case, e.g. SORATUN_MTU for \"mtu\" and SORATUN_PROFILE_AUTH_KEY for \"profile.authKey\". Lists are comma-separated, and \"postUp\" and \"postDown\" are in JSON.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			tree, err := loadConfigTree(configPath)
+			if err != nil {
+				log.Fatalf("Error: %s\n", err)
+			}
+
+			if effective {
+				config, err := readEffectiveConfig(configPath)
+				if err != nil {
+					log.Fatalf("Error: %s\n", err)
+				}
+				b, err := json.Marshal(config)
+				if err != nil {
+					log.Fatalf("failed to convert config to JSON: %v", err)
+				}
+				if tree, err = parseJSONObject(b); err != nil {
+					log.Fatalf("failed to convert config to JSON: %v", err)
+				}
+			}
+			if !showSecrets {
+				for _, path := range secretRefPaths {
+					if v, ok := tree.lookup(path); ok && v != "" {
+						if _, ok := v.(string); ok {
+							tree.replace(path, redacted)
+						}
+					}
+				}
+			}
+
+			b, err := json.MarshalIndent(tree, "", "  ")
+			if err != nil {
+				log.Fatalf("failed to convert config to JSON: %v", err)
+			}
+			fmt.Println(string(b))
+		},
+	}
+
+	cmd.Flags().BoolVar(&effective, "effective", false, "Show the configuration overridden with environment variables and filled with default values")
+	cmd.Flags().BoolVar(&showSecrets, "show-secrets", false, "Show secrets such as the private key instead of \"(redacted)\"")
+
+	return cmd
+}
+
+func configImportWireGuardCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "import-wg FILE",
+		Short: "Import WireGuard configuration file into the configuration file",
+		Long:  "This command will import WireGuard configuration file in wg-quick format, e.g. exported from the user console, into the configuration file. Key pair, Arc session, MTU, PersistentKeepalive, PostUp and PostDown are taken from the file, and other settings in the configuration file are kept, except \"simId\" which is removed if the keys do not match the current Arc session. Only one [Peer] section, SORACOM Arc server, is allowed. Specify \"-\" to read from stdin.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := importWireGuardConfig(args[0]); err != nil {
+				log.Fatalf("Error: %s\n", err)
+			}
+		},
+	}
 }
 
-func writeConfigurationToFile(conf string) error {
-	f, err := os.Create(configPath)
+func importWireGuardConfig(path string) error {
+	var b []byte
+	var err error
+	if path == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read WireGuard configuration: %w", err)
+	}
+
+	imported, warnings, err := soratun.ParseWireGuardConfig(b)
+	if err != nil {
+		return fmt.Errorf("failed to parse WireGuard configuration %s: %w", path, err)
+	}
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", path, w)
+	}
+
+	unlock, err := lockConfigurationFile()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	config := &soratun.Config{
+		LogLevel:      soratun.LogLevelVerbose,
+		EnableMetrics: true,
+		Interface:     soratun.DefaultInterfaceName(),
+	}
+	exists, err := configExists()
 	if err != nil {
 		return err
 	}
-	defer func() {
-		err := f.Close()
+	if exists {
+		if config, err = readConfig(configPath); err != nil {
+			return fmt.Errorf("%w. Please fix or remove the configuration file", err)
+		}
+	}
+
+	// the keys of another SIM should not be used to create a new Arc session of the SIM, e.g. with "soratun rotate-keys"
+	if config.SimId != "" && config.ArcSession != nil &&
+		(config.PublicKey != imported.PublicKey || config.ArcSession.ArcServerPeerPublicKey != imported.ArcSession.ArcServerPeerPublicKey) {
+		fmt.Fprintf(os.Stderr, "WARNING: \"simId\" %s is removed, since the imported keys do not match the current Arc session of the SIM. Add \"simId\" to the configuration file if they are of the same SIM\n", config.SimId)
+		config.SimId = ""
+	}
+
+	config.PrivateKey = imported.PrivateKey
+	config.PublicKey = imported.PublicKey
+	config.ArcSession = imported.ArcSession
+	if imported.Mtu != 0 {
+		config.Mtu = imported.Mtu
+	}
+	if imported.PersistentKeepalive != 0 {
+		config.PersistentKeepalive = imported.PersistentKeepalive
+	}
+	if len(imported.PostUp) > 0 {
+		config.PostUp = imported.PostUp
+	}
+	if len(imported.PostDown) > 0 {
+		config.PostDown = imported.PostDown
+	}
+
+	update, err := marshalConfig(config)
+	if err != nil {
+		return err
+	}
+	if err := printConfigDiff(update.Current, update.Content); err != nil {
+		return err
+	}
+	if err := update.write(); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	printConfigurationFilePath(update.Path)
+	return nil
+}
+
+func configEncryptCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "encrypt",
+		Short: "Encrypt secrets in the configuration file with passphrase",
+		Long:  "This command will encrypt secrets in plain text, \"privateKey\" and \"authKey\", \"password\", \"apiKey\" and \"token\" in \"profile\", in the configuration file with passphrase. The passphrase is taken from SORATUN_CONFIG_PASSPHRASE environment variable, systemd credential \"soratun-passphrase\", or asked on terminal. soratun needs the same passphrase to read the configuration file.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := confirmNewPassphrase(); err != nil {
+				log.Fatalf("Error: %s\n", err)
+			}
+			convertSecretsInConfigurationFile(encryptSecretValue, "Encrypted")
+		},
+	}
+}
+
+func configDecryptCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "decrypt",
+		Short: "Decrypt encrypted secrets in the configuration file",
+		Long:  "This command will decrypt secrets encrypted with \"soratun config encrypt\", and save them in plain text.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			convertSecretsInConfigurationFile(decryptSecretValue, "Decrypted")
+		},
+	}
+}
+
+func convertSecretsInConfigurationFile(convert func(value interface{}) (interface{}, error), verb string) {
+	unlock, err := lockConfigurationFile()
+	if err != nil {
+		log.Fatalf("Error: %s\n", err)
+	}
+	defer unlock()
+
+	paths, err := configFragments(configPath)
+	if err != nil {
+		log.Fatalf("Error: %s\n", err)
+	}
+	if _, err := os.Stat(configPath); err == nil || len(paths) == 0 {
+		paths = append([]string{configPath}, paths...)
+	}
+
+	total := 0
+	for _, path := range paths {
+		b, err := os.ReadFile(path)
 		if err != nil {
-			log.Fatal("failed to close file", err)
+			log.Fatalf("failed to open config file: %s", path)
 		}
-	}()
 
-	err = os.Chmod(f.Name(), 0600)
+		tree, err := parseJSONObject(b)
+		if err != nil {
+			log.Fatalf("error while reading config file %s: %s", path, err)
+		}
+
+		n, err := convertSecrets(tree, convert)
+		if err != nil {
+			log.Fatalf("Error: %s\n", err)
+		}
+		if n == 0 {
+			continue
+		}
+
+		b, err = json.MarshalIndent(tree, "", "  ")
+		if err != nil {
+			log.Fatalf("failed to convert config to JSON: %v", err)
+		}
+
+		if err := writeConfigurationToFile(path, string(b)); err != nil {
+			log.Fatalf("failed to write config file: %v", err)
+		}
+		total += n
+		printConfigurationFilePath(path)
+	}
+
+	if total == 0 {
+		fmt.Println("No secrets to convert in the configuration file")
+		return
+	}
+	fmt.Printf("%s %d secret(s)\n", verb, total)
+}
+
+// persistArcSession saves the key pair and Arc session in config to the configuration file, leaving other settings in
+// the file intact. Callers should hold the lock with lockConfigurationFile.
+func persistArcSession(config *soratun.Config) error {
+	current, err := readConfig(configPath)
 	if err != nil {
 		return err
 	}
 
-	_, err = f.WriteString(conf + "\n")
+	current.PrivateKey = config.PrivateKey
+	current.PublicKey = config.PublicKey
+	current.ArcSession = config.ArcSession
+
+	return saveConfig(current)
+}
+
+// persistArcSessionWithLock does persistArcSession with holding the lock of the configuration file.
+func persistArcSessionWithLock(config *soratun.Config) error {
+	unlock, err := lockConfigurationFile()
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	return nil
+	return persistArcSession(config)
 }
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/soracom/soratun"
+)
+
+// configFileUpdate is new content of a configuration file.
+type configFileUpdate struct {
+	// Path is the path to the file to be written.
+	Path string
+	// Current is current content of the file, or nil if the file does not exist.
+	Current []byte
+	// Content is new content of the file.
+	Content []byte
+}
+
+// write writes the content to the file. Callers should hold the lock with lockConfigurationFile.
+func (u *configFileUpdate) write() error {
+	return writeConfigurationToFile(u.Path, string(u.Content))
+}
+
+// marshalConfig returns config in JSON to be written to the configuration file. Secret references in current
+// configuration file are kept as is, so that secrets are not written in plain text. If the drop-in directory exists,
+// only the session fragment is written. See marshalConfigFragment.
+func marshalConfig(config *soratun.Config) (*configFileUpdate, error) {
+	config.ConfigVersion = soratun.CurrentConfigVersion
+	b, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if useConfigDropIns() {
+		tree, err := parseJSONObject(b)
+		if err != nil {
+			return nil, err
+		}
+		return marshalConfigFragment(tree)
+	}
+
+	update := &configFileUpdate{Path: configPath, Content: b}
+	current, err := os.ReadFile(configPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return update, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	update.Current = current
+
+	currentTree, err := parseJSONObject(current)
+	if err != nil {
+		// invalid configuration file, which is going to be overwritten
+		return update, nil
+	}
+
+	tree, err := parseJSONObject(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applySecretRefs(tree, currentTree); err != nil {
+		return nil, err
+	}
+
+	update.Content, err = json.MarshalIndent(tree, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return update, nil
+}
+
+// saveConfig writes config to the configuration file. See marshalConfig.
+func saveConfig(config *soratun.Config) error {
+	update, err := marshalConfig(config)
+	if err != nil {
+		return err
+	}
+	return update.write()
+}
+
+// writeConfigurationToFile writes conf to a temporary file, then renames it to path, which is the configuration file
+// or a drop-in configuration file, so that the file is replaced atomically. Current file is kept as a backup. Callers
+// should hold the lock with lockConfigurationFile.
+func writeConfigurationToFile(path, conf string) error {
+	return replaceConfigurationFile(path, conf, func() error {
+		if err := backupConfigurationFile(path); err != nil {
+			return fmt.Errorf("failed to backup configuration file: %w", err)
+		}
+		return nil
+	})
+}
+
+// replaceConfigurationFile writes conf to a temporary file, calls backup, then renames the temporary file to path.
+func replaceConfigurationFile(path, conf string, backup func() error) error {
+	return soratun.ReplaceFile(path, []byte(conf+"\n"), backup)
+}
+
+// backupConfigurationFile keeps current file at path as "<path>.bak.1", shifting older backups up to "<path>.bak.N",
+// where N is specified with "--config-backups" flag.
+func backupConfigurationFile(path string) error {
+	if configBackups <= 0 {
+		return nil
+	}
+
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	for i := configBackups - 1; i >= 1; i-- {
+		err := os.Rename(configBackupPath(path, i), configBackupPath(path, i+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	// hard link is enough as the configuration file is replaced with rename, not modified in place
+	if err := os.Link(path, configBackupPath(path, 1)); err == nil {
+		return nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(configBackupPath(path, 1), b, 0600)
+}
+
+func configBackupPath(path string, n int) string {
+	return fmt.Sprintf("%s.bak.%d", path, n)
+}
+
+// lockConfigurationFile takes an exclusive advisory lock on "<config>.lock", so that concurrent soratun processes never
+// overwrite the configuration file each other. Call returned function to release the lock.
+func lockConfigurationFile() (func(), error) {
+	path := configPath + ".lock"
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	fd := int(f.Fd())
+	if err := syscall.Flock(fd, syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+
+		fmt.Fprintf(os.Stderr, "Waiting for another soratun process to release %s\n", path)
+		if err := syscall.Flock(fd, syscall.LOCK_EX); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+	}
+
+	return func() {
+		_ = syscall.Flock(fd, syscall.LOCK_UN)
+		_ = f.Close()
+	}, nil
+}
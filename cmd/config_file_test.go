@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_writeConfigurationToFile(t *testing.T) {
+	originalConfigPath, originalConfigBackups := configPath, configBackups
+	t.Cleanup(func() {
+		configPath, configBackups = originalConfigPath, originalConfigBackups
+	})
+
+	configPath = filepath.Join(t.TempDir(), "arc.json")
+	configBackups = 2
+
+	for _, conf := range []string{"1", "2", "3", "4"} {
+		assert.NoError(t, writeConfigurationToFile(configPath, conf))
+	}
+
+	read := func(path string) string {
+		b, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		return string(b)
+	}
+	assert.Equal(t, "4\n", read(configPath))
+	assert.Equal(t, "3\n", read(configPath+".bak.1"))
+	assert.Equal(t, "2\n", read(configPath+".bak.2"))
+	assert.NoFileExists(t, configPath+".bak.3")
+
+	fi, err := os.Stat(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	entries, err := os.ReadDir(filepath.Dir(configPath))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3, "no temporary file should be left")
+}
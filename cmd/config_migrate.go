@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/soracom/soratun"
+	"github.com/spf13/cobra"
+)
+
+func configMigrateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrade the configuration file to the current format",
+		Long:  fmt.Sprintf("This command will upgrade the configuration file written by older soratun, and \"50-session.json\" in the drop-in directory if any, to the current format (configVersion %d). The original file is kept as \"<config>.v<version>.bak\". Other commands read a configuration file in an older format by upgrading it in memory, and never rewrite the file only to upgrade it.", soratun.CurrentConfigVersion),
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			unlock, err := lockConfigurationFile()
+			if err != nil {
+				log.Fatalf("Error: %s\n", err)
+			}
+			defer unlock()
+
+			paths := []string{configPath}
+			if useConfigDropIns() {
+				paths = append(paths, sessionFragmentPath())
+			}
+
+			upgraded := false
+			for _, path := range paths {
+				ok, err := migrateConfigFile(path)
+				if err != nil {
+					log.Fatalf("Error: %s\n", err)
+				}
+				upgraded = upgraded || ok
+			}
+			if !upgraded {
+				fmt.Printf("Configuration file is already in the current format (configVersion %d)\n", soratun.CurrentConfigVersion)
+			}
+		},
+	}
+}
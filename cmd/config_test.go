@@ -5,6 +5,8 @@ import (
 	"io"
 	"net"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/soracom/soratun"
@@ -42,3 +44,57 @@ func Test_configCmd(t *testing.T) {
 	assert.Equal(t, 11010, conf.ArcSession.ArcServerEndpoint.Port)
 	assert.EqualValues(t, "localhost:11010", conf.ArcSession.ArcServerEndpoint.RawEndpoint)
 }
+
+func Test_importWireGuardConfig(t *testing.T) {
+	originalConfigPath := configPath
+	t.Cleanup(func() { configPath = originalConfigPath })
+	dir := t.TempDir()
+	configPath = filepath.Join(dir, "arc.json")
+
+	current := `{
+  "configVersion": 1,
+  "simId": "8942310022000000000",
+  "privateKey": "8K4cUrwYpyE3jYeKyFvX3r3Ty+rOSYRKBr7QdGCBY1w=",
+  "publicKey": "hiTL1IsjrklEDfWjMP1Uw7/62YZ1TVxzk+mR1knQKAQ=",
+  "arcSession": {
+    "arcServerPeerPublicKey": "5dTfnbPQrKRJhHBhazqHIzVKxA6Ga89rWWvdXnr0OCA=",
+    "arcServerEndpoint": "192.0.2.1:11010",
+    "arcAllowedIPs": ["100.127.0.0/16"],
+    "arcClientPeerIpAddress": "10.123.45.67"
+  }
+}`
+	wg := `[Interface]
+PrivateKey = 8K4cUrwYpyE3jYeKyFvX3r3Ty+rOSYRKBr7QdGCBY1w=
+Address = 10.123.45.68/32
+
+[Peer]
+PublicKey = 5dTfnbPQrKRJhHBhazqHIzVKxA6Ga89rWWvdXnr0OCA=
+AllowedIPs = 100.127.0.0/16
+Endpoint = 192.0.2.1:11010
+PersistentKeepalive = off
+`
+	wgPath := filepath.Join(dir, "wg0.conf")
+	read := func() *soratun.Config {
+		config, err := readConfig(configPath)
+		assert.NoError(t, err)
+		return config
+	}
+
+	// the same keys, e.g. exported from the user console for the SIM
+	assert.NoError(t, os.WriteFile(configPath, []byte(current), 0o600))
+	assert.NoError(t, os.WriteFile(wgPath, []byte(wg), 0o600))
+	assert.NoError(t, importWireGuardConfig(wgPath))
+	config := read()
+	assert.Equal(t, "8942310022000000000", config.SimId)
+	assert.Equal(t, "10.123.45.68", config.ArcSession.ArcClientPeerIpAddress.String())
+	assert.Equal(t, soratun.PersistentKeepaliveOff, config.PersistentKeepalive)
+
+	// the keys of another SIM
+	assert.NoError(t, os.WriteFile(configPath, []byte(current), 0o600))
+	other := strings.Replace(wg, "8K4cUrwYpyE3jYeKyFvX3r3Ty+rOSYRKBr7QdGCBY1w=", "QEn7+5+O1qk9sOHmaOmfvdrpuNLsxDGuIFb+2OHtX2g=", 1)
+	assert.NoError(t, os.WriteFile(wgPath, []byte(other), 0o600))
+	assert.NoError(t, importWireGuardConfig(wgPath))
+	config = read()
+	assert.Empty(t, config.SimId)
+	assert.Equal(t, "QEn7+5+O1qk9sOHmaOmfvdrpuNLsxDGuIFb+2OHtX2g=", config.PrivateKey.String())
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/soracom/soratun"
+	"github.com/spf13/cobra"
+)
+
+func configValidateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate",
+		Short: "Validate the configuration file",
+		Long:  "This command will validate the configuration file against the configuration schema, then check that the public key matches the private key, an Arc session is present, MTU is in range, allowed IPs don't overlap with local routes, and hook commands exist.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			fragments, err := configFragments(configPath)
+			if err != nil {
+				log.Fatalf("Error: %s\n", err)
+			}
+
+			var b []byte
+			if len(fragments) == 0 {
+				if b, err = os.ReadFile(configPath); err != nil {
+					log.Fatalf("failed to open config file: %s", configPath)
+				}
+			} else {
+				// validate merged configuration, whose positions do not make sense
+				tree, err := loadConfigTree(configPath)
+				if err != nil {
+					log.Fatalf("Error: %s\n", err)
+				}
+				if b, err = json.MarshalIndent(tree, "", "  "); err != nil {
+					log.Fatalf("failed to convert config to JSON: %v", err)
+				}
+			}
+
+			errs := soratun.ValidateConfigSchema(b)
+			if config, err := readConfig(configPath); err != nil {
+				if len(errs) == 0 {
+					errs = append(errs, soratun.ValidationError{Message: err.Error()})
+				}
+			} else {
+				errs = append(errs, validateConfig(b, config)...)
+			}
+
+			if len(fragments) > 0 {
+				for i := range errs {
+					errs[i].Line, errs[i].Column = 0, 0
+				}
+			}
+
+			if printValidationErrors(errs) > 0 {
+				os.Exit(1)
+			}
+			fmt.Printf("%s is valid\n", configPath)
+		},
+	}
+}
+
+// validateConfig checks semantic rules of config, which is read from b.
+func validateConfig(b []byte, config *soratun.Config) []soratun.ValidationError {
+	errs := config.Validate()
+	soratun.LocateValidationErrors(b, errs)
+	return errs
+}
+
+// printValidationErrors prints errs to stderr, and returns the number of errors except for warnings.
+func printValidationErrors(errs []soratun.ValidationError) int {
+	n := 0
+	for _, e := range errs {
+		if e.Line > 0 {
+			fmt.Fprintf(os.Stderr, "%s:%s\n", configPath, e)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", configPath, e)
+		}
+		if !e.Warning {
+			n++
+		}
+	}
+	return n
+}
+
+// describeConfigTreeError adds position in the configuration file at path to err like describeConfigError, unless
+// drop-in configuration files are merged into it.
+func describeConfigTreeError(path string, err error) error {
+	if fragments, _ := configFragments(path); len(fragments) > 0 {
+		return err
+	}
+	b, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return err
+	}
+	return describeConfigError(b, err)
+}
+
+// describeConfigError adds position in the configuration b to err, which is returned from parseConfig.
+func describeConfigError(b []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		errs := soratun.ValidateConfigSchema(b)
+		if len(errs) > 0 {
+			return errs[0]
+		}
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		errs := []soratun.ValidationError{{Path: typeErr.Field, Message: fmt.Sprintf("cannot be %s", typeErr.Value)}}
+		soratun.LocateValidationErrors(b, errs)
+		return errs[0]
+	}
+
+	return err
+}
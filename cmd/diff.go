@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// secretConfigPaths are paths of configuration fields whose values should not be shown, which are secretRefPaths and
+// the legacy private key in the Arc session.
+var secretConfigPaths = func() map[string]bool {
+	paths := map[string]bool{"arcSession.arcClientPeerPrivateKey": true}
+	for _, path := range secretRefPaths {
+		paths[strings.Join(path, ".")] = true
+	}
+	return paths
+}()
+
+const redacted = "(redacted)"
+
+// diffConfig returns field-level differences between two JSON configurations, one line for each field in the form of
+// "+ path: value" (added), "- path: value" (removed) or "~ path: old -> new" (changed). Values of secretConfigPaths are
+// redacted. Empty before means there is no configuration yet.
+func diffConfig(before, after []byte) ([]string, error) {
+	beforeFields := map[string]string{}
+	if len(before) > 0 {
+		if err := flattenJSON(before, beforeFields); err != nil {
+			return nil, fmt.Errorf("failed to parse current configuration: %w", err)
+		}
+	}
+
+	afterFields := map[string]string{}
+	if err := flattenJSON(after, afterFields); err != nil {
+		return nil, fmt.Errorf("failed to parse new configuration: %w", err)
+	}
+
+	paths := make([]string, 0, len(beforeFields)+len(afterFields))
+	for path := range beforeFields {
+		paths = append(paths, path)
+	}
+	for path := range afterFields {
+		if _, ok := beforeFields[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	var lines []string
+	for _, path := range paths {
+		b, inBefore := beforeFields[path]
+		a, inAfter := afterFields[path]
+		switch {
+		case !inBefore:
+			lines = append(lines, fmt.Sprintf("+ %s: %s", path, redact(path, a)))
+		case !inAfter:
+			lines = append(lines, fmt.Sprintf("- %s: %s", path, redact(path, b)))
+		case a != b:
+			lines = append(lines, fmt.Sprintf("~ %s: %s -> %s", path, redact(path, b), redact(path, a)))
+		}
+	}
+	return lines, nil
+}
+
+func redact(path, value string) string {
+	if (secretConfigPaths[path] || strings.HasSuffix(path, ".encrypted")) && value != `""` {
+		return redacted
+	}
+	return value
+}
+
+// flattenJSON stores leaf values of JSON into fields, keyed by dot-separated path, e.g. "arcSession.arcAllowedIPs[0]".
+func flattenJSON(b []byte, fields map[string]string) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	flatten("", v, fields)
+	return nil
+}
+
+func flatten(path string, v interface{}, fields map[string]string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if path == "" {
+				flatten(k, child, fields)
+			} else {
+				flatten(path+"."+k, child, fields)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			flatten(fmt.Sprintf("%s[%d]", path, i), child, fields)
+		}
+	default:
+		b, _ := json.Marshal(v)
+		fields[path] = strings.TrimSpace(string(b))
+	}
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_diffConfig(t *testing.T) {
+	before := []byte(`{
+  "privateKey": "old-private-key",
+  "simId": "8942310022000000000",
+  "logLevel": 2,
+  "additionalAllowedIPs": ["10.0.0.0/8"],
+  "arcSession": {"arcClientPeerIpAddress": "10.0.0.1"},
+  "profile": {"authKeyId": "keyId-xxx", "authKey": "secret-old"}
+}`)
+	after := []byte(`{
+  "privateKey": "new-private-key",
+  "simId": "8942310022000000000",
+  "logLevel": 2,
+  "arcSession": {"arcClientPeerIpAddress": "10.0.0.2", "arcClientPeerPrivateKey": "server-private-key"},
+  "profile": {"authKeyId": "keyId-xxx", "authKey": "secret-old"}
+}`)
+
+	lines, err := diffConfig(before, after)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`- additionalAllowedIPs[0]: "10.0.0.0/8"`,
+		`~ arcSession.arcClientPeerIpAddress: "10.0.0.1" -> "10.0.0.2"`,
+		`+ arcSession.arcClientPeerPrivateKey: (redacted)`,
+		`~ privateKey: (redacted) -> (redacted)`,
+	}, lines)
+
+	lines, err = diffConfig(nil, []byte(`{"simId": "8942310022000000000", "profile": {"authKey": "secret-xxx"}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`+ profile.authKey: (redacted)`,
+		`+ simId: "8942310022000000000"`,
+	}, lines)
+
+	lines, err = diffConfig(before, before)
+	assert.NoError(t, err)
+	assert.Empty(t, lines)
+}
@@ -0,0 +1,400 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/soracom/soratun"
+	"github.com/spf13/cobra"
+	"golang.zx2c4.com/wireguard/wgctrl"
+)
+
+const (
+	// clockSkewWarning is the clock skew which may break handshakes after the clock is corrected.
+	clockSkewWarning = 30 * time.Second
+	// clockSkewFailure is the clock skew which breaks TLS and SORACOM API authentication.
+	clockSkewFailure = 5 * time.Minute
+)
+
+var (
+	doctorOutputFormat string
+	doctorTimeout      time.Duration
+)
+
+// doctorResult is the result of a diagnostic check.
+type doctorResult string
+
+const (
+	doctorPass doctorResult = "pass"
+	doctorWarn doctorResult = "warn"
+	doctorFail doctorResult = "fail"
+	doctorSkip doctorResult = "skip"
+)
+
+// doctorCheck is a diagnostic check and its result.
+type doctorCheck struct {
+	Name    string       `json:"name"`
+	Result  doctorResult `json:"result"`
+	Message string       `json:"message"`
+	// Hint is how to fix the problem.
+	Hint string `json:"hint,omitempty"`
+}
+
+// doctor holds the configuration and the host to diagnose.
+type doctor struct {
+	config    *soratun.Config
+	configErr error
+	// validationErrors are results of soratun.Config.Validate.
+	validationErrors []soratun.ValidationError
+	timeout          time.Duration
+}
+
+// doctorChecks are diagnostic checks run by doctor command, in order.
+var doctorChecks = []struct {
+	name string
+	run  func(d *doctor) doctorCheck
+}{
+	{"tun", checkTunDevice},
+	{"capabilities", checkNetAdmin},
+	{"config", checkConfig},
+	{"keys", checkKeys},
+	{"routes", checkRoutes},
+	{"clock", checkClock},
+	{"auth", checkAuth},
+	{"handshake", checkHandshake},
+}
+
+func doctorCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose the host and the configuration",
+		Long: `Diagnose common problems of the host and the configuration, and show how to fix them:
+
+  tun           /dev/net/tun is available
+  capabilities  CAP_NET_ADMIN is available
+  config        the configuration file is valid
+  keys          the public key matches the private key
+  routes        allowed IPs don't conflict with local routes
+  clock         the clock is in sync with SORACOM API
+  auth          SORACOM API accepts the credentials in the profile
+  handshake     SORACOM Arc server responds to WireGuard handshake over UDP
+
+The command exits with non-zero status if any check fails.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if doctorOutputFormat != "text" && doctorOutputFormat != "json" {
+				log.Fatalf("Unknown output format %q, should be one of text, json", doctorOutputFormat)
+			}
+
+			d := &doctor{timeout: doctorTimeout}
+			d.config, d.configErr = readEffectiveConfig(configPath)
+			if d.configErr == nil {
+				d.validationErrors = d.config.Validate()
+			}
+
+			checks := d.run()
+			if err := printDoctorChecks(checks, doctorOutputFormat, os.Stdout); err != nil {
+				log.Fatalf("Failed to print results: %v", err)
+			}
+			if doctorOverallResult(checks) == doctorFail {
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&doctorOutputFormat, "output", "text", "Output format, \"text\" or \"json\"")
+	cmd.Flags().DurationVar(&doctorTimeout, "timeout", 10*time.Second, "Timeout for each check over the network")
+
+	return cmd
+}
+
+func (d *doctor) run() []doctorCheck {
+	var checks []doctorCheck
+	for _, c := range doctorChecks {
+		check := c.run(d)
+		check.Name = c.name
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// doctorOverallResult returns the worst result of checks.
+func doctorOverallResult(checks []doctorCheck) doctorResult {
+	result := doctorPass
+	for _, c := range checks {
+		switch {
+		case c.Result == doctorFail:
+			return doctorFail
+		case c.Result == doctorWarn:
+			result = doctorWarn
+		}
+	}
+	return result
+}
+
+func printDoctorChecks(checks []doctorCheck, format string, w io.Writer) error {
+	if format == "json" {
+		b, err := json.MarshalIndent(struct {
+			Result doctorResult  `json:"result"`
+			Checks []doctorCheck `json:"checks"`
+		}{doctorOverallResult(checks), checks}, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	}
+
+	for _, c := range checks {
+		fmt.Fprintf(w, "%-4s  %-12s  %s\n", strings.ToUpper(string(c.Result)), c.Name, c.Message)
+		if c.Hint != "" && (c.Result == doctorWarn || c.Result == doctorFail) {
+			fmt.Fprintf(w, "      %-12s  hint: %s\n", "", c.Hint)
+		}
+	}
+	return nil
+}
+
+// validationErrorsFor returns results of soratun.Config.Validate which match.
+func (d *doctor) validationErrorsFor(match func(e soratun.ValidationError) bool) []soratun.ValidationError {
+	var errs []soratun.ValidationError
+	for _, e := range d.validationErrors {
+		if match(e) {
+			errs = append(errs, e)
+		}
+	}
+	return errs
+}
+
+func isKeyValidationError(e soratun.ValidationError) bool {
+	return e.Path == "privateKey" || e.Path == "publicKey"
+}
+
+func isRouteValidationError(e soratun.ValidationError) bool {
+	return e.Warning && (e.Path == "" || strings.Contains(e.Path, "AllowedIPs"))
+}
+
+var errConfigNotLoaded = doctorCheck{Result: doctorSkip, Message: "configuration is not loaded"}
+
+func checkConfig(d *doctor) doctorCheck {
+	if d.configErr != nil {
+		hint := fmt.Sprintf("Bootstrap with \"soratun bootstrap\", or specify the configuration file with --config. Current one is %s", configPath)
+		if exists, _ := configExists(); exists {
+			hint = "Fix the configuration file. Run \"soratun config validate\" for details"
+		}
+		return doctorCheck{Result: doctorFail, Message: d.configErr.Error(), Hint: hint}
+	}
+
+	errs := d.validationErrorsFor(func(e soratun.ValidationError) bool {
+		return !isKeyValidationError(e) && !isRouteValidationError(e)
+	})
+	return validationCheck(errs, fmt.Sprintf("%s is valid", configPath), "Run \"soratun config validate\" for details")
+}
+
+func checkKeys(d *doctor) doctorCheck {
+	if d.configErr != nil {
+		return errConfigNotLoaded
+	}
+	return validationCheck(d.validationErrorsFor(isKeyValidationError), "public key matches private key",
+		"Restore the key pair from a backup of the configuration file, or run \"soratun rotate-keys\" to create a new key pair and Arc session")
+}
+
+func checkRoutes(d *doctor) doctorCheck {
+	if d.configErr != nil {
+		return errConfigNotLoaded
+	}
+	return validationCheck(d.validationErrorsFor(isRouteValidationError), "allowed IPs don't conflict with local routes",
+		"Traffic to the overlapping network will be routed to SORACOM Arc. Change the LAN address, or remove the network from additionalAllowedIPs")
+}
+
+// validationCheck returns the check for errs, which fails if there is an error other than warnings.
+func validationCheck(errs []soratun.ValidationError, ok, hint string) doctorCheck {
+	if len(errs) == 0 {
+		return doctorCheck{Result: doctorPass, Message: ok}
+	}
+
+	result := doctorWarn
+	var messages []string
+	for _, e := range errs {
+		if !e.Warning {
+			result = doctorFail
+		}
+		if e.Path == "" {
+			messages = append(messages, e.Message)
+		} else {
+			messages = append(messages, fmt.Sprintf("%s: %s", e.Path, e.Message))
+		}
+	}
+	return doctorCheck{Result: result, Message: strings.Join(messages, "; "), Hint: hint}
+}
+
+// checkClock compares the clock with Date header of SORACOM API response.
+func checkClock(d *doctor) doctorCheck {
+	endpoint := "https://api.soracom.io"
+	if d.config != nil && d.config.Profile != nil && d.config.Profile.Endpoint != "" {
+		endpoint = d.config.Profile.Endpoint
+	}
+
+	client := &http.Client{Timeout: d.timeout}
+	start := time.Now()
+	res, err := client.Head(endpoint)
+	if err != nil {
+		return doctorCheck{
+			Result:  doctorWarn,
+			Message: fmt.Sprintf("failed to get time from %s: %v", endpoint, err),
+			Hint:    "Check DNS and HTTPS connectivity to SORACOM API",
+		}
+	}
+	_ = res.Body.Close()
+	rtt := time.Since(start)
+
+	date, err := http.ParseTime(res.Header.Get("Date"))
+	if err != nil {
+		return doctorCheck{Result: doctorSkip, Message: fmt.Sprintf("%s did not return valid Date header", endpoint)}
+	}
+
+	// Date has been generated around the middle of the round trip, in seconds
+	skew := start.Add(rtt / 2).Sub(date).Truncate(time.Second)
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+	message := fmt.Sprintf("clock is off by %s from %s", skew, endpoint)
+	hint := "Synchronize the clock with NTP, e.g. \"sudo timedatectl set-ntp true\". If the clock has been ahead, SORACOM Arc server may reject handshakes until the clock catches up, so create a new Arc session with \"soratun bootstrap\""
+	switch {
+	case abs >= clockSkewFailure:
+		return doctorCheck{Result: doctorFail, Message: message, Hint: hint}
+	case abs >= clockSkewWarning:
+		return doctorCheck{Result: doctorWarn, Message: message, Hint: hint}
+	}
+	return doctorCheck{Result: doctorPass, Message: message}
+}
+
+// checkAuth authenticates with the profile, and gets the virtual SIM.
+func checkAuth(d *doctor) doctorCheck {
+	if d.configErr != nil {
+		return errConfigNotLoaded
+	}
+	if d.config.Profile == nil {
+		return doctorCheck{Result: doctorSkip, Message: "no SORACOM API profile in the configuration file"}
+	}
+
+	profile := *d.config.Profile
+	setMFACodeProvider(&profile)
+	client, err := soratun.NewDefaultSoracomClient(profile)
+	if err != nil {
+		return doctorCheck{
+			Result:  doctorFail,
+			Message: fmt.Sprintf("failed to authenticate: %v", err),
+			Hint:    "Check the credentials in \"profile\", and that the auth key or the SAM user is not deleted",
+		}
+	}
+
+	if d.config.SimId == "" {
+		return doctorCheck{Result: doctorPass, Message: "authenticated with SORACOM API"}
+	}
+
+	sim, err := client.GetSim(d.config.SimId)
+	if err != nil {
+		return doctorCheck{
+			Result:  doctorFail,
+			Message: fmt.Sprintf("authenticated, but failed to get SIM %s: %v", d.config.SimId, err),
+			Hint:    "Allow \"Sim:getSim\" to the SAM user, and check that the SIM is in the operator",
+		}
+	}
+	if sim.Status == "terminated" {
+		return doctorCheck{
+			Result:  doctorFail,
+			Message: fmt.Sprintf("SIM %s is terminated", d.config.SimId),
+			Hint:    "Bootstrap a new virtual SIM with \"soratun bootstrap authkey --force\"",
+		}
+	}
+	return doctorCheck{Result: doctorPass, Message: fmt.Sprintf("authenticated with SORACOM API, SIM %s is %s", d.config.SimId, sim.Status)}
+}
+
+// checkHandshake probes the SORACOM Arc server with a WireGuard handshake. If the tunnel is up, the latest handshake of
+// the tunnel is checked instead, since probing with the same key pair disturbs the tunnel.
+func checkHandshake(d *doctor) doctorCheck {
+	if d.configErr != nil {
+		return errConfigNotLoaded
+	}
+	if d.config.ArcSession == nil || d.config.ArcSession.ArcServerEndpoint == nil {
+		return doctorCheck{Result: doctorSkip, Message: "no Arc session in the configuration file"}
+	}
+
+	endpoint := fmt.Sprintf("%s:%d", d.config.ArcSession.ArcServerEndpoint.IP, d.config.ArcSession.ArcServerEndpoint.Port)
+	hint := fmt.Sprintf("Allow outbound UDP to %s in the firewall. If the Arc session has been replaced, e.g. by bootstrapping on another host, create a new session with \"soratun bootstrap\"", endpoint)
+
+	if check, ok := checkRunningTunnel(d.config, hint); ok {
+		return check
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	elapsed, err := soratun.ProbeHandshake(ctx, d.config)
+	if errors.Is(err, soratun.ErrNoHandshake) {
+		return doctorCheck{Result: doctorFail, Message: fmt.Sprintf("no handshake response from %s in %s", endpoint, d.timeout), Hint: hint}
+	}
+	if err != nil {
+		return doctorCheck{Result: doctorFail, Message: fmt.Sprintf("failed to probe %s: %v", endpoint, err), Hint: hint}
+	}
+	return doctorCheck{Result: doctorPass, Message: fmt.Sprintf("handshake with %s completed in %s", endpoint, elapsed.Round(time.Millisecond))}
+}
+
+// checkRunningTunnel checks the latest handshake of the tunnel for config, and returns false if the tunnel is not up.
+func checkRunningTunnel(config *soratun.Config, hint string) (doctorCheck, bool) {
+	iname := config.Interface
+	running := false
+	states, _ := soratun.ReadTunnelStates()
+	for _, s := range states {
+		if s.ConfiguredInterface == config.Interface || s.Interface == config.Interface {
+			iname = s.Interface
+			running = true
+		}
+	}
+
+	c, err := wgctrl.New()
+	if err != nil {
+		if running {
+			return doctorCheck{Result: doctorWarn, Message: fmt.Sprintf("tunnel %s is up, but failed to get its status: %v", iname, err)}, true
+		}
+		return doctorCheck{}, false
+	}
+	defer func() {
+		_ = c.Close()
+	}()
+
+	device, err := c.Device(iname)
+	if err != nil {
+		if running && !errors.Is(err, os.ErrNotExist) {
+			return doctorCheck{Result: doctorWarn, Message: fmt.Sprintf("tunnel %s is up, but failed to get its status: %v", iname, err)}, true
+		}
+		return doctorCheck{}, false
+	}
+
+	status := newInterfaceStatus(&soratun.TunnelState{Interface: iname}, device, time.Now())
+	for _, p := range status.Peers {
+		if p.HandshakeAge == nil {
+			return doctorCheck{Result: doctorFail, Message: fmt.Sprintf("tunnel %s is up, but no handshake with %s yet", iname, p.Endpoint), Hint: hint}, true
+		}
+
+		age := time.Duration(*p.HandshakeAge) * time.Second
+		message := fmt.Sprintf("tunnel %s is up, and the latest handshake with %s was %s ago", iname, p.Endpoint, age)
+		switch p.Health {
+		case soratun.HealthHealthy:
+			return doctorCheck{Result: doctorPass, Message: message}, true
+		case soratun.HealthStale:
+			return doctorCheck{Result: doctorWarn, Message: message, Hint: hint}, true
+		default:
+			return doctorCheck{Result: doctorFail, Message: message, Hint: hint}, true
+		}
+	}
+	return doctorCheck{Result: doctorFail, Message: fmt.Sprintf("tunnel %s is up, but has no peer", iname), Hint: "Restart soratun"}, true
+}
@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"os"
+)
+
+func checkTunDevice(_ *doctor) doctorCheck {
+	return doctorCheck{Result: doctorPass, Message: "utun is built into macOS"}
+}
+
+func checkNetAdmin(_ *doctor) doctorCheck {
+	if os.Geteuid() != 0 {
+		return doctorCheck{
+			Result:  doctorFail,
+			Message: "not running as root",
+			Hint:    "Run soratun with sudo",
+		}
+	}
+	return doctorCheck{Result: doctorPass, Message: "running as root"}
+}
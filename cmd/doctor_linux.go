@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const tunDevicePath = "/dev/net/tun"
+
+func checkTunDevice(d *doctor) doctorCheck {
+	if d.config != nil && d.config.TunFd > 0 {
+		return doctorCheck{Result: doctorSkip, Message: "TUN device is inherited from the parent process"}
+	}
+	if d.config != nil && d.config.UsePersistentTun {
+		if _, err := net.InterfaceByName(d.config.Interface); err != nil {
+			return doctorCheck{
+				Result:  doctorFail,
+				Message: fmt.Sprintf("persistent TUN device %s is not found", d.config.Interface),
+				Hint:    fmt.Sprintf("Create the device with \"sudo ip tuntap add dev %s mode tun user <user>\"", d.config.Interface),
+			}
+		}
+	}
+
+	f, err := os.OpenFile(tunDevicePath, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return doctorCheck{
+			Result:  doctorFail,
+			Message: fmt.Sprintf("%s is not found", tunDevicePath),
+			Hint:    "Load the tun kernel module with \"sudo modprobe tun\". In a container, pass the device, e.g. \"docker run --device /dev/net/tun\"",
+		}
+	}
+	if err != nil {
+		return doctorCheck{
+			Result:  doctorFail,
+			Message: fmt.Sprintf("failed to open %s: %v", tunDevicePath, err),
+			Hint:    fmt.Sprintf("Run soratun as root, or allow the user to read and write %s", tunDevicePath),
+		}
+	}
+	_ = f.Close()
+	return doctorCheck{Result: doctorPass, Message: fmt.Sprintf("%s is available", tunDevicePath)}
+}
+
+func checkNetAdmin(d *doctor) doctorCheck {
+	if d.config != nil && d.config.SkipInterfaceConfiguration && (d.config.TunFd > 0 || d.config.UsePersistentTun) {
+		return doctorCheck{Result: doctorSkip, Message: "CAP_NET_ADMIN is not required to attach to the TUN device without configuring it"}
+	}
+
+	caps, err := effectiveCapabilities()
+	if err != nil {
+		return doctorCheck{Result: doctorWarn, Message: fmt.Sprintf("failed to get capabilities: %v", err)}
+	}
+	if caps&(1<<unix.CAP_NET_ADMIN) == 0 {
+		return doctorCheck{
+			Result:  doctorFail,
+			Message: "CAP_NET_ADMIN is not available",
+			Hint:    "Run soratun as root, or add the capability with \"sudo setcap cap_net_admin+epi soratun\"",
+		}
+	}
+	return doctorCheck{Result: doctorPass, Message: "CAP_NET_ADMIN is available"}
+}
+
+// effectiveCapabilities returns the effective capability set of the process.
+func effectiveCapabilities() (uint64, error) {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if v, ok := strings.CutPrefix(scanner.Text(), "CapEff:"); ok {
+			return strconv.ParseUint(strings.TrimSpace(v), 16, 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, errors.New("CapEff is not found in /proc/self/status")
+}
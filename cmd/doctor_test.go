@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/soracom/soratun"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_doctorChecks(t *testing.T) {
+	d := &doctor{
+		config: &soratun.Config{},
+		validationErrors: []soratun.ValidationError{
+			{Path: "publicKey", Message: "does not match privateKey"},
+			{Path: "additionalAllowedIPs[0]", Warning: true, Message: "192.168.1.0/24 overlaps with local route 192.168.1.0/24 on eth0"},
+			{Path: "mtu", Message: "should be at least 576, but got 100"},
+		},
+	}
+
+	keys := checkKeys(d)
+	assert.Equal(t, doctorFail, keys.Result)
+	assert.Equal(t, "publicKey: does not match privateKey", keys.Message)
+
+	routes := checkRoutes(d)
+	assert.Equal(t, doctorWarn, routes.Result)
+	assert.Contains(t, routes.Message, "additionalAllowedIPs[0]: ")
+
+	config := checkConfig(d)
+	assert.Equal(t, doctorFail, config.Result)
+	assert.Equal(t, "mtu: should be at least 576, but got 100", config.Message)
+
+	d = &doctor{configErr: errors.New("failed to open config file: arc.json")}
+	assert.Equal(t, doctorFail, checkConfig(d).Result)
+	assert.Equal(t, doctorSkip, checkKeys(d).Result)
+	assert.Equal(t, doctorSkip, checkHandshake(d).Result)
+}
+
+func Test_checkClock(t *testing.T) {
+	var date time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", date.UTC().Format(http.TimeFormat))
+	}))
+	defer server.Close()
+
+	d := &doctor{config: &soratun.Config{Profile: &soratun.Profile{Endpoint: server.URL}}, timeout: 5 * time.Second}
+
+	date = time.Now()
+	assert.Equal(t, doctorPass, checkClock(d).Result)
+
+	date = time.Now().Add(time.Minute)
+	assert.Equal(t, doctorWarn, checkClock(d).Result)
+
+	date = time.Now().Add(-10 * time.Minute)
+	check := checkClock(d)
+	assert.Equal(t, doctorFail, check.Result)
+	assert.Contains(t, check.Message, "clock is off by 10m")
+}
+
+func Test_printDoctorChecks(t *testing.T) {
+	checks := []doctorCheck{
+		{Name: "tun", Result: doctorPass, Message: "/dev/net/tun is available"},
+		{Name: "capabilities", Result: doctorFail, Message: "CAP_NET_ADMIN is not available", Hint: "Run soratun as root"},
+	}
+	assert.Equal(t, doctorFail, doctorOverallResult(checks))
+
+	var b bytes.Buffer
+	assert.NoError(t, printDoctorChecks(checks, "text", &b))
+	assert.Equal(t, `PASS  tun           /dev/net/tun is available
+FAIL  capabilities  CAP_NET_ADMIN is not available
+                    hint: Run soratun as root
+`, b.String())
+
+	b.Reset()
+	assert.NoError(t, printDoctorChecks(checks, "json", &b))
+	var decoded struct {
+		Result string
+		Checks []doctorCheck
+	}
+	assert.NoError(t, json.Unmarshal(b.Bytes(), &decoded))
+	assert.Equal(t, "fail", decoded.Result)
+	assert.Equal(t, "Run soratun as root", decoded.Checks[1].Hint)
+}
@@ -0,0 +1,282 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// sessionFragmentName is the name of the drop-in configuration file which soratun writes the key pair and Arc session
+// to, so that base settings managed by others are never rewritten.
+const sessionFragmentName = "50-session.json"
+
+// sessionFragmentKeys are top-level fields which soratun writes to the session fragment.
+var sessionFragmentKeys = []string{"configVersion", "privateKey", "publicKey", "simId", "profile", "virtualSim", "arcSession"}
+
+// configDropInDir returns the drop-in directory for the configuration file at path, which is "<path>.d" unless
+// "--config-dir" flag is specified.
+func configDropInDir(path string) string {
+	if configDir != "" && path == configPath {
+		return configDir
+	}
+	return path + ".d"
+}
+
+// useConfigDropIns returns true if the drop-in directory exists. Then configuration is written to the session
+// fragment in the directory, instead of the configuration file.
+func useConfigDropIns() bool {
+	fi, err := os.Stat(configDropInDir(configPath))
+	return err == nil && fi.IsDir()
+}
+
+// sessionFragmentPath returns the path to the session fragment.
+func sessionFragmentPath() string {
+	return filepath.Join(configDropInDir(configPath), sessionFragmentName)
+}
+
+// configWritePath returns the path to the file which soratun writes configuration to.
+func configWritePath() string {
+	if useConfigDropIns() {
+		return sessionFragmentPath()
+	}
+	return configPath
+}
+
+// configFragments returns paths to "*.json" files in the drop-in directory for the configuration file at path, in
+// lexical order.
+func configFragments(path string) ([]string, error) {
+	dir := configDropInDir(path)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration directory: %w", err)
+	}
+
+	var paths []string
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, e.Name()))
+	}
+	return paths, nil
+}
+
+// configExists returns true if the configuration file or any drop-in configuration file exists.
+func configExists() (bool, error) {
+	if _, err := os.Stat(configPath); err == nil {
+		return true, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return false, fmt.Errorf("failed to open config file: %w", err)
+	}
+
+	fragments, err := configFragments(configPath)
+	return len(fragments) > 0, err
+}
+
+// loadConfigTree reads the configuration file at path and merges drop-in configuration files into it in lexical order.
+// See mergeJSONObject. Secret references are not resolved.
+func loadConfigTree(path string) (*jsonObject, error) {
+	return loadConfigTreeExcept(path, "")
+}
+
+// loadConfigTreeExcept does loadConfigTree, skipping the drop-in configuration file at exclude.
+func loadConfigTreeExcept(path, exclude string) (*jsonObject, error) {
+	fragments, err := configFragments(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := newJSONObject()
+	b, err := os.ReadFile(path)
+	if err == nil {
+		base, err := parseJSONObject(b)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading config file: %s", describeConfigError(b, err))
+		}
+		if err := upgradeConfigTree(path, base, true); err != nil {
+			return nil, fmt.Errorf("error while reading config file: %w", err)
+		}
+		if err := mergeJSONObject(tree, base); err != nil {
+			return nil, fmt.Errorf("error while reading config file: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) || len(fragments) == 0 {
+		return nil, fmt.Errorf("failed to open config file: %s", path)
+	}
+
+	for _, fragment := range fragments {
+		if fragment == exclude {
+			continue
+		}
+
+		b, err := os.ReadFile(fragment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open config file: %s", fragment)
+		}
+		obj, err := parseJSONObject(b)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading config file %s: %s", fragment, describeConfigError(b, err))
+		}
+		// drop-in configuration files were introduced with configVersion 1, so they are in the current version unless
+		// configVersion is specified. Files other than the session fragment may be managed by others, so that they are
+		// not migrated by "soratun config migrate"
+		if _, ok := obj.Get("configVersion"); ok {
+			if err := upgradeConfigTree(fragment, obj, fragment == sessionFragmentPath()); err != nil {
+				return nil, fmt.Errorf("error while reading config file %s: %w", fragment, err)
+			}
+		}
+		if err := mergeJSONObject(tree, obj); err != nil {
+			return nil, fmt.Errorf("error while reading config file %s: %w", fragment, err)
+		}
+	}
+
+	for _, field := range unknownConfigFields(tree) {
+		configWarner(path)("unknown field %q is ignored", field)
+	}
+
+	return tree, nil
+}
+
+// mergeJSONObject merges src into dst. Objects are merged recursively, and other values including lists replace values
+// in dst. A key with "+" suffix, e.g. "postUp+", appends the list to the list in dst instead.
+func mergeJSONObject(dst, src *jsonObject) error {
+	for _, key := range src.Keys() {
+		v, _ := src.Get(key)
+
+		if name := strings.TrimSuffix(key, "+"); name != key {
+			list, ok := v.([]interface{})
+			if !ok {
+				return fmt.Errorf("%s: should be a list to append", key)
+			}
+			current, ok := dst.Get(name)
+			if ok && current != nil {
+				currentList, ok := current.([]interface{})
+				if !ok {
+					return fmt.Errorf("%s: can not append to non-list value", key)
+				}
+				list = append(append([]interface{}(nil), currentList...), list...)
+			}
+			dst.Set(name, list)
+			continue
+		}
+
+		if obj, ok := v.(*jsonObject); ok {
+			child, ok := dst.values[key].(*jsonObject)
+			if !ok {
+				child = newJSONObject()
+			}
+			if err := mergeJSONObject(child, obj); err != nil {
+				return fmt.Errorf("%s.%w", key, err)
+			}
+			dst.Set(key, child)
+			continue
+		}
+
+		dst.Set(key, v)
+	}
+	return nil
+}
+
+// marshalConfigFragment returns the session fragment to be written, which holds sessionFragmentKeys in tree that
+// differ from the rest of configuration. Other changes in tree are not saved, and warned.
+func marshalConfigFragment(tree *jsonObject) (*configFileUpdate, error) {
+	path := sessionFragmentPath()
+
+	current, err := loadConfigTree(configPath)
+	if err == nil {
+		if err := applySecretRefs(tree, current); err != nil {
+			return nil, err
+		}
+	} else {
+		current = newJSONObject()
+	}
+
+	rest, err := loadConfigTreeExcept(configPath, path)
+	if err != nil {
+		if exists, _ := configExists(); exists {
+			return nil, err
+		}
+		rest = newJSONObject()
+	}
+
+	update := &configFileUpdate{Path: path}
+	fragment := newJSONObject()
+	if b, err := os.ReadFile(path); err == nil {
+		update.Current = b
+		if obj, err := parseJSONObject(b); err == nil {
+			fragment = obj
+		}
+	}
+
+	isSessionKey := map[string]bool{}
+	for _, key := range sessionFragmentKeys {
+		isSessionKey[key] = true
+
+		v, ok := tree.Get(key)
+		r, inRest := rest.Get(key)
+		if ok && (!inRest || !jsonEqual(v, r)) {
+			fragment.Set(key, v)
+		} else {
+			fragment.Delete(key)
+		}
+	}
+
+	for _, key := range tree.Keys() {
+		if isSessionKey[key] {
+			continue
+		}
+		v, _ := tree.Get(key)
+		c, ok := current.Get(key)
+		if (ok && !jsonEqual(v, c)) || (!ok && !isZeroJSON(v)) {
+			fmt.Fprintf(os.Stderr, "WARNING: %q is not saved to %s. Please update configuration files in %s manually\n", key, path, configDropInDir(configPath))
+		}
+	}
+
+	update.Content, err = json.MarshalIndent(fragment, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return update, nil
+}
+
+// jsonEqual returns true if a and b are equal in JSON, regardless of order of keys.
+func jsonEqual(a, b interface{}) bool {
+	var x, y interface{}
+	for _, v := range []struct {
+		src interface{}
+		dst *interface{}
+	}{{a, &x}, {b, &y}} {
+		j, err := json.Marshal(v.src)
+		if err != nil {
+			return false
+		}
+		if err := json.Unmarshal(j, v.dst); err != nil {
+			return false
+		}
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+func isZeroJSON(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case string:
+		return v == ""
+	case json.Number:
+		return v == "0"
+	case []interface{}:
+		return len(v) == 0
+	case *jsonObject:
+		return len(v.Keys()) == 0
+	}
+	return false
+}
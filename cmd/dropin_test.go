@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/soracom/soratun"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_configDropIns(t *testing.T) {
+	originalConfigPath := configPath
+	t.Cleanup(func() { configPath = originalConfigPath })
+
+	dir := t.TempDir()
+	configPath = filepath.Join(dir, "arc.json")
+	dropInDir := configPath + ".d"
+	assert.NoError(t, os.Mkdir(dropInDir, 0700))
+
+	base := `{
+  "configVersion": 1,
+  "logLevel": 2,
+  "interface": "soratun0",
+  "postUp": [["/bin/echo", "base"]],
+  "additionalAllowedIPs": ["10.0.0.0/8"]
+}`
+	assert.NoError(t, os.WriteFile(configPath, []byte(base), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dropInDir, "20-hooks.json"), []byte(`{
+  "postUp+": [["/bin/echo", "appended"]],
+  "additionalAllowedIPs": ["172.16.0.0/12"]
+}`), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dropInDir, "10-mtu.json"), []byte(`{"mtu": 1380, "interface": "arc0"}`), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dropInDir, "README"), []byte(`not a fragment`), 0600))
+
+	config, err := readConfig(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "arc0", config.Interface)
+	assert.Equal(t, 1380, config.Mtu)
+	assert.Equal(t, [][]string{{"/bin/echo", "base"}, {"/bin/echo", "appended"}}, config.PostUp)
+	if assert.Len(t, config.AdditionalAllowedIPs, 1) {
+		assert.Equal(t, "172.16.0.0/12", (*net.IPNet)(config.AdditionalAllowedIPs[0]).String())
+	}
+
+	// only the session is written to the session fragment
+	privateKey, publicKey, err := soratun.GenerateKeyPair()
+	assert.NoError(t, err)
+	config.PrivateKey, config.PublicKey, config.SimId = privateKey, publicKey, "8942310022000000000"
+	assert.NoError(t, saveConfig(config))
+
+	b, err := os.ReadFile(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, base, string(b))
+
+	b, err = os.ReadFile(filepath.Join(dropInDir, sessionFragmentName))
+	assert.NoError(t, err)
+	var fragment map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &fragment))
+	assert.Equal(t, map[string]interface{}{
+		"privateKey": privateKey.String(),
+		"publicKey":  publicKey.String(),
+		"simId":      "8942310022000000000",
+	}, fragment)
+
+	config, err = readConfig(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, privateKey, config.PrivateKey)
+	assert.Equal(t, "arc0", config.Interface)
+}
+
+func Test_mergeJSONObject_invalidAppend(t *testing.T) {
+	dst, err := parseJSONObject([]byte(`{"mtu": 1420}`))
+	assert.NoError(t, err)
+	src, err := parseJSONObject([]byte(`{"mtu+": [1]}`))
+	assert.NoError(t, err)
+	assert.EqualError(t, mergeJSONObject(dst, src), "mtu+: can not append to non-list value")
+}
@@ -1,77 +1,409 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net"
 	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/spf13/cobra"
 )
 
+var (
+	wireGuardConfigFormat    string
+	hidePrivateKey           bool
+	wireGuardConfigOutputDir string
+)
+
+// wireGuardConfigFormats are renderers for "--format" flag of wg-config command.
+var wireGuardConfigFormats = map[string]func(e *wireGuardExport) []wireGuardConfigFile{
+	"wg-quick":       wgQuickConfig,
+	"networkd":       networkdConfig,
+	"networkmanager": networkManagerConfig,
+	"json":           jsonWireGuardConfig,
+	"kubernetes":     kubernetesSecretConfig,
+}
+
 func dumpWireGuardConfigCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:    "wg-config",
-		Short:  "Dump soratun configuration file as WireGuard format",
+	cmd := &cobra.Command{
+		Use:   "wg-config",
+		Short: "Dump soratun configuration file as WireGuard format",
+		Long: `Dump soratun configuration file as WireGuard format, so that the tunnel can be managed without soratun. Available formats are:
+
+  wg-quick        wg-quick(8) configuration file
+  networkd        systemd-networkd .netdev and .network files
+  networkmanager  NetworkManager keyfile (.nmconnection)
+  json            JSON
+  kubernetes      Kubernetes Secret manifest which holds wg-quick configuration file`,
 		Args:   cobra.NoArgs,
 		PreRun: initSoratun,
 		Run: func(cmd *cobra.Command, args []string) {
-			dumpWireGuardConfig(false, os.Stdout)
+			render, ok := wireGuardConfigFormats[wireGuardConfigFormat]
+			if !ok {
+				log.Fatalf("Unknown format %q, should be one of %s", wireGuardConfigFormat, strings.Join(wireGuardConfigFormatNames(), ", "))
+			}
+			if Config.ArcSession == nil {
+				log.Fatal("Failed to determine connection information. Please bootstrap or create a new session from the user console.")
+			}
+
+			e := newWireGuardExport(hidePrivateKey)
+			files := render(e)
+			for _, w := range e.Warnings {
+				fmt.Fprintf(os.Stderr, "WARNING: %s\n", w)
+			}
+
+			if wireGuardConfigOutputDir == "" {
+				writeWireGuardConfigFiles(files, os.Stdout)
+				return
+			}
+
+			for _, f := range files {
+				path := filepath.Join(wireGuardConfigOutputDir, f.Name)
+				if err := writeWireGuardConfigFile(path, f); err != nil {
+					log.Fatalf("Failed to write %s: %v", path, err)
+				}
+				fmt.Printf("Created %s\n", path)
+			}
 		},
 	}
+
+	cmd.Flags().StringVar(&wireGuardConfigFormat, "format", "wg-quick", fmt.Sprintf("Output format, one of %s", strings.Join(wireGuardConfigFormatNames(), ", ")))
+	cmd.Flags().BoolVar(&hidePrivateKey, "hide-private-key", false, "Replace the private key with \"(hidden)\"")
+	cmd.Flags().StringVar(&wireGuardConfigOutputDir, "output-dir", "", "Write files to the directory, e.g. /etc/systemd/network, instead of stdout")
+
+	return cmd
 }
 
-func dumpWireGuardConfig(mask bool, w io.Writer) {
-	var ips []string
-	for _, ip := range Config.ArcSession.ArcAllowedIPs {
-		ips = append(ips, (*net.IPNet)(ip).String())
+func wireGuardConfigFormatNames() []string {
+	var names []string
+	for name := range wireGuardConfigFormats {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
+}
+
+// wireGuardExport holds WireGuard configuration to be exported, which is converted from the soratun configuration.
+type wireGuardExport struct {
+	Interface wireGuardExportInterface `json:"interface"`
+	Peer      wireGuardExportPeer      `json:"peer"`
+	// Warnings are settings which can not be exported to some formats.
+	Warnings []string `json:"-"`
+}
+
+type wireGuardExportInterface struct {
+	Name       string   `json:"name"`
+	PrivateKey string   `json:"privateKey"`
+	Address    string   `json:"address"`
+	MTU        int      `json:"mtu"`
+	PostUp     []string `json:"postUp,omitempty"`
+	PostDown   []string `json:"postDown,omitempty"`
+}
+
+type wireGuardExportPeer struct {
+	PublicKey           string   `json:"publicKey"`
+	Endpoint            string   `json:"endpoint"`
+	AllowedIPs          []string `json:"allowedIPs"`
+	PersistentKeepalive int      `json:"persistentKeepalive"`
+}
+
+// hiddenPrivateKey replaces the private key with "--hide-private-key" flag.
+const hiddenPrivateKey = "(hidden)"
+
+// wireGuardConfigFile is a file to be exported.
+type wireGuardConfigFile struct {
+	Name    string
+	Content string
+	// Group is a group which should be able to read the file, e.g. a group of the daemon which loads it.
+	Group string
+}
 
-	privateKey := (Config.PrivateKey).String()
+func newWireGuardExport(mask bool) *wireGuardExport {
+	e := &wireGuardExport{
+		Interface: wireGuardExportInterface{
+			Name:       Config.Interface,
+			PrivateKey: Config.PrivateKey.String(),
+			Address:    fmt.Sprintf("%s/32", Config.ArcSession.ArcClientPeerIpAddress),
+			MTU:        Config.Mtu,
+		},
+		Peer: wireGuardExportPeer{
+			PublicKey:           Config.ArcSession.ArcServerPeerPublicKey.String(),
+			Endpoint:            fmt.Sprintf("%s:%d", Config.ArcSession.ArcServerEndpoint.IP, Config.ArcSession.ArcServerEndpoint.Port),
+			PersistentKeepalive: max(Config.PersistentKeepalive, 0),
+		},
+	}
 	if mask {
-		privateKey = "(hidden)"
+		e.Interface.PrivateKey = hiddenPrivateKey
 	}
 
-	postUp := ""
-	postDown := ""
-	if len(Config.PostUp) > 0 {
-		for _, com := range Config.PostUp {
-			if len(com) == 0 || com[0] == "" {
-				continue
-			}
-			postUp = fmt.Sprintf("%sPostUp = %s\n", postUp, strings.Join(com, " "))
+	for _, ip := range Config.AllowedIPs() {
+		e.Peer.AllowedIPs = append(e.Peer.AllowedIPs, (*net.IPNet)(ip).String())
+	}
+
+	for _, com := range Config.PostUp {
+		if len(com) == 0 || com[0] == "" {
+			continue
 		}
+		e.Interface.PostUp = append(e.Interface.PostUp, wireGuardHook(com))
 	}
-	if len(Config.PostDown) > 0 {
-		for _, com := range Config.PostDown {
-			if len(com) == 0 || com[0] == "" {
-				continue
+	for _, com := range Config.PostDown {
+		if len(com) == 0 || com[0] == "" {
+			continue
+		}
+		e.Interface.PostDown = append(e.Interface.PostDown, wireGuardHook(com))
+	}
+
+	return e
+}
+
+func dumpWireGuardConfig(mask bool, w io.Writer) {
+	writeWireGuardConfigFiles(wgQuickConfig(newWireGuardExport(mask)), w)
+}
+
+// writeWireGuardConfigFile writes f to path with permission 0600, or 0640 with f.Group, since the file holds the
+// private key.
+func writeWireGuardConfigFile(path string, f wireGuardConfigFile) error {
+	if err := os.WriteFile(path, []byte(f.Content), 0600); err != nil {
+		return err
+	}
+	// os.WriteFile keeps permission of an existing file
+	if err := os.Chmod(path, 0600); err != nil {
+		return err
+	}
+	if f.Group == "" {
+		return nil
+	}
+
+	g, err := user.LookupGroup(f.Group)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: %s is readable only by the owner, since group %s is not found: %v\n", path, f.Group, err)
+		return nil
+	}
+	gid, err := strconv.Atoi(g.Gid)
+	if err != nil {
+		return err
+	}
+	if err := os.Chown(path, -1, gid); err != nil {
+		return err
+	}
+	return os.Chmod(path, 0640)
+}
+
+// writeWireGuardConfigFiles writes files to w. If there are multiple files, each file is preceded by a comment line
+// with its name.
+func writeWireGuardConfigFiles(files []wireGuardConfigFile, w io.Writer) {
+	for i, f := range files {
+		if len(files) > 1 {
+			if i > 0 {
+				fmt.Fprintln(w)
 			}
-			postDown = fmt.Sprintf("%sPostDown = %s\n", postDown, strings.Join(com, " "))
+			fmt.Fprintf(w, "# %s\n", f.Name)
 		}
+		fmt.Fprint(w, f.Content)
 	}
+}
 
-	fmt.Fprintf(w, `[Interface]
-Address = %s/32
+func wgQuickConfig(e *wireGuardExport) []wireGuardConfigFile {
+	var hooks strings.Builder
+	for _, com := range e.Interface.PostUp {
+		fmt.Fprintf(&hooks, "PostUp = %s\n", com)
+	}
+	for _, com := range e.Interface.PostDown {
+		fmt.Fprintf(&hooks, "PostDown = %s\n", com)
+	}
+
+	return []wireGuardConfigFile{{
+		Name: e.Interface.Name + ".conf",
+		Content: fmt.Sprintf(`[Interface]
+Address = %s
 PrivateKey = %s
 MTU = %d
-%s%s
+%s
 [Peer]
 PublicKey = %s
 AllowedIPs = %s
-Endpoint = %s:%d
+Endpoint = %s
 PersistentKeepalive = %d
 `,
-		Config.ArcSession.ArcClientPeerIpAddress,
-		privateKey,
-		Config.Mtu,
-		postUp,
-		postDown,
-		Config.ArcSession.ArcServerPeerPublicKey,
-		strings.Join(ips, ", "),
-		Config.ArcSession.ArcServerEndpoint.IP,
-		Config.ArcSession.ArcServerEndpoint.Port,
-		Config.PersistentKeepalive,
-	)
+			e.Interface.Address,
+			e.Interface.PrivateKey,
+			e.Interface.MTU,
+			hooks.String(),
+			e.Peer.PublicKey,
+			strings.Join(e.Peer.AllowedIPs, ", "),
+			e.Peer.Endpoint,
+			e.Peer.PersistentKeepalive,
+		),
+	}}
+}
+
+func networkdConfig(e *wireGuardExport) []wireGuardConfigFile {
+	warnHooksNotSupported(e, "systemd-networkd")
+	warnPrivateKeyHidden(e, "systemd-networkd")
+
+	var routes strings.Builder
+	for _, ip := range e.Peer.AllowedIPs {
+		fmt.Fprintf(&routes, "\n[Route]\nDestination = %s\n", ip)
+	}
+
+	return []wireGuardConfigFile{
+		{
+			Name: e.Interface.Name + ".netdev",
+			// systemd-networkd runs as systemd-network user, and reads the private key as a member of the group
+			Group: "systemd-network",
+			Content: fmt.Sprintf(`[NetDev]
+Name = %s
+Kind = wireguard
+MTUBytes = %d
+
+[WireGuard]
+PrivateKey = %s
+
+[WireGuardPeer]
+PublicKey = %s
+AllowedIPs = %s
+Endpoint = %s
+PersistentKeepalive = %d
+`,
+				e.Interface.Name,
+				e.Interface.MTU,
+				e.Interface.PrivateKey,
+				e.Peer.PublicKey,
+				strings.Join(e.Peer.AllowedIPs, ", "),
+				e.Peer.Endpoint,
+				e.Peer.PersistentKeepalive,
+			),
+		},
+		{
+			Name: e.Interface.Name + ".network",
+			Content: fmt.Sprintf(`[Match]
+Name = %s
+
+[Network]
+Address = %s
+%s`,
+				e.Interface.Name,
+				e.Interface.Address,
+				routes.String(),
+			),
+		},
+	}
+}
+
+func networkManagerConfig(e *wireGuardExport) []wireGuardConfigFile {
+	warnHooksNotSupported(e, "NetworkManager")
+	warnPrivateKeyHidden(e, "NetworkManager")
+
+	// routes for allowed IPs are added by NetworkManager, as "peer-routes" is enabled by default
+	return []wireGuardConfigFile{{
+		Name: e.Interface.Name + ".nmconnection",
+		Content: fmt.Sprintf(`[connection]
+id=%s
+type=wireguard
+interface-name=%s
+
+[wireguard]
+private-key=%s
+mtu=%d
+
+[wireguard-peer.%s]
+endpoint=%s
+allowed-ips=%s;
+persistent-keepalive=%d
+
+[ipv4]
+method=manual
+address1=%s
+
+[ipv6]
+method=disabled
+`,
+			e.Interface.Name,
+			e.Interface.Name,
+			e.Interface.PrivateKey,
+			e.Interface.MTU,
+			e.Peer.PublicKey,
+			e.Peer.Endpoint,
+			strings.Join(e.Peer.AllowedIPs, ";"),
+			e.Peer.PersistentKeepalive,
+			e.Interface.Address,
+		),
+	}}
+}
+
+func jsonWireGuardConfig(e *wireGuardExport) []wireGuardConfigFile {
+	b, _ := json.MarshalIndent(e, "", "  ")
+	return []wireGuardConfigFile{{
+		Name:    e.Interface.Name + ".json",
+		Content: string(b) + "\n",
+	}}
+}
+
+func kubernetesSecretConfig(e *wireGuardExport) []wireGuardConfigFile {
+	conf := wgQuickConfig(e)[0]
+
+	var data strings.Builder
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(conf.Content, "\n"), "\n") {
+		if line == "\n" {
+			data.WriteString(line)
+		} else {
+			data.WriteString("    " + line)
+		}
+	}
+
+	return []wireGuardConfigFile{{
+		Name: e.Interface.Name + "-secret.yaml",
+		Content: fmt.Sprintf(`apiVersion: v1
+kind: Secret
+metadata:
+  name: %s
+type: Opaque
+stringData:
+  %s: |
+%s
+`,
+			e.Interface.Name,
+			conf.Name,
+			data.String(),
+		),
+	}}
+}
+
+func warnHooksNotSupported(e *wireGuardExport, format string) {
+	if len(e.Interface.PostUp) > 0 || len(e.Interface.PostDown) > 0 {
+		e.Warnings = append(e.Warnings, fmt.Sprintf("PostUp and PostDown are not supported by %s, and will not be exported", format))
+	}
+}
+
+func warnPrivateKeyHidden(e *wireGuardExport, format string) {
+	if e.Interface.PrivateKey == hiddenPrivateKey {
+		e.Warnings = append(e.Warnings, fmt.Sprintf("the private key is hidden, and %s can not load the files until it is filled in", format))
+	}
+}
+
+// wireGuardHook converts a command of PostUp or PostDown into wg-quick format, which is run by bash.
+func wireGuardHook(com []string) string {
+	if len(com) == 3 && com[0] == "/bin/sh" && com[1] == "-c" {
+		return com[2]
+	}
+	args := make([]string, len(com))
+	for i, arg := range com {
+		args[i] = shellQuote(arg)
+	}
+	return strings.Join(args, " ")
+}
+
+// shellQuote quotes s with single quotes for bash, unless s has only characters which are never interpreted by bash.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_@%+=:,./-") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
 }
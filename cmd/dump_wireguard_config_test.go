@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/soracom/soratun"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_wireGuardConfigFormats(t *testing.T) {
+	originalConfig := Config
+	t.Cleanup(func() { Config = originalConfig })
+
+	privateKey, _, err := soratun.GenerateKeyPair()
+	assert.NoError(t, err)
+	_, serverKey, err := soratun.GenerateKeyPair()
+	assert.NoError(t, err)
+
+	Config = &soratun.Config{
+		PrivateKey:          privateKey,
+		Interface:           "soratun0",
+		Mtu:                 1420,
+		PersistentKeepalive: 60,
+		PostUp:              [][]string{{"/bin/sh", "-c", "echo up | logger"}},
+		ArcSession: &soratun.ArcSession{
+			ArcServerPeerPublicKey: serverKey,
+			ArcServerEndpoint:      &soratun.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 11010},
+			ArcAllowedIPs:          []*soratun.IPNet{{IP: net.IPv4(100, 127, 0, 0), Mask: net.IPv4Mask(255, 255, 0, 0)}},
+			ArcClientPeerIpAddress: net.IPv4(10, 0, 0, 1),
+		},
+	}
+
+	var b bytes.Buffer
+	dumpWireGuardConfig(true, &b)
+	assert.Contains(t, b.String(), "PrivateKey = (hidden)\n")
+	assert.Contains(t, b.String(), "PostUp = echo up | logger\n")
+	assert.NotContains(t, b.String(), privateKey.String())
+
+	e := newWireGuardExport(false)
+	files := networkdConfig(e)
+	if assert.Len(t, files, 2) {
+		assert.Equal(t, "soratun0.netdev", files[0].Name)
+		assert.Contains(t, files[0].Content, "PrivateKey = "+privateKey.String()+"\n")
+		assert.Equal(t, "soratun0.network", files[1].Name)
+		assert.Contains(t, files[1].Content, "[Route]\nDestination = 100.127.0.0/16\n")
+	}
+	assert.Len(t, e.Warnings, 1)
+
+	e = newWireGuardExport(true)
+	networkManagerConfig(e)
+	if assert.Len(t, e.Warnings, 2) {
+		assert.Equal(t, "the private key is hidden, and NetworkManager can not load the files until it is filled in", e.Warnings[1])
+	}
+
+	files = kubernetesSecretConfig(newWireGuardExport(false))
+	if assert.Len(t, files, 1) {
+		assert.Contains(t, files[0].Content, "stringData:\n  soratun0.conf: |\n    [Interface]\n")
+		assert.Contains(t, files[0].Content, "\n    Endpoint = 192.0.2.1:11010\n")
+	}
+}
+
+func Test_writeWireGuardConfigFile(t *testing.T) {
+	g, err := user.LookupGroupId(strconv.Itoa(os.Getgid()))
+	if err != nil {
+		t.Skipf("failed to look up the group: %v", err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "soratun0.netdev")
+	assert.NoError(t, os.WriteFile(path, nil, 0644))
+	assert.NoError(t, writeWireGuardConfigFile(path, wireGuardConfigFile{Content: "[NetDev]\n", Group: g.Name}))
+	info, err := os.Stat(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	}
+
+	path = filepath.Join(dir, "soratun0.network")
+	assert.NoError(t, writeWireGuardConfigFile(path, wireGuardConfigFile{Content: "[Match]\n", Group: "soratun-no-such-group"}))
+	info, err = os.Stat(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+}
+
+func Test_wireGuardHook(t *testing.T) {
+	assert.Equal(t, "/bin/echo up %i", wireGuardHook([]string{"/bin/echo", "up", "%i"}))
+	assert.Equal(t, `logger -t soratun 'tunnel is up' '' 'it'\''s $HOME'`, wireGuardHook([]string{"logger", "-t", "soratun", "tunnel is up", "", "it's $HOME"}))
+	assert.Equal(t, "ip route del 192.0.2.0/24 dev %i || true", wireGuardHook([]string{"/bin/sh", "-c", "ip route del 192.0.2.0/24 dev %i || true"}))
+
+	// the shell gets the same arguments
+	args := []string{"a b", "", "it's", `"$HOME"`, "*", "`id`", "\\n"}
+	out, err := exec.Command("/bin/sh", "-c", wireGuardHook(append([]string{"printf", `%s\n`}, args...))).Output()
+	if assert.NoError(t, err) {
+		assert.Equal(t, strings.Join(args, "\n")+"\n", string(out))
+	}
+
+	// import-wg and wg-config round-trip
+	for _, hook := range []string{"/bin/echo up %i", "ip route del 192.0.2.0/24 dev %i || true", "logger 'tunnel is up'"} {
+		assert.Equal(t, hook, wireGuardHook(hookCommandForTest(t, hook)))
+	}
+}
+
+// hookCommandForTest returns PostUp command imported with "soratun config import-wg".
+func hookCommandForTest(t *testing.T, hook string) []string {
+	conf := `[Interface]
+PrivateKey = 8K4cUrwYpyE3jYeKyFvX3r3Ty+rOSYRKBr7QdGCBY1w=
+Address = 10.123.45.67/32
+PostUp = ` + hook + `
+
+[Peer]
+PublicKey = 5dTfnbPQrKRJhHBhazqHIzVKxA6Ga89rWWvdXnr0OCA=
+Endpoint = 192.0.2.1:11010
+`
+	config, _, err := soratun.ParseWireGuardConfig([]byte(conf))
+	if !assert.NoError(t, err) || !assert.Len(t, config.PostUp, 1) {
+		return nil
+	}
+	return config.PostUp[0]
+}
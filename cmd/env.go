@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/soracom/soratun"
+)
+
+// envPrefix is the prefix of environment variables which override configuration fields.
+const envPrefix = "SORATUN_"
+
+// envOverride is a configuration field which can be overridden with an environment variable.
+type envOverride struct {
+	// Name is the name of the environment variable, e.g. SORATUN_ADDITIONAL_ALLOWED_IPS.
+	Name string
+	// Path is the path to the field in the configuration, e.g. ["profile", "endpoint"].
+	Path []string
+	typ  reflect.Type
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// envOverrides returns all configuration fields which can be overridden with environment variables. The name of the
+// variable is SORATUN_ followed by the path to the field in upper snake case, e.g. SORATUN_MTU for "mtu" and
+// SORATUN_PROFILE_AUTH_KEY for "profile.authKey".
+func envOverrides() []envOverride {
+	return collectEnvOverrides(reflect.TypeOf(soratun.Config{}), nil)
+}
+
+func collectEnvOverrides(t reflect.Type, parent []string) []envOverride {
+	var overrides []envOverride
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || f.Type.Kind() == reflect.Func {
+			continue
+		}
+
+		path := append(append([]string(nil), parent...), name)
+		if st, ok := configStructType(f.Type); ok {
+			overrides = append(overrides, collectEnvOverrides(st, path)...)
+			continue
+		}
+
+		var parts []string
+		for _, p := range path {
+			parts = append(parts, upperSnakeCase(p))
+		}
+		overrides = append(overrides, envOverride{Name: envPrefix + strings.Join(parts, "_"), Path: path, typ: f.Type})
+	}
+	return overrides
+}
+
+// upperSnakeCase converts camelCase into UPPER_SNAKE_CASE, e.g. "additionalAllowedIPs" into "ADDITIONAL_ALLOWED_IPS".
+func upperSnakeCase(s string) string {
+	var b strings.Builder
+	var prev rune
+	for i, r := range s {
+		if i > 0 && unicode.IsUpper(r) && (unicode.IsLower(prev) || unicode.IsDigit(prev)) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+		prev = r
+	}
+	return b.String()
+}
+
+// applyEnvOverrides overrides fields in tree with environment variables. See envOverrides.
+func applyEnvOverrides(tree *jsonObject) error {
+	for _, o := range envOverrides() {
+		s, ok := os.LookupEnv(o.Name)
+		if !ok {
+			continue
+		}
+
+		v, err := o.value(s)
+		if err != nil {
+			return fmt.Errorf("invalid value of %s: %w", o.Name, err)
+		}
+		tree.setPath(o.Path, v)
+	}
+	return nil
+}
+
+// value converts s into a JSON value for the field. Lists are comma-separated, and maps are comma-separated
+// "key=value" pairs. Lists and maps can also be in JSON.
+func (o *envOverride) value(s string) (interface{}, error) {
+	t := o.typ
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) || t.Implements(textUnmarshalerType) {
+		return s, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return s, nil
+	case reflect.Int:
+		if _, err := strconv.Atoi(s); err != nil {
+			return nil, err
+		}
+		return json.Number(s), nil
+	case reflect.Bool:
+		return strconv.ParseBool(s)
+	case reflect.Slice:
+		if strings.HasPrefix(strings.TrimSpace(s), "[") {
+			return parseJSONEnv(s)
+		}
+		if t.Elem().Kind() == reflect.Slice {
+			return nil, fmt.Errorf("should be JSON array, e.g. [[\"/bin/echo\", \"%%i\"]]")
+		}
+		var list []interface{}
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list, nil
+	case reflect.Map:
+		if strings.HasPrefix(strings.TrimSpace(s), "{") {
+			return parseJSONEnv(s)
+		}
+		obj := newJSONObject()
+		for _, pair := range strings.Split(s, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("%q should be in the form of \"key=value\"", pair)
+			}
+			obj.Set(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+		}
+		return obj, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+func parseJSONEnv(s string) (interface{}, error) {
+	tree, err := parseJSONObject([]byte(`{"v":` + s + `}`))
+	if err != nil {
+		return nil, err
+	}
+	v, _ := tree.Get("v")
+	return v, nil
+}
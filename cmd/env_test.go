@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/soracom/soratun"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_upperSnakeCase(t *testing.T) {
+	assert.Equal(t, "MTU", upperSnakeCase("mtu"))
+	assert.Equal(t, "ADDITIONAL_ALLOWED_IPS", upperSnakeCase("additionalAllowedIPs"))
+	assert.Equal(t, "ARC_CLIENT_PEER_IP_ADDRESS", upperSnakeCase("arcClientPeerIpAddress"))
+}
+
+func Test_envOverrides(t *testing.T) {
+	names := map[string]bool{}
+	for _, o := range envOverrides() {
+		names[o.Name] = true
+	}
+	assert.True(t, names["SORATUN_INTERFACE"])
+	assert.True(t, names["SORATUN_LOG_LEVEL"])
+	assert.True(t, names["SORATUN_PROFILE_AUTH_KEY"])
+	assert.True(t, names["SORATUN_ARC_SESSION_ARC_SERVER_ENDPOINT"])
+	assert.False(t, names["SORATUN_PROFILE_MFA_CODE_PROVIDER"])
+}
+
+func Test_parseEffectiveConfig(t *testing.T) {
+	conf := `{
+  "privateKey": "8K4cUrwYpyE3jYeKyFvX3r3Ty+rOSYRKBr7QdGCBY1w=",
+  "logLevel": 2,
+  "interface": "soratun0",
+  "mtu": 1420
+}`
+
+	t.Setenv("SORATUN_INTERFACE", "arc0")
+	t.Setenv("SORATUN_MTU", "1380")
+	t.Setenv("SORATUN_LOG_LEVEL", "0")
+	t.Setenv("SORATUN_ADDITIONAL_ALLOWED_IPS", "10.0.0.0/8, 172.16.0.0/12")
+	t.Setenv("SORATUN_POST_UP", `[["/bin/echo", "%i"]]`)
+	t.Setenv("SORATUN_PROFILE_ENDPOINT", "https://api.soracom.io")
+
+	config, err := parseEffectiveConfig([]byte(conf))
+	assert.NoError(t, err)
+	assert.Equal(t, "arc0", config.Interface)
+	assert.Equal(t, 1380, config.Mtu)
+	assert.Equal(t, 0, config.LogLevel)
+	assert.Equal(t, []*soratun.IPNet{
+		{IP: net.IPv4(10, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)},
+		{IP: net.IPv4(172, 16, 0, 0).To4(), Mask: net.CIDRMask(12, 32)},
+	}, config.AdditionalAllowedIPs)
+	assert.Equal(t, [][]string{{"/bin/echo", "%i"}}, config.PostUp)
+	assert.Equal(t, "https://api.soracom.io", config.Profile.Endpoint)
+	// default value is filled
+	assert.Equal(t, soratun.DefaultPersistentKeepaliveInterval, config.PersistentKeepalive)
+
+	// environment variables are not applied to the configuration to be written back
+	config, err = parseConfig([]byte(conf))
+	assert.NoError(t, err)
+	assert.Equal(t, "soratun0", config.Interface)
+
+	t.Setenv("SORATUN_MTU", "large")
+	_, err = parseEffectiveConfig([]byte(conf))
+	assert.Error(t, err)
+}
+
+func Test_newSoracomClientFromConfig_env(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/sims", r.URL.Path)
+		assert.Equal(t, "env-api-key", r.Header.Get("X-Soracom-API-Key"))
+		assert.Equal(t, "env-token", r.Header.Get("X-Soracom-Token"))
+		_, _ = w.Write([]byte(`[{"simId": "8942310022000000000", "type": "virtual", "status": "active"}]`))
+	}))
+	defer api.Close()
+
+	originalConfigPath := configPath
+	t.Cleanup(func() { configPath = originalConfigPath })
+	configPath = filepath.Join(t.TempDir(), "arc.json")
+	assert.NoError(t, os.WriteFile(configPath, []byte(`{"configVersion": 1, "simId": "8942310022000000000"}`), 0o600))
+
+	// credentials are given only with environment variables, like "soratun up"
+	t.Setenv("SORATUN_PROFILE_API_KEY", "env-api-key")
+	t.Setenv("SORATUN_PROFILE_TOKEN", "env-token")
+	t.Setenv("SORATUN_PROFILE_ENDPOINT", api.URL)
+
+	client, config := newSoracomClientFromConfig()
+	assert.Equal(t, "env-api-key", config.Profile.APIKey)
+
+	simType = "virtual"
+	defer func() { simType = "" }()
+	var out bytes.Buffer
+	assert.NoError(t, listSims(client, &out))
+	assert.Contains(t, out.String(), "8942310022000000000")
+}
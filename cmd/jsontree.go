@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// jsonObject is a JSON object which keeps order of keys, so that the configuration file can be rewritten in the same
+// order as it is read.
+type jsonObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newJSONObject() *jsonObject {
+	return &jsonObject{values: map[string]interface{}{}}
+}
+
+// Get returns the value for the key.
+func (o *jsonObject) Get(key string) (interface{}, bool) {
+	v, ok := o.values[key]
+	return v, ok
+}
+
+// Set sets the value for the key. A new key is appended to the end.
+func (o *jsonObject) Set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// Delete removes the key.
+func (o *jsonObject) Delete(key string) {
+	if _, ok := o.values[key]; !ok {
+		return
+	}
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// setFirst sets the value for the key, and moves the key to the beginning.
+func (o *jsonObject) setFirst(key string, value interface{}) {
+	o.Delete(key)
+	o.keys = append([]string{key}, o.keys...)
+	o.values[key] = value
+}
+
+// rename renames the key, keeping its position.
+func (o *jsonObject) rename(key, newKey string) {
+	v, ok := o.values[key]
+	if !ok {
+		return
+	}
+	o.Delete(newKey)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys[i] = newKey
+		}
+	}
+	delete(o.values, key)
+	o.values[newKey] = v
+}
+
+// Keys returns keys in order.
+func (o *jsonObject) Keys() []string {
+	return append([]string(nil), o.keys...)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (o *jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(o.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// lookup returns the value at the path of nested objects.
+func (o *jsonObject) lookup(path []string) (interface{}, bool) {
+	var v interface{} = o
+	for _, key := range path {
+		obj, ok := v.(*jsonObject)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = obj.Get(key); !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// replace sets the value at the path of nested objects, only if the path already exists.
+func (o *jsonObject) replace(path []string, value interface{}) bool {
+	parent, ok := o.lookup(path[:len(path)-1])
+	if !ok {
+		return false
+	}
+	obj, ok := parent.(*jsonObject)
+	if !ok {
+		return false
+	}
+	if _, ok := obj.Get(path[len(path)-1]); !ok {
+		return false
+	}
+	obj.Set(path[len(path)-1], value)
+	return true
+}
+
+// setPath sets the value at the path of nested objects, creating objects on the way if needed.
+func (o *jsonObject) setPath(path []string, value interface{}) {
+	obj := o
+	for _, key := range path[:len(path)-1] {
+		v, ok := obj.Get(key)
+		child, isObject := v.(*jsonObject)
+		if !ok || !isObject {
+			child = newJSONObject()
+			obj.Set(key, child)
+		}
+		obj = child
+	}
+	obj.Set(path[len(path)-1], value)
+}
+
+// parseJSONObject parses JSON object. Nested objects are *jsonObject, arrays are []interface{}, and numbers are
+// json.Number.
+func parseJSONObject(b []byte) (*jsonObject, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+
+	v, err := parseJSONValue(d)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := d.Token(); err == nil {
+		return nil, errors.New("invalid character after top-level value")
+	}
+
+	obj, ok := v.(*jsonObject)
+	if !ok {
+		return nil, errors.New("configuration should be a JSON object")
+	}
+	return obj, nil
+}
+
+func parseJSONValue(d *json.Decoder) (interface{}, error) {
+	t, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t {
+	case json.Delim('{'):
+		obj := newJSONObject()
+		for d.More() {
+			t, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := t.(string)
+			if !ok {
+				return nil, fmt.Errorf("unexpected object key %v", t)
+			}
+			v, err := parseJSONValue(d)
+			if err != nil {
+				return nil, err
+			}
+			obj.Set(key, v)
+		}
+		if _, err := d.Token(); err != nil {
+			return nil, err
+		}
+		return obj, nil
+	case json.Delim('['):
+		arr := []interface{}{}
+		for d.More() {
+			v, err := parseJSONValue(d)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		if _, err := d.Token(); err != nil {
+			return nil, err
+		}
+		return arr, nil
+	default:
+		return t, nil
+	}
+}
@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/soracom/soratun"
+)
+
+// configMigrations upgrade configuration, in the order of versions. configMigrations[n] upgrades configuration from
+// version n to n+1, so len(configMigrations) should be soratun.CurrentConfigVersion.
+var configMigrations = []func(tree *jsonObject, warn func(format string, a ...interface{})){
+	migrateConfigToV1,
+}
+
+// configVersion returns the version of configuration in tree, which is 0 if not specified.
+func configVersion(tree *jsonObject) (int, error) {
+	v, ok := tree.Get("configVersion")
+	if !ok {
+		return 0, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("configVersion should be an integer, but got %v", v)
+	}
+	version, err := strconv.Atoi(n.String())
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("configVersion should be a non-negative integer, but got %v", v)
+	}
+	return version, nil
+}
+
+// migrateConfig upgrades tree to soratun.CurrentConfigVersion, and returns true if tree is upgraded. Configuration
+// newer than soratun.CurrentConfigVersion is an error.
+func migrateConfig(tree *jsonObject, warn func(format string, a ...interface{})) (bool, error) {
+	version, err := configVersion(tree)
+	if err != nil {
+		return false, err
+	}
+	if version > soratun.CurrentConfigVersion {
+		return false, fmt.Errorf("configVersion %d is newer than the version this soratun supports (%d). Please upgrade soratun", version, soratun.CurrentConfigVersion)
+	}
+	if version == soratun.CurrentConfigVersion {
+		return false, nil
+	}
+
+	for _, migrate := range configMigrations[version:] {
+		migrate(tree, warn)
+	}
+	tree.setFirst("configVersion", json.Number(strconv.Itoa(soratun.CurrentConfigVersion)))
+	return true, nil
+}
+
+// migrateConfigToV1 upgrades configuration written by soratun before configVersion was introduced.
+func migrateConfigToV1(tree *jsonObject, warn func(format string, a ...interface{})) {
+	for _, key := range tree.Keys() {
+		if strings.EqualFold(key, "arcSessionStatus") {
+			tree.rename(key, "arcSession")
+		}
+	}
+
+	// field names were case-insensitive
+	normalizeConfigKeys(tree, reflect.TypeOf(soratun.Config{}), "", warn)
+
+	if v, ok := tree.Get("imsi"); ok {
+		warn("legacy field \"imsi\" (%v) is removed, virtual SIM is identified with \"simId\"", v)
+		tree.Delete("imsi")
+	}
+
+	// private key was also stored in Arc session, though it was never written back
+	if session, ok := tree.values["arcSession"].(*jsonObject); ok {
+		if key, ok := session.Get("arcClientPeerPrivateKey"); ok {
+			privateKey, ok := tree.Get("privateKey")
+			if !ok || privateKey == "" {
+				tree.Set("privateKey", key)
+			} else if !jsonEqual(privateKey, key) {
+				warn("legacy field \"arcSession.arcClientPeerPrivateKey\" differs from \"privateKey\", and is removed")
+			}
+			session.Delete("arcClientPeerPrivateKey")
+		}
+	}
+}
+
+// normalizeConfigKeys renames keys in tree, which correspond to fields of struct t, into the names in JSON tags.
+func normalizeConfigKeys(tree *jsonObject, t reflect.Type, path string, warn func(format string, a ...interface{})) {
+	fields := configStructFields(t)
+	names := map[string]string{}
+	for name := range fields {
+		names[strings.ToLower(name)] = name
+	}
+
+	for _, key := range tree.Keys() {
+		name, ok := names[strings.ToLower(key)]
+		if !ok {
+			continue
+		}
+		if name != key {
+			if _, exists := tree.Get(name); exists {
+				warn("%q is removed in favor of %q", joinConfigPath(path, key), joinConfigPath(path, name))
+				tree.Delete(key)
+				continue
+			}
+			tree.rename(key, name)
+		}
+
+		if child, ok := tree.values[name].(*jsonObject); ok {
+			if st, ok := configStructType(fields[name]); ok {
+				normalizeConfigKeys(child, st, joinConfigPath(path, name), warn)
+			}
+		}
+	}
+}
+
+// unknownConfigFields returns paths of fields in tree which soratun does not know.
+func unknownConfigFields(tree *jsonObject) []string {
+	return collectUnknownConfigFields(tree, reflect.TypeOf(soratun.Config{}), "")
+}
+
+func collectUnknownConfigFields(tree *jsonObject, t reflect.Type, path string) []string {
+	fields := configStructFields(t)
+
+	var unknown []string
+	for _, key := range tree.Keys() {
+		ft, ok := fields[key]
+		if !ok {
+			unknown = append(unknown, joinConfigPath(path, key))
+			continue
+		}
+		if child, ok := tree.values[key].(*jsonObject); ok {
+			if st, ok := configStructType(ft); ok {
+				unknown = append(unknown, collectUnknownConfigFields(child, st, joinConfigPath(path, key))...)
+			}
+		}
+	}
+	return unknown
+}
+
+// configStructFields returns types of fields of struct t, keyed by names in JSON tags.
+func configStructFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || f.Type.Kind() == reflect.Func {
+			continue
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// configStructType returns the struct type if t is a pointer to a struct, which is an object with fields in the
+// configuration, rather than a value in text such as soratun.UDPAddr.
+func configStructType(t reflect.Type) (reflect.Type, bool) {
+	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct || t.Implements(textUnmarshalerType) {
+		return nil, false
+	}
+	return t.Elem(), true
+}
+
+func joinConfigPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// printedConfigWarnings holds warnings which have been printed, so that each warning is printed only once even if the
+// configuration is read more than once.
+var printedConfigWarnings = map[string]bool{}
+
+// configWarner returns a function which prints a warning about the configuration file at path to stderr.
+func configWarner(path string) func(format string, a ...interface{}) {
+	return func(format string, a ...interface{}) {
+		msg := fmt.Sprintf("WARNING: %s: %s", path, fmt.Sprintf(format, a...))
+		if printedConfigWarnings[msg] {
+			return
+		}
+		printedConfigWarnings[msg] = true
+		fmt.Fprintln(os.Stderr, msg)
+	}
+}
+
+// upgradeConfigTree migrates tree, which is read from the file at path, in memory. The file is never rewritten, and a
+// hint to upgrade it with "soratun config migrate" is warned if migratable is true.
+func upgradeConfigTree(path string, tree *jsonObject, migratable bool) error {
+	warn := configWarner(path)
+	version, _ := configVersion(tree)
+	migrated, err := migrateConfig(tree, warn)
+	if err != nil || !migrated {
+		return err
+	}
+	if migratable {
+		warn("configuration is in an old format (version %d). Run \"soratun config migrate\" to upgrade it to version %d", version, soratun.CurrentConfigVersion)
+	} else {
+		warn("configuration is in an old format (version %d). Please upgrade it to version %d", version, soratun.CurrentConfigVersion)
+	}
+	return nil
+}
+
+// migrateConfigFile migrates the file at path, and writes it back if upgraded. The original file is kept as
+// "<path>.v<version>.bak", instead of the usual backups. It returns true if the file is upgraded. Callers should hold
+// the lock with lockConfigurationFile.
+func migrateConfigFile(path string) (bool, error) {
+	original, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	tree, err := parseJSONObject(original)
+	if err != nil {
+		return false, fmt.Errorf("error while reading config file %s: %s", path, describeConfigError(original, err))
+	}
+
+	version, _ := configVersion(tree)
+	migrated, err := migrateConfig(tree, configWarner(path))
+	if err != nil || !migrated {
+		return false, err
+	}
+
+	b, err := json.MarshalIndent(tree, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	backup := fmt.Sprintf("%s.v%d.bak", path, version)
+	err = replaceConfigurationFile(path, string(b), func() error {
+		return os.WriteFile(backup, original, 0600)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to upgrade configuration file %s: %w", path, err)
+	}
+	fmt.Fprintf(os.Stderr, "Upgraded configuration file %s from version %d to %d. The original file is kept as %s\n", path, version, soratun.CurrentConfigVersion, backup)
+	return true, nil
+}
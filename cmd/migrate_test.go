@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/soracom/soratun"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_migrateConfigFile(t *testing.T) {
+	originalConfigPath := configPath
+	t.Cleanup(func() { configPath = originalConfigPath })
+
+	configPath = filepath.Join(t.TempDir(), "arc.json")
+
+	legacy := `{
+  "privateKey": "",
+  "publicKey": "hiTL1IsjrklEDfWjMP1Uw7/62YZ1TVxzk+mR1knQKAQ=",
+  "imsi": "999999XXXXXXXXX",
+  "SimId": "8942310022000000000",
+  "interface": "soratun0",
+  "futureField": true,
+  "arcSessionStatus": {
+    "ArcServerPeerPublicKey": "5dTfnbPQrKRJhHBhazqHIzVKxA6Ga89rWWvdXnr0OCA=",
+    "ArcServerEndpoint": "192.0.2.1:11010",
+    "ArcAllowedIPs": ["100.127.0.0/16"],
+    "ArcClientPeerIpAddress": "10.0.0.1",
+    "ArcClientPeerPrivateKey": "8K4cUrwYpyE3jYeKyFvX3r3Ty+rOSYRKBr7QdGCBY1w="
+  }
+}`
+	assert.NoError(t, os.WriteFile(configPath, []byte(legacy), 0600))
+
+	config, err := readConfig(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, soratun.CurrentConfigVersion, config.ConfigVersion)
+	assert.Equal(t, "8942310022000000000", config.SimId)
+	assert.Equal(t, "8K4cUrwYpyE3jYeKyFvX3r3Ty+rOSYRKBr7QdGCBY1w=", config.PrivateKey.String())
+	assert.Equal(t, "5dTfnbPQrKRJhHBhazqHIzVKxA6Ga89rWWvdXnr0OCA=", config.ArcSession.ArcServerPeerPublicKey.String())
+
+	// reading the configuration never rewrites the file
+	assert.Equal(t, legacy, string(readFile(t, configPath)))
+	assert.NoFileExists(t, configPath+".v0.bak")
+
+	upgraded, err := migrateConfigFile(configPath)
+	assert.NoError(t, err)
+	assert.True(t, upgraded)
+	assert.Equal(t, legacy, string(readFile(t, configPath+".v0.bak")))
+	assert.NoFileExists(t, configBackupPath(configPath, 1))
+
+	upgraded, err = migrateConfigFile(configPath)
+	assert.NoError(t, err)
+	assert.False(t, upgraded)
+
+	tree, err := parseJSONObject(readFile(t, configPath))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"configVersion", "privateKey", "publicKey", "simId", "interface", "futureField", "arcSession"}, tree.Keys())
+	session, _ := tree.Get("arcSession")
+	assert.Equal(t, []string{"arcServerPeerPublicKey", "arcServerEndpoint", "arcAllowedIPs", "arcClientPeerIpAddress"}, session.(*jsonObject).Keys())
+	assert.Equal(t, []string{"futureField"}, unknownConfigFields(tree))
+
+	// configuration in newer version can not be read
+	assert.NoError(t, os.WriteFile(configPath, []byte(`{"configVersion": 999}`), 0600))
+	_, err = readConfig(configPath)
+	assert.ErrorContains(t, err, "configVersion 999 is newer")
+}
+
+func readFile(t *testing.T, path string) []byte {
+	b, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	return b
+}
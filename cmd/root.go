@@ -16,6 +16,10 @@ var (
 	Config *soratun.Config
 	// configPath holds path to SORACOM Arc client configuration file.
 	configPath string
+	// configDir holds path to the drop-in directory for the configuration file.
+	configDir string
+	// configBackups holds number of backups of the configuration file to keep.
+	configBackups int
 	// ctx is a context object for internal use to prove (default: Background()).
 	ctx = context.Background()
 )
@@ -28,35 +32,29 @@ var RootCmd = &cobra.Command{
 
 func init() {
 	RootCmd.PersistentFlags().StringVar(&configPath, "config", "arc.json", "Specify path to SORACOM Arc client configuration file")
+	RootCmd.PersistentFlags().StringVar(&configDir, "config-dir", "", "Specify path to the directory of drop-in configuration files, which are merged into the configuration file in lexical order (default \"<config>.d\")")
+	RootCmd.PersistentFlags().IntVar(&configBackups, "config-backups", 3, "Number of backups to keep when updating the configuration file, as <config>.bak.1 to <config>.bak.N. 0 to disable")
 
 	RootCmd.AddCommand(bootstrapCmd())
 	RootCmd.AddCommand(completionCmd())
 	RootCmd.AddCommand(configCmd())
+	RootCmd.AddCommand(doctorCmd())
 	RootCmd.AddCommand(dumpWireGuardConfigCmd())
+	RootCmd.AddCommand(rotateKeysCmd())
+	RootCmd.AddCommand(serviceCmd())
+	RootCmd.AddCommand(simCmd())
 	RootCmd.AddCommand(statusCmd())
 	RootCmd.AddCommand(upCmd())
 	RootCmd.AddCommand(versionCmd())
 }
 
 func initSoratun(_ *cobra.Command, _ []string) {
-	config, err := readConfig(configPath)
+	config, err := readEffectiveConfig(configPath)
 	if err != nil {
 		log.Fatalf("Error: %s\n", err)
 	}
 	Config = config
 
-	if Config.Mtu == 0 {
-		Config.Mtu = soratun.DefaultMTU
-	}
-
-	if Config.PersistentKeepalive == 0 {
-		Config.PersistentKeepalive = soratun.DefaultPersistentKeepaliveInterval
-	}
-
-	if len(Config.AdditionalAllowedIPs) > 0 {
-		Config.ArcSession.ArcAllowedIPs = append(Config.ArcSession.ArcAllowedIPs, Config.AdditionalAllowedIPs...)
-	}
-
 	if os.Getenv("__SORACOM_NO_DYNAMIC_CLIENT_SETUP_FOR_TEST") != "" {
 		// NOTE:
 		// This is for WireGuard integration testing purpose. It would inject the mocked client statically.
@@ -65,16 +63,110 @@ func initSoratun(_ *cobra.Command, _ []string) {
 	}
 }
 
+// applyDefaults fills unset fields of config with default values.
+func applyDefaults(config *soratun.Config) {
+	if config.Mtu == 0 {
+		config.Mtu = soratun.DefaultMTU
+	}
+
+	if config.PersistentKeepalive == 0 {
+		config.PersistentKeepalive = soratun.DefaultPersistentKeepaliveInterval
+	}
+}
+
 func readConfig(path string) (*soratun.Config, error) {
-	b, err := os.ReadFile(path)
+	tree, err := loadConfigTree(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := configFromTree(tree)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading config file: %s", describeConfigTreeError(path, err))
+	}
+
+	return config, nil
+}
+
+// readEffectiveConfig reads the configuration file, then overrides it with environment variables and fills defaults.
+// The precedence is defaults < file < environment variables < flags, and flags should be applied by callers. Use
+// readConfig instead if the configuration is going to be written back to the file.
+func readEffectiveConfig(path string) (*soratun.Config, error) {
+	tree, err := loadConfigTree(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := effectiveConfigFromTree(tree)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading config file: %s", describeConfigTreeError(path, err))
+	}
+
+	return config, nil
+}
+
+// parseConfig parses configuration in JSON, resolving secret references.
+func parseConfig(b []byte) (*soratun.Config, error) {
+	tree, err := parseConfigTree(b)
+	if err != nil {
+		return nil, err
+	}
+	return configFromTree(tree)
+}
+
+// parseConfigTree parses configuration in JSON, migrating it to the current version in memory.
+func parseConfigTree(b []byte) (*jsonObject, error) {
+	tree, err := parseJSONObject(b)
+	if err != nil {
+		return nil, err
+	}
+	warn := configWarner("(stdin)")
+	if _, err := migrateConfig(tree, warn); err != nil {
+		return nil, err
+	}
+	for _, field := range unknownConfigFields(tree) {
+		warn("unknown field %q is ignored", field)
+	}
+	return tree, nil
+}
+
+// parseEffectiveConfig parses configuration in JSON like parseConfig, then overrides it with environment variables and
+// fills defaults. See readEffectiveConfig.
+func parseEffectiveConfig(b []byte) (*soratun.Config, error) {
+	tree, err := parseConfigTree(b)
+	if err != nil {
+		return nil, err
+	}
+	return effectiveConfigFromTree(tree)
+}
+
+func effectiveConfigFromTree(tree *jsonObject) (*soratun.Config, error) {
+	if err := applyEnvOverrides(tree); err != nil {
+		return nil, err
+	}
+
+	config, err := configFromTree(tree)
+	if err != nil {
+		return nil, err
+	}
+	applyDefaults(config)
+	return config, nil
+}
+
+func configFromTree(tree *jsonObject) (*soratun.Config, error) {
+	if err := resolveSecretRefs(tree); err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(tree)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open config file: %s", path)
+		return nil, err
 	}
 
 	var config soratun.Config
 	err = json.Unmarshal(b, &config)
 	if err != nil {
-		return nil, fmt.Errorf("error while reading config file: %s", err)
+		return nil, err
 	}
 
 	return &config, nil
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"syscall"
+
+	"github.com/soracom/soratun"
+	"github.com/spf13/cobra"
+)
+
+func rotateKeysCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rotate-keys",
+		Short: "Rotate WireGuard key pair with a new Arc session",
+		Long:  "This command will generate a new WireGuard key pair locally, create a new Arc session with the new public key via SORACOM API with \"profile\" in the configuration file, then save them to the configuration file. If the tunnel interface is up, the new key pair and IP address will be applied to the interface without restart. A running \"soratun up\" is notified with SIGHUP to reload them. To rotate keys periodically while the tunnel is up, set \"keyRotationInterval\" in the configuration file.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			unlock, err := lockConfigurationFile()
+			if err != nil {
+				log.Fatalf("Error: %s\n", err)
+			}
+			defer unlock()
+
+			// profile may be given with environment variables, and persistArcSession writes back only the keys and the
+			// Arc session to the configuration file
+			config, err := readEffectiveConfig(configPath)
+			if err != nil {
+				log.Fatalf("Error: %s\n", err)
+			}
+			setMFACodeProvider(config.Profile)
+
+			// check before creating a new session, which makes the current private key unusable
+			if err := checkSecretRefUpdatable("privateKey"); err != nil {
+				log.Fatalf("Error: %s\n", err)
+			}
+
+			previous := *config
+			if err := soratun.RotateKeysWithProfile(config); err != nil {
+				log.Fatalf("failed to rotate keys: %v", err)
+			}
+
+			if err := persistArcSession(config); err != nil {
+				log.Fatalf("failed to save rotated keys: %v", err)
+			}
+
+			fmt.Printf("New public key: %s\n", config.PublicKey)
+			printConfigurationFilePath(configWritePath())
+
+			tunnel := runningTunnel(config.Interface)
+			if tunnel != nil && tunnel.UID == 0 {
+				// the running soratun applies the new keys, and keeps them for the next periodic rotation
+				notifyRunningTunnel(tunnel)
+				return
+			}
+
+			// soratun which has dropped privileges may not read the configuration file, and reads the keys applied to
+			// the device on SIGHUP
+			err = soratun.UpdateDevice(config.Interface, config)
+			if errors.Is(err, os.ErrNotExist) {
+				return
+			}
+			if err != nil {
+				log.Fatalf("failed to apply rotated keys to %s, please restart soratun: %v", config.Interface, err)
+			}
+			if !previous.ArcSession.ArcClientPeerIpAddress.Equal(config.ArcSession.ArcClientPeerIpAddress) && !config.SkipInterfaceConfiguration {
+				if err := soratun.ConfigureInterface(config.Interface, config); err != nil {
+					log.Fatalf("failed to assign new IP address to %s, please restart soratun: %v", config.Interface, err)
+				}
+			}
+			fmt.Printf("Applied new keys to %s\n", config.Interface)
+			if tunnel != nil {
+				notifyRunningTunnel(tunnel)
+			}
+		},
+	}
+}
+
+// runningTunnel returns the state of soratun which runs the tunnel for the interface, or nil if there is none. A state
+// whose process is not soratun run by the owner of the state is ignored with a warning.
+func runningTunnel(iname string) *soratun.TunnelState {
+	states, err := soratun.ReadTunnelStates()
+	if err != nil {
+		return nil
+	}
+	for _, s := range states {
+		if s.ConfiguredInterface != iname && s.Interface != iname {
+			continue
+		}
+		if err := s.VerifyProcess(); err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: ignoring the state of %s: %v\n", s.Interface, err)
+			return nil
+		}
+		return s
+	}
+	return nil
+}
+
+// notifyRunningTunnel sends SIGHUP to soratun which runs the tunnel, so that it reloads the keys.
+func notifyRunningTunnel(tunnel *soratun.TunnelState) {
+	if err := syscall.Kill(tunnel.PID, syscall.SIGHUP); err != nil {
+		log.Fatalf("failed to notify soratun (PID %d) of rotated keys, please restart soratun: %v", tunnel.PID, err)
+	}
+	fmt.Printf("Notified soratun (PID %d) of new keys for %s\n", tunnel.PID, tunnel.Interface)
+}
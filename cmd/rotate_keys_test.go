@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/soracom/soratun"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_runningTunnel(t *testing.T) {
+	stateDir := soratun.StateDir
+	soratun.StateDir = t.TempDir()
+	defer func() {
+		soratun.StateDir = stateDir
+	}()
+
+	state := fmt.Sprintf(`{"interface": "utun3", "configuredInterface": "utun", "pid": %d, "uid": %d}`, os.Getpid(), os.Getuid())
+	assert.NoError(t, os.WriteFile(filepath.Join(soratun.StateDir, "utun3.json"), []byte(state), 0o600))
+	// broken state does not hide others
+	assert.NoError(t, os.WriteFile(filepath.Join(soratun.StateDir, "soratun1.json"), []byte("{"), 0o600))
+
+	if s := runningTunnel("utun"); assert.NotNil(t, s) {
+		assert.Equal(t, os.Getpid(), s.PID)
+	}
+	if s := runningTunnel("utun3"); assert.NotNil(t, s) {
+		assert.Equal(t, os.Getpid(), s.PID)
+	}
+	assert.Nil(t, runningTunnel("soratun0"))
+
+	// the process is not run by the user in the state
+	state = fmt.Sprintf(`{"interface": "soratun2", "pid": %d, "uid": %d}`, os.Getpid(), os.Getuid()+1)
+	assert.NoError(t, os.WriteFile(filepath.Join(soratun.StateDir, "soratun2.json"), []byte(state), 0o600))
+	assert.Nil(t, runningTunnel("soratun2"))
+}
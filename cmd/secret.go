@@ -0,0 +1,290 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+	"github.com/soracom/soratun"
+)
+
+// secretRefPaths are paths of configuration fields which can refer to secrets stored outside of the configuration
+// file, with an object such as {"env": "NAME"} instead of a string. See soratun.SecretRef.
+var secretRefPaths = [][]string{
+	{"privateKey"},
+	{"profile", "authKey"},
+	{"profile", "password"},
+	{"profile", "apiKey"},
+	{"profile", "token"},
+}
+
+// passphraseCredentialName is a name of systemd credential which holds passphrase for encrypted secrets.
+const passphraseCredentialName = "soratun-passphrase"
+
+var (
+	// cachedPassphrase holds the passphrase once obtained, so that it is not asked more than once.
+	cachedPassphrase string
+	// passphraseAsked is true if cachedPassphrase is entered on terminal.
+	passphraseAsked bool
+	// resolvedSecrets holds secrets resolved by resolveSecretRefs keyed by the reference in JSON, so that a secret,
+	// e.g. from "exec", is never resolved again when the configuration is saved.
+	resolvedSecrets = map[string]string{}
+)
+
+// configPassphrase returns the passphrase for encrypted secrets from SORATUN_CONFIG_PASSPHRASE environment variable,
+// systemd credential "soratun-passphrase", or terminal.
+func configPassphrase() (string, error) {
+	if cachedPassphrase != "" {
+		return cachedPassphrase, nil
+	}
+
+	if v := os.Getenv("SORATUN_CONFIG_PASSPHRASE"); v != "" {
+		cachedPassphrase = v
+		return v, nil
+	}
+
+	if dir := os.Getenv("CREDENTIALS_DIRECTORY"); dir != "" {
+		b, err := os.ReadFile(filepath.Join(dir, passphraseCredentialName))
+		if err == nil {
+			cachedPassphrase = strings.TrimSpace(string(b))
+			return cachedPassphrase, nil
+		}
+	}
+
+	if !isTerminal(os.Stdin) {
+		return "", fmt.Errorf("passphrase for encrypted secrets is required. Set SORATUN_CONFIG_PASSPHRASE environment variable, or systemd credential %q", passphraseCredentialName)
+	}
+
+	p, err := askInput(promptui.Prompt{Label: "Passphrase for the configuration file", Mask: '*'})
+	if err != nil {
+		return "", err
+	}
+	cachedPassphrase = p
+	passphraseAsked = true
+	return p, nil
+}
+
+// secretRefAt returns the secret reference at the path, or nil if the value is not a reference.
+func secretRefAt(tree *jsonObject, path []string) (*soratun.SecretRef, error) {
+	v, ok := tree.lookup(path)
+	if !ok {
+		return nil, nil
+	}
+	if _, ok := v.(*jsonObject); !ok {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	d := json.NewDecoder(strings.NewReader(string(b)))
+	d.DisallowUnknownFields()
+	var ref soratun.SecretRef
+	if err := d.Decode(&ref); err != nil {
+		return nil, fmt.Errorf("invalid secret reference at %s: %w", strings.Join(path, "."), err)
+	}
+	return &ref, nil
+}
+
+// resolveSecretRefs replaces secret references in tree with the secrets.
+func resolveSecretRefs(tree *jsonObject) error {
+	for _, path := range secretRefPaths {
+		ref, err := secretRefAt(tree, path)
+		if err != nil {
+			return err
+		}
+		if ref == nil {
+			continue
+		}
+
+		secret, err := resolveSecretRef(ref)
+		if err != nil {
+			return fmt.Errorf("failed to resolve secret at %s: %w", strings.Join(path, "."), err)
+		}
+		tree.replace(path, secret)
+	}
+	return nil
+}
+
+// resolveSecretRef returns the secret which ref refers to, which is resolved only once in the process.
+func resolveSecretRef(ref *soratun.SecretRef) (string, error) {
+	key, err := json.Marshal(ref)
+	if err != nil {
+		return "", err
+	}
+	if secret, ok := resolvedSecrets[string(key)]; ok {
+		return secret, nil
+	}
+
+	secret, err := ref.Resolve(configPassphrase)
+	if err != nil {
+		return "", err
+	}
+	resolvedSecrets[string(key)] = secret
+	return secret, nil
+}
+
+// hasSecretRef returns whether the secret at path in the configuration file is a secret reference.
+func hasSecretRef(path ...string) bool {
+	tree, err := loadConfigTree(configPath)
+	if err != nil {
+		return false
+	}
+	ref, err := secretRefAt(tree, path)
+	return err == nil && ref != nil
+}
+
+// checkSecretRefUpdatable returns an error if the secret at path in the configuration file refers to where soratun can
+// not store a new value, e.g. an environment variable. Call it before anything which replaces the secret, such as
+// creating a new Arc session.
+func checkSecretRefUpdatable(path ...string) error {
+	tree, err := loadConfigTree(configPath)
+	if err != nil {
+		// nothing to update
+		return nil
+	}
+
+	ref, err := secretRefAt(tree, path)
+	if err != nil || ref == nil {
+		return err
+	}
+	if err := ref.CheckUpdatable(); err != nil {
+		return fmt.Errorf("%s can not be replaced: %w", strings.Join(path, "."), err)
+	}
+	return nil
+}
+
+// applySecretRefs puts secret references in current configuration back into tree, which is going to be written to the
+// configuration file, so that secrets are not written in plain text. If a secret is updated, e.g. with key rotation,
+// the new secret is stored to where the reference points if possible.
+func applySecretRefs(tree, current *jsonObject) error {
+	for _, path := range secretRefPaths {
+		ref, err := secretRefAt(current, path)
+		if err != nil {
+			return err
+		}
+		if ref == nil {
+			continue
+		}
+
+		v, ok := tree.lookup(path)
+		if !ok {
+			continue
+		}
+		value, ok := v.(string)
+		if !ok {
+			continue
+		}
+
+		secret, err := resolveSecretRef(ref)
+		if err != nil {
+			return fmt.Errorf("failed to resolve secret at %s: %w", strings.Join(path, "."), err)
+		}
+		if secret != value {
+			if ref, err = ref.Update(value, configPassphrase); err != nil {
+				return fmt.Errorf("failed to update secret at %s: %w", strings.Join(path, "."), err)
+			}
+			key, err := json.Marshal(ref)
+			if err != nil {
+				return err
+			}
+			resolvedSecrets[string(key)] = value
+		}
+
+		refTree, err := toJSONTree(ref)
+		if err != nil {
+			return err
+		}
+		tree.replace(path, refTree)
+	}
+	return nil
+}
+
+// convertSecrets replaces each secret in tree with the result of convert, which returns nil to leave it as is.
+func convertSecrets(tree *jsonObject, convert func(value interface{}) (interface{}, error)) (int, error) {
+	converted := 0
+	for _, path := range secretRefPaths {
+		v, ok := tree.lookup(path)
+		if !ok {
+			continue
+		}
+
+		nv, err := convert(v)
+		if err != nil {
+			return 0, fmt.Errorf("failed to convert secret at %s: %w", strings.Join(path, "."), err)
+		}
+		if nv != nil {
+			tree.replace(path, nv)
+			converted++
+		}
+	}
+	return converted, nil
+}
+
+func toJSONTree(v interface{}) (*jsonObject, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return parseJSONObject(b)
+}
+
+// encryptSecretValue returns encrypted reference for a secret in plain text, or nil for others.
+func encryptSecretValue(v interface{}) (interface{}, error) {
+	value, ok := v.(string)
+	if !ok || value == "" {
+		return nil, nil
+	}
+
+	p, err := configPassphrase()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := soratun.EncryptSecret(value, p)
+	if err != nil {
+		return nil, err
+	}
+	return toJSONTree(&soratun.SecretRef{Encrypted: encrypted})
+}
+
+// decryptSecretValue returns plain text secret for an encrypted reference, or nil for others.
+func decryptSecretValue(v interface{}) (interface{}, error) {
+	if _, ok := v.(*jsonObject); !ok {
+		return nil, nil
+	}
+
+	tree := newJSONObject()
+	tree.Set("secret", v)
+	ref, err := secretRefAt(tree, []string{"secret"})
+	if err != nil {
+		return nil, err
+	}
+	if ref.Encrypted == "" {
+		return nil, nil
+	}
+	return ref.Resolve(configPassphrase)
+}
+
+// confirmNewPassphrase obtains the passphrase, and asks it again if it is entered on terminal.
+func confirmNewPassphrase() error {
+	p, err := configPassphrase()
+	if err != nil || !passphraseAsked {
+		return err
+	}
+
+	confirmed, err := askInput(promptui.Prompt{Label: "Confirm passphrase", Mask: '*'})
+	if err != nil {
+		return err
+	}
+	if p != confirmed {
+		cachedPassphrase, passphraseAsked = "", false
+		return errors.New("passphrases do not match")
+	}
+	return nil
+}
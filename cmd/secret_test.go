@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/soracom/soratun"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_secretRefs(t *testing.T) {
+	originalConfigPath := configPath
+	t.Cleanup(func() {
+		configPath = originalConfigPath
+		cachedPassphrase, passphraseAsked = "", false
+		resolvedSecrets = map[string]string{}
+	})
+
+	dir := t.TempDir()
+	configPath = filepath.Join(dir, "arc.json")
+	t.Setenv("SORATUN_CONFIG_PASSPHRASE", "passphrase")
+	t.Setenv("SORATUN_TEST_AUTH_KEY", "secret-from-env")
+
+	privateKey, _, err := soratun.GenerateKeyPair()
+	assert.NoError(t, err)
+	privateKeyFile := filepath.Join(dir, "private.key")
+	assert.NoError(t, os.WriteFile(privateKeyFile, []byte(privateKey.String()+"\n"), 0600))
+
+	encrypted, err := soratun.EncryptSecret("p@ssw0rd", "passphrase")
+	assert.NoError(t, err)
+
+	conf := `{
+  "privateKey": {"file": "` + privateKeyFile + `"},
+  "simId": "8942310022000000000",
+  "profile": {
+    "authKeyId": "keyId-xxx",
+    "authKey": {"env": "SORATUN_TEST_AUTH_KEY"},
+    "password": {"encrypted": "` + encrypted + `"}
+  }
+}`
+	assert.NoError(t, os.WriteFile(configPath, []byte(conf), 0600))
+
+	config, err := readConfig(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, privateKey, config.PrivateKey)
+	assert.Equal(t, "secret-from-env", config.Profile.AuthKey)
+	assert.Equal(t, "p@ssw0rd", config.Profile.Password)
+
+	// updated private key is stored to the file, and password is encrypted again
+	newPrivateKey, _, err := soratun.GenerateKeyPair()
+	assert.NoError(t, err)
+	config.PrivateKey = newPrivateKey
+	config.Profile.Password = "n3w-p@ssw0rd"
+	assert.NoError(t, saveConfig(config))
+
+	b, err := os.ReadFile(configPath)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "secret-from-env")
+	assert.NotContains(t, string(b), "n3w-p@ssw0rd")
+	assert.NotContains(t, string(b), newPrivateKey.String())
+
+	b, err = os.ReadFile(privateKeyFile)
+	assert.NoError(t, err)
+	assert.Equal(t, newPrivateKey.String()+"\n", string(b))
+
+	config, err = readConfig(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, newPrivateKey, config.PrivateKey)
+	assert.Equal(t, "n3w-p@ssw0rd", config.Profile.Password)
+
+	// secret in environment variable can not be updated
+	assert.NoError(t, checkSecretRefUpdatable("privateKey"))
+	assert.ErrorContains(t, checkSecretRefUpdatable("profile", "authKey"), "profile.authKey can not be replaced")
+	config.Profile.AuthKey = "secret-updated"
+	assert.Error(t, saveConfig(config))
+}
+
+func Test_resolveSecretRef(t *testing.T) {
+	t.Cleanup(func() {
+		resolvedSecrets = map[string]string{}
+	})
+
+	// the command is executed only once
+	count := filepath.Join(t.TempDir(), "count")
+	ref := &soratun.SecretRef{Exec: []string{"sh", "-c", "echo >> " + count + "; echo secret-from-exec"}}
+	for i := 0; i < 2; i++ {
+		secret, err := resolveSecretRef(ref)
+		assert.NoError(t, err)
+		assert.Equal(t, "secret-from-exec", secret)
+	}
+
+	b, err := os.ReadFile(count)
+	assert.NoError(t, err)
+	assert.Equal(t, "\n", string(b))
+}
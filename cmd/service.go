@@ -0,0 +1,505 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	serviceName          string
+	serviceTemplate      bool
+	serviceWatchdogSec   int
+	serviceBootstrap     string
+	serviceBootstrapArgs []string
+	serviceNow           bool
+)
+
+// systemdUnitDir is the directory where "soratun service install" writes unit files.
+var systemdUnitDir = "/etc/systemd/system"
+
+// systemctl runs systemctl with args, and returns its output. It is replaced in tests.
+var systemctl = func(args ...string) (string, error) {
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("\"systemctl %s\" failed: %w, output: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func serviceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "service",
+		Short: "Manage systemd unit for soratun",
+		Long:  "Install, uninstall, or show the status of systemd unit which runs \"soratun up\" with the configuration file specified with --config. With --template, a template unit \"soratun@.service\" is used for multiple configuration files in the same directory, and the instance name is the file name without \".json\", e.g. \"soratun@arc.service\" for arc.json.",
+		Args:  cobra.NoArgs,
+	}
+
+	cmd.PersistentFlags().StringVar(&serviceName, "name", "soratun", "Name of the unit, without \".service\"")
+	cmd.PersistentFlags().BoolVar(&serviceTemplate, "template", false, "Use a template unit \"<name>@.service\" for multiple configuration files")
+
+	cmd.AddCommand(serviceInstallCmd())
+	cmd.AddCommand(serviceUninstallCmd())
+	cmd.AddCommand(serviceStatusCmd())
+
+	return cmd
+}
+
+func serviceInstallCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "install",
+		Short: "Install and enable systemd unit",
+		Long:  "This command will write systemd unit file to " + systemdUnitDir + ", then enable the unit. The unit runs soratun with CAP_NET_ADMIN only, hardened with systemd sandboxing options, and updates the watchdog timer. With --bootstrap, the virtual SIM is bootstrapped at the first start if the configuration file does not exist yet.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			u, err := newServiceUnit()
+			if err != nil {
+				log.Fatalf("Failed to install service: %v", err)
+			}
+
+			if u.Bootstrap == "" {
+				if _, err := os.Stat(u.ConfigPath); err != nil {
+					log.Fatalf("Configuration file %s is not found. Bootstrap first, or use --bootstrap to bootstrap at the first start", u.ConfigPath)
+				}
+			}
+
+			for _, p := range u.HomePaths() {
+				fmt.Fprintf(os.Stderr, "WARNING: %s is in a home directory, so the unit makes home directories read-only instead of inaccessible. Consider moving it to /etc/soratun\n", p)
+			}
+
+			if err := installServiceUnit(u, os.Stdout); err != nil {
+				log.Fatalf("Failed to install service: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().IntVar(&serviceWatchdogSec, "watchdog-sec", 120, "WatchdogSec of the unit in seconds. 0 disables the watchdog")
+	cmd.Flags().StringVar(&serviceBootstrap, "bootstrap", "", "Bootstrap method, \"authkey\", \"cellular\" or \"sim\", to run at the first start if the configuration file does not exist")
+	cmd.Flags().StringArrayVar(&serviceBootstrapArgs, "bootstrap-arg", nil, "Additional argument for the bootstrap command, e.g. --bootstrap-arg=--sim-name=gateway. Can be specified multiple times")
+	cmd.Flags().BoolVar(&serviceNow, "now", false, "Start the unit after enabling")
+
+	return cmd
+}
+
+func serviceUninstallCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "uninstall",
+		Short: "Stop, disable and remove systemd unit",
+		Long:  "This command will stop and disable the unit, then remove the unit file. With --template, only the instance for the configuration file is stopped and disabled, and the template unit file is removed when no instance is enabled any more.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			u, err := newServiceUnit()
+			if err != nil {
+				log.Fatalf("Failed to uninstall service: %v", err)
+			}
+
+			if err := uninstallServiceUnit(u, os.Stdout); err != nil {
+				log.Fatalf("Failed to uninstall service: %v", err)
+			}
+		},
+	}
+}
+
+func serviceStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show status of systemd unit",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			u, err := newServiceUnit()
+			if err != nil {
+				log.Fatalf("Failed to get service status: %v", err)
+			}
+
+			if err := printServiceStatus(u, os.Stdout); err != nil {
+				log.Fatalf("Failed to get service status: %v", err)
+			}
+		},
+	}
+}
+
+// serviceUnit is systemd unit which runs soratun.
+type serviceUnit struct {
+	// Name is the name of the unit without ".service", or the prefix of the template unit.
+	Name string
+	// Template is true for the template unit, whose instance name is the configuration file name without ".json".
+	Template bool
+	// Executable is the absolute path to soratun.
+	Executable string
+	// ConfigPath is the absolute path to the configuration file.
+	ConfigPath string
+	// ConfigDir is the absolute path to the drop-in directory specified with "--config-dir", or empty for the default.
+	ConfigDir string
+	// SecretFiles are absolute paths to files which secret references in the configuration file point to.
+	SecretFiles []string
+	// WatchdogSec is WatchdogSec of the unit. 0 disables the watchdog.
+	WatchdogSec int
+	// Bootstrap is the bootstrap method to run at the first start, or empty.
+	Bootstrap     string
+	BootstrapArgs []string
+}
+
+func newServiceUnit() (*serviceUnit, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find soratun executable: %w", err)
+	}
+	executable, err = filepath.EvalSymlinks(executable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find soratun executable: %w", err)
+	}
+
+	path, err := filepath.Abs(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get path to configuration file: %w", err)
+	}
+
+	switch serviceBootstrap {
+	case "", "authkey", "cellular", "sim":
+	default:
+		return nil, fmt.Errorf("unknown bootstrap method %q, should be one of authkey, cellular, sim", serviceBootstrap)
+	}
+
+	if serviceName == "" || strings.ContainsAny(serviceName, "@/") {
+		return nil, fmt.Errorf("invalid unit name %q", serviceName)
+	}
+	if serviceTemplate && filepath.Ext(path) != ".json" {
+		return nil, fmt.Errorf("configuration file should be named <instance>.json with --template, but got %s", path)
+	}
+
+	dir := ""
+	if configDir != "" {
+		if dir, err = filepath.Abs(configDir); err != nil {
+			return nil, fmt.Errorf("failed to get path to drop-in directory: %w", err)
+		}
+	}
+
+	return &serviceUnit{
+		Name:          serviceName,
+		Template:      serviceTemplate,
+		Executable:    executable,
+		ConfigPath:    path,
+		ConfigDir:     dir,
+		SecretFiles:   secretFiles(),
+		WatchdogSec:   serviceWatchdogSec,
+		Bootstrap:     serviceBootstrap,
+		BootstrapArgs: serviceBootstrapArgs,
+	}, nil
+}
+
+// secretFiles returns absolute paths to files which secret references in the configuration file point to.
+func secretFiles() []string {
+	tree, err := loadConfigTree(configPath)
+	if err != nil {
+		return nil
+	}
+
+	var files []string
+	for _, path := range secretRefPaths {
+		ref, err := secretRefAt(tree, path)
+		if err != nil || ref == nil || ref.File == "" {
+			continue
+		}
+		if file, err := filepath.Abs(ref.File); err == nil {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// homeDirs are directories which are hidden by ProtectHome=yes.
+var homeDirs = []string{"/home", "/root", "/run/user"}
+
+// WritablePaths returns directories which soratun writes to, i.e. the directory of the configuration file, the drop-in
+// directory and directories of secret files, since files are replaced with rename.
+func (u *serviceUnit) WritablePaths() []string {
+	paths := []string{filepath.Dir(u.ConfigPath)}
+	if u.ConfigDir != "" {
+		paths = append(paths, u.ConfigDir)
+	}
+	for _, f := range u.SecretFiles {
+		paths = append(paths, filepath.Dir(f))
+	}
+
+	var dedup []string
+	for _, p := range paths {
+		covered := false
+		for _, q := range dedup {
+			if p == q || strings.HasPrefix(p, q+"/") {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			dedup = append(dedup, p)
+		}
+	}
+	return dedup
+}
+
+// HomePaths returns paths of WritablePaths in home directories, which soratun can't access with ProtectHome=yes.
+func (u *serviceUnit) HomePaths() []string {
+	var paths []string
+	for _, p := range u.WritablePaths() {
+		for _, h := range homeDirs {
+			if p == h || strings.HasPrefix(p, h+"/") {
+				paths = append(paths, p)
+				break
+			}
+		}
+	}
+	return paths
+}
+
+// FileName returns the name of the unit file.
+func (u *serviceUnit) FileName() string {
+	if u.Template {
+		return u.Name + "@.service"
+	}
+	return u.Name + ".service"
+}
+
+// Path returns the path to the unit file.
+func (u *serviceUnit) Path() string {
+	return filepath.Join(systemdUnitDir, u.FileName())
+}
+
+// Instance returns the unit to enable, i.e. the instance for the configuration file if the unit is a template.
+func (u *serviceUnit) Instance() string {
+	if u.Template {
+		return fmt.Sprintf("%s@%s.service", u.Name, systemdEscape(strings.TrimSuffix(filepath.Base(u.ConfigPath), ".json")))
+	}
+	return u.FileName()
+}
+
+// Render returns the content of the unit file.
+func (u *serviceUnit) Render() string {
+	configDir := filepath.Dir(u.ConfigPath)
+	config := systemdQuote(u.ConfigPath)
+	description := "soratun, SORACOM Arc client"
+	if u.Template {
+		// %I is the unescaped instance name
+		config = systemdQuote(filepath.Join(configDir, "%I.json"), "%I")
+		description += " (%i)"
+	}
+
+	serviceType := "simple"
+	if u.WatchdogSec > 0 {
+		// soratun notifies readiness only when the watchdog is enabled
+		serviceType = "notify"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `# Generated by "soratun service install". Changes will be overwritten by the next install, so use
+# "systemctl edit" to customize.
+[Unit]
+Description=%s
+Documentation=https://github.com/soracom/soratun
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=%s
+`, description, serviceType)
+
+	if u.Bootstrap != "" {
+		// bootstrap only at the first start, i.e. if the configuration file does not exist. Paths and arguments are
+		// passed as positional parameters to avoid quoting them for the shell
+		args := []string{systemdQuote(u.Executable), config}
+		for _, a := range u.BootstrapArgs {
+			args = append(args, systemdQuote(a))
+		}
+		fmt.Fprintf(&b, "ExecStartPre=/bin/sh -c 'test -e \"$$1\" || exec \"$$0\" bootstrap %s --config \"$$@\"' %s\n", u.Bootstrap, strings.Join(args, " "))
+	}
+
+	if u.ConfigDir != "" {
+		fmt.Fprintf(&b, "ExecStart=%s up --config %s --config-dir %s\n", systemdQuote(u.Executable), config, systemdQuote(u.ConfigDir))
+	} else {
+		fmt.Fprintf(&b, "ExecStart=%s up --config %s\n", systemdQuote(u.Executable), config)
+	}
+	b.WriteString("Restart=always\nRestartSec=5\n")
+	if u.WatchdogSec > 0 {
+		fmt.Fprintf(&b, "WatchdogSec=%d\n", u.WatchdogSec)
+	}
+
+	b.WriteString(`SyslogIdentifier=soratun
+# tunnel state and WireGuard UAPI sockets, shared with other instances
+RuntimeDirectory=soratun wireguard
+RuntimeDirectoryPreserve=yes
+
+`)
+	b.WriteString(`# soratun needs CAP_NET_ADMIN to create the interface and configure addresses and routes. The others are to switch
+# to "user" in the configuration file after the interface is up, which may be added after the unit is installed
+CapabilityBoundingSet=CAP_NET_ADMIN CAP_SETUID CAP_SETGID CAP_CHOWN
+`)
+
+	var writable []string
+	for _, p := range u.WritablePaths() {
+		writable = append(writable, systemdQuote(p))
+	}
+	protectHome := "yes"
+	if len(u.HomePaths()) > 0 {
+		protectHome = "read-only"
+	}
+
+	fmt.Fprintf(&b, `AmbientCapabilities=CAP_NET_ADMIN
+NoNewPrivileges=yes
+ProtectSystem=strict
+# bootstrap and the key rotation update the configuration file and secret files
+ReadWritePaths=%s
+`, strings.Join(writable, " "))
+	if protectHome != "yes" {
+		b.WriteString("# the configuration is in a home directory, so home directories are read-only except for ReadWritePaths\n")
+	}
+	fmt.Fprintf(&b, `ProtectHome=%s
+PrivateTmp=yes
+ProtectKernelTunables=yes
+ProtectKernelModules=yes
+ProtectKernelLogs=yes
+ProtectControlGroups=yes
+ProtectClock=yes
+ProtectHostname=yes
+RestrictAddressFamilies=AF_INET AF_INET6 AF_NETLINK AF_UNIX
+RestrictNamespaces=yes
+RestrictRealtime=yes
+RestrictSUIDSGID=yes
+LockPersonality=yes
+MemoryDenyWriteExecute=yes
+SystemCallArchitectures=native
+
+[Install]
+WantedBy=multi-user.target
+`, protectHome)
+
+	return b.String()
+}
+
+// installServiceUnit writes the unit file, then enables the unit with systemctl.
+func installServiceUnit(u *serviceUnit, w io.Writer) error {
+	if err := os.WriteFile(u.Path(), []byte(u.Render()), 0644); err != nil {
+		return fmt.Errorf("failed to write unit file: %w", err)
+	}
+	fmt.Fprintf(w, "Created unit file: %s\n", u.Path())
+
+	if _, err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+
+	args := []string{"enable", u.Instance()}
+	if serviceNow {
+		args = []string{"enable", "--now", u.Instance()}
+	}
+	if _, err := systemctl(args...); err != nil {
+		return err
+	}
+	if serviceNow {
+		fmt.Fprintf(w, "Enabled and started %s\n", u.Instance())
+	} else {
+		fmt.Fprintf(w, "Enabled %s. Run \"systemctl start %s\" to start now\n", u.Instance(), u.Instance())
+	}
+	return nil
+}
+
+// uninstallServiceUnit stops and disables the unit, then removes the unit file unless other instances of the template
+// are still enabled.
+func uninstallServiceUnit(u *serviceUnit, w io.Writer) error {
+	if _, err := os.Stat(u.Path()); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unit file %s is not found", u.Path())
+	}
+
+	if _, err := systemctl("disable", "--now", u.Instance()); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Stopped and disabled %s\n", u.Instance())
+
+	if u.Template {
+		instances, err := filepath.Glob(filepath.Join(systemdUnitDir, "*.wants", u.Name+"@*.service"))
+		if err != nil {
+			return err
+		}
+		if len(instances) > 0 {
+			fmt.Fprintf(w, "Kept unit file %s for other enabled instances\n", u.Path())
+			return nil
+		}
+	}
+
+	if err := os.Remove(u.Path()); err != nil {
+		return fmt.Errorf("failed to remove unit file: %w", err)
+	}
+	fmt.Fprintf(w, "Removed unit file: %s\n", u.Path())
+
+	_, err := systemctl("daemon-reload")
+	return err
+}
+
+func printServiceStatus(u *serviceUnit, w io.Writer) error {
+	if _, err := os.Stat(u.Path()); errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(w, "unit: %s (not installed)\n", u.Instance())
+		return nil
+	}
+
+	out, err := systemctl("show", "--property=UnitFileState,ActiveState,SubState,StatusText,NRestarts", u.Instance())
+	if err != nil {
+		return err
+	}
+	properties := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		if k, v, ok := strings.Cut(line, "="); ok {
+			properties[k] = v
+		}
+	}
+
+	fmt.Fprintf(w, "unit: %s\n", u.Instance())
+	fmt.Fprintf(w, "  unit file: %s\n", u.Path())
+	fmt.Fprintf(w, "  enabled: %s\n", properties["UnitFileState"])
+	fmt.Fprintf(w, "  active: %s (%s)\n", properties["ActiveState"], properties["SubState"])
+	if properties["StatusText"] != "" {
+		fmt.Fprintf(w, "  status: %s\n", properties["StatusText"])
+	}
+	fmt.Fprintf(w, "  restarts: %s\n", properties["NRestarts"])
+	return nil
+}
+
+// systemdQuote quotes s as a single argument of a command line in a unit file if needed, escaping specifiers except
+// keep, e.g. "%i" of the template unit.
+func systemdQuote(s string, keep ...string) string {
+	s = systemdEscapeSpecifiers(s)
+	for _, k := range keep {
+		s = strings.ReplaceAll(s, systemdEscapeSpecifiers(k), k)
+	}
+	if !strings.ContainsAny(s, " \t\"'\\;$") {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "$", "$$")
+	return `"` + s + `"`
+}
+
+func systemdEscapeSpecifiers(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
+
+// systemdEscape escapes s for the instance name of a template unit, like "systemd-escape".
+func systemdEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '/':
+			b.WriteByte('-')
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == ':', c == '_', c == '.' && i > 0:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		}
+	}
+	return b.String()
+}
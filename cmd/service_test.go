@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_serviceUnit_Render(t *testing.T) {
+	u := &serviceUnit{
+		Name:        "soratun",
+		Executable:  "/usr/local/bin/soratun",
+		ConfigPath:  "/etc/soratun/arc.json",
+		WatchdogSec: 120,
+	}
+	assert.Equal(t, "/etc/systemd/system/soratun.service", u.Path())
+	assert.Equal(t, "soratun.service", u.Instance())
+
+	unit := u.Render()
+	assert.Contains(t, unit, "Type=notify\n")
+	assert.Contains(t, unit, "ExecStart=/usr/local/bin/soratun up --config /etc/soratun/arc.json\n")
+	assert.Contains(t, unit, "WatchdogSec=120\n")
+	assert.Contains(t, unit, "CapabilityBoundingSet=CAP_NET_ADMIN CAP_SETUID CAP_SETGID CAP_CHOWN\n")
+	assert.Contains(t, unit, "ReadWritePaths=/etc/soratun\n")
+	assert.NotContains(t, unit, "ExecStartPre")
+
+	u.WatchdogSec = 0
+	u.Template = true
+	u.Bootstrap = "authkey"
+	u.BootstrapArgs = []string{"--sim-name=my gateway"}
+	assert.Equal(t, "/etc/systemd/system/soratun@.service", u.Path())
+	assert.Equal(t, "soratun@arc.service", u.Instance())
+
+	unit = u.Render()
+	assert.Contains(t, unit, "Description=soratun, SORACOM Arc client (%i)\n")
+	assert.Contains(t, unit, "Type=simple\n")
+	assert.NotContains(t, unit, "WatchdogSec")
+	assert.Contains(t, unit, `ExecStartPre=/bin/sh -c 'test -e "$$1" || exec "$$0" bootstrap authkey --config "$$@"' /usr/local/bin/soratun /etc/soratun/%I.json "--sim-name=my gateway"`+"\n")
+	assert.Contains(t, unit, "ExecStart=/usr/local/bin/soratun up --config /etc/soratun/%I.json\n")
+	assert.Contains(t, unit, "ProtectHome=yes\n")
+}
+
+func Test_serviceUnit_Render_home(t *testing.T) {
+	u := &serviceUnit{
+		Name:        "soratun",
+		Executable:  "/usr/local/bin/soratun",
+		ConfigPath:  "/home/pi/arc.json",
+		ConfigDir:   "/etc/soratun/conf.d",
+		SecretFiles: []string{"/home/pi/keys/private.key", "/var/lib/soratun/auth-key"},
+	}
+	assert.Equal(t, []string{"/home/pi"}, u.HomePaths())
+
+	unit := u.Render()
+	assert.Contains(t, unit, "ExecStart=/usr/local/bin/soratun up --config /home/pi/arc.json --config-dir /etc/soratun/conf.d\n")
+	assert.Contains(t, unit, "ReadWritePaths=/home/pi /etc/soratun/conf.d /var/lib/soratun\n")
+	assert.Contains(t, unit, "ProtectHome=read-only\n")
+	assert.NotContains(t, unit, "ProtectHome=yes")
+
+	u.ConfigPath = "/etc/soratun/arc.json"
+	u.SecretFiles = []string{"/run/user/1000/soratun/private.key"}
+	assert.Equal(t, []string{"/run/user/1000/soratun"}, u.HomePaths())
+	assert.Contains(t, u.Render(), "ProtectHome=read-only\n")
+}
+
+func Test_systemdQuote(t *testing.T) {
+	assert.Equal(t, "/etc/soratun/arc.json", systemdQuote("/etc/soratun/arc.json"))
+	assert.Equal(t, `"/etc/my soratun/arc.json"`, systemdQuote("/etc/my soratun/arc.json"))
+	assert.Equal(t, `"/etc/soratun/$$HOME\\%%.json"`, systemdQuote(`/etc/soratun/$HOME\%.json`))
+	assert.Equal(t, "/etc/soratun/%I.json", systemdQuote("/etc/soratun/%I.json", "%I"))
+}
+
+func Test_systemdEscape(t *testing.T) {
+	assert.Equal(t, "arc", systemdEscape("arc"))
+	assert.Equal(t, `my\x2dgateway.v2`, systemdEscape("my-gateway.v2"))
+	assert.Equal(t, `\x2etest`, systemdEscape(".test"))
+}
+
+func Test_installServiceUnit(t *testing.T) {
+	dir := t.TempDir()
+	defer func(d string) { systemdUnitDir = d }(systemdUnitDir)
+	systemdUnitDir = dir
+
+	var calls []string
+	defer func(f func(args ...string) (string, error)) { systemctl = f }(systemctl)
+	systemctl = func(args ...string) (string, error) {
+		calls = append(calls, strings.Join(args, " "))
+		if args[0] == "show" {
+			return "UnitFileState=enabled\nActiveState=active\nSubState=running\nStatusText=latest handshake 42s ago\nNRestarts=0", nil
+		}
+		return "", nil
+	}
+
+	u := &serviceUnit{Name: "soratun", Template: true, Executable: "/usr/local/bin/soratun", ConfigPath: "/etc/soratun/arc.json"}
+	var b bytes.Buffer
+	assert.NoError(t, installServiceUnit(u, &b))
+	assert.Equal(t, []string{"daemon-reload", "enable soratun@arc.service"}, calls)
+	assert.FileExists(t, filepath.Join(dir, "soratun@.service"))
+
+	b.Reset()
+	assert.NoError(t, printServiceStatus(u, &b))
+	assert.Contains(t, b.String(), "  active: active (running)\n")
+	assert.Contains(t, b.String(), "  status: latest handshake 42s ago\n")
+
+	// another instance is still enabled
+	wants := filepath.Join(dir, "multi-user.target.wants")
+	assert.NoError(t, os.Mkdir(wants, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(wants, "soratun@other.service"), nil, 0644))
+	calls = nil
+	b.Reset()
+	assert.NoError(t, uninstallServiceUnit(u, &b))
+	assert.Equal(t, []string{"disable --now soratun@arc.service"}, calls)
+	assert.FileExists(t, filepath.Join(dir, "soratun@.service"))
+
+	assert.NoError(t, os.Remove(filepath.Join(wants, "soratun@other.service")))
+	assert.NoError(t, uninstallServiceUnit(u, &b))
+	assert.NoFileExists(t, filepath.Join(dir, "soratun@.service"))
+
+	b.Reset()
+	assert.NoError(t, printServiceStatus(u, &b))
+	assert.Equal(t, "unit: soratun@arc.service (not installed)\n", b.String())
+}
@@ -0,0 +1,329 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/manifoldco/promptui"
+	"github.com/soracom/soratun"
+	"github.com/spf13/cobra"
+)
+
+var (
+	simType         string
+	simName         string
+	simTags         map[string]string
+	simGroupId      string
+	unsetSimGroup   bool
+	skipConfirm     bool
+	simOutputFormat string
+)
+
+func simCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sim",
+		Short: "Manage virtual SIM with SORACOM API",
+		Long:  "\"soratun sim\" provides a set of commands to manage virtual SIMs with SORACOM API, using \"profile\" in the configuration file. If SIM ID is omitted, \"simId\" in the configuration file will be used.",
+		Args:  cobra.NoArgs,
+	}
+
+	cmd.AddCommand(simGetCmd())
+	cmd.AddCommand(simListCmd())
+	cmd.AddCommand(simTerminateCmd())
+	cmd.AddCommand(simTagCmd())
+	cmd.AddCommand(simGroupCmd())
+	cmd.AddCommand(simSessionCmd())
+
+	return cmd
+}
+
+func simGetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "get [SIM_ID]",
+		Short: "Show virtual SIM",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client, simId := newSimCommandClient(args)
+
+			sim, err := client.GetSim(simId)
+			if err != nil {
+				log.Fatal(simError("get", simId, err))
+			}
+			printSim(os.Stdout, sim)
+		},
+	}
+}
+
+func simListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List virtual SIMs",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			client, _ := newSoracomClientFromConfig()
+
+			if err := listSims(client, os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&simType, "type", "virtual", "Show only SIMs of the type. Specify empty string to show all SIMs")
+	cmd.Flags().StringVar(&simOutputFormat, "output", "table", "Output format, \"table\" or \"json\"")
+
+	return cmd
+}
+
+func simTerminateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "terminate [SIM_ID]",
+		Short: "Terminate virtual SIM",
+		Long:  "This command will terminate the virtual SIM. Terminated SIM can not be used anymore, and the operation can not be undone.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client, simId := newSimCommandClient(args)
+
+			if err := terminateSim(client, simId, os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&skipConfirm, "yes", false, "Terminate without confirmation")
+
+	return cmd
+}
+
+func simTagCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tag [SIM_ID]",
+		Short: "Set name and tags of virtual SIM",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if !cmd.Flags().Changed("name") && len(simTags) == 0 {
+				log.Fatal("Either \"--name\" or \"--tag\" is required")
+			}
+
+			client, simId := newSimCommandClient(args)
+
+			tags := map[string]string{}
+			for k, v := range simTags {
+				tags[k] = v
+			}
+			if cmd.Flags().Changed("name") {
+				tags["name"] = simName
+			}
+
+			if err := tagSim(client, simId, tags, os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&simName, "name", "", "Name of the SIM")
+	cmd.Flags().StringToStringVar(&simTags, "tag", nil, "Tag of the SIM in \"key=value\" form. Can be specified multiple times")
+
+	return cmd
+}
+
+func simGroupCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "group [SIM_ID]",
+		Short: "Set group of virtual SIM",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if (simGroupId != "") == unsetSimGroup {
+				log.Fatal("Either \"--group-id\" or \"--unset\" is required")
+			}
+
+			client, simId := newSimCommandClient(args)
+
+			if err := setSimGroup(client, simId, simGroupId, os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&simGroupId, "group-id", "", "ID of the group which the SIM will belong to")
+	cmd.Flags().BoolVar(&unsetSimGroup, "unset", false, "Remove the SIM from current group")
+
+	return cmd
+}
+
+func simSessionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "session",
+		Short: "Manage Arc session of virtual SIM",
+		Args:  cobra.NoArgs,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "delete [SIM_ID]",
+		Short: "Delete Arc session of virtual SIM",
+		Long:  "This command will delete current Arc session of the virtual SIM. The tunnel will be disconnected until a new session is created with \"soratun bootstrap\" or \"soratun rotate-keys\".",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client, simId := newSimCommandClient(args)
+
+			if err := client.DeleteArcSession(simId); err != nil {
+				log.Fatal(simError("delete Arc session of", simId, err))
+			}
+			fmt.Printf("Deleted Arc session of SIM %s\n", simId)
+		},
+	})
+
+	return cmd
+}
+
+// newSimCommandClient returns SORACOM API client created from the profile in the configuration file, and SIM ID which is
+// the first argument or "simId" in the configuration file.
+func newSimCommandClient(args []string) (soratun.SoracomClient, string) {
+	client, config := newSoracomClientFromConfig()
+
+	simId := config.SimId
+	if len(args) > 0 {
+		simId = args[0]
+	}
+	if simId == "" {
+		log.Fatal("No SIM ID is specified, and no \"simId\" found in the configuration file")
+	}
+
+	return client, simId
+}
+
+// newSoracomClientFromConfig returns SORACOM API client created from the profile in the configuration file, which can be
+// overridden with environment variables such as SORATUN_PROFILE_AUTH_KEY.
+func newSoracomClientFromConfig() (soratun.SoracomClient, *soratun.Config) {
+	config, err := readEffectiveConfig(configPath)
+	if err != nil {
+		log.Fatalf("Error: %s\n", err)
+	}
+
+	if config.Profile == nil {
+		log.Fatal("No SORACOM API profile found in the configuration file. Please bootstrap with \"soratun bootstrap authkey\"")
+	}
+
+	setMFACodeProvider(config.Profile)
+	client, err := soratun.NewDefaultSoracomClient(*config.Profile)
+	if err != nil {
+		log.Fatalf("Error: %s\n", err)
+	}
+
+	if v := os.Getenv("SORACOM_VERBOSE"); v != "" {
+		client.SetVerbose(true)
+	}
+
+	return client, config
+}
+
+// confirmSimTermination asks whether to terminate the SIM, and returns an error if declined. It is replaced in tests.
+var confirmSimTermination = func(simId string) error {
+	_, err := (&promptui.Prompt{
+		Label:     fmt.Sprintf("Terminate SIM %s? This can not be undone", simId),
+		IsConfirm: true,
+	}).Run()
+	return err
+}
+
+// listSims writes SIMs of the operator to w, in the format specified with "--output".
+func listSims(client soratun.SoracomClient, w io.Writer) error {
+	sims, err := client.ListSims(simType)
+	if err != nil {
+		if errors.Is(err, soratun.ErrSimForbidden) {
+			return fmt.Errorf("failed to list SIMs: %w. Allow \"Sim:listSims\" in the permission of the SAM user", err)
+		}
+		return fmt.Errorf("failed to list SIMs: %w", err)
+	}
+
+	if simOutputFormat == "json" {
+		b, err := json.MarshalIndent(redactSims(sims), "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to convert SIMs to JSON: %w", err)
+		}
+		fmt.Fprintln(w, string(b))
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SIM ID\tNAME\tTYPE\tSTATUS\tGROUP ID")
+	for _, sim := range sims {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", sim.SimId, sim.Name(), sim.Type, sim.Status, sim.GroupId)
+	}
+	return tw.Flush()
+}
+
+// terminateSim terminates the SIM after confirmation unless "--yes" is specified, and writes the SIM to w.
+func terminateSim(client soratun.SoracomClient, simId string, w io.Writer) error {
+	if !skipConfirm {
+		if err := confirmSimTermination(simId); err != nil {
+			return errors.New("aborted")
+		}
+	}
+
+	sim, err := client.TerminateSim(simId)
+	if err != nil {
+		return simError("terminate", simId, err)
+	}
+	printSim(w, sim)
+	return nil
+}
+
+// tagSim sets the tags to the SIM, and writes the SIM to w. The name of the SIM is the "name" tag.
+func tagSim(client soratun.SoracomClient, simId string, tags map[string]string, w io.Writer) error {
+	sim, err := client.PutSimTags(simId, tags)
+	if err != nil {
+		return simError("set tags to", simId, err)
+	}
+	printSim(w, sim)
+	return nil
+}
+
+// setSimGroup sets the group of the SIM, or removes the SIM from its group if groupId is empty, and writes the SIM to w.
+func setSimGroup(client soratun.SoracomClient, simId, groupId string, w io.Writer) error {
+	sim, err := client.SetSimGroup(simId, groupId)
+	if err != nil {
+		return simError("set group of", simId, err)
+	}
+	printSim(w, sim)
+	return nil
+}
+
+// simError returns an error of SIM API for the action, with a hint if the SIM is not found or the API is not allowed.
+func simError(action, simId string, err error) error {
+	switch {
+	case errors.Is(err, soratun.ErrSimNotFound):
+		return fmt.Errorf("failed to %s SIM %s: %w. Check the SIM ID with \"soratun sim list\"", action, simId, err)
+	case errors.Is(err, soratun.ErrSimForbidden):
+		return fmt.Errorf("failed to %s SIM %s: %w. Allow the API in the permission of the SAM user", action, simId, err)
+	default:
+		return fmt.Errorf("failed to %s SIM %s: %w", action, simId, err)
+	}
+}
+
+func printSim(w io.Writer, sim *soratun.VirtualSim) {
+	b, err := json.MarshalIndent(redactSims([]soratun.VirtualSim{*sim})[0], "", "  ")
+	if err != nil {
+		log.Fatalf("failed to convert SIM to JSON: %v", err)
+	}
+	fmt.Fprintln(w, string(b))
+}
+
+// redactSims removes WireGuard private keys from SIM profiles, which should not be shown.
+func redactSims(sims []soratun.VirtualSim) []soratun.VirtualSim {
+	redacted := make([]soratun.VirtualSim, 0, len(sims))
+	for _, sim := range sims {
+		profiles := make(map[string]soratun.SimProfile, len(sim.Profiles))
+		for k, p := range sim.Profiles {
+			p.ArcClientPeerPrivateKey = ""
+			profiles[k] = p
+		}
+		sim.Profiles = profiles
+		redacted = append(redacted, sim)
+	}
+	return redacted
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/soracom/soratun"
+	mock_soratun "github.com/soracom/soratun/internal/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func Test_listSims(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	client := mock_soratun.NewMockSoracomClient(ctrl)
+
+	simType, simOutputFormat = "virtual", "table"
+	defer func() {
+		simType, simOutputFormat = "", ""
+	}()
+
+	client.EXPECT().ListSims("virtual").Return([]soratun.VirtualSim{
+		{SimId: "8942310000000000001", Type: "virtual", Status: "active", Tags: map[string]string{"name": "edge"}, GroupId: "group"},
+	}, nil)
+	var out bytes.Buffer
+	assert.NoError(t, listSims(client, &out))
+	assert.Contains(t, out.String(), "SIM ID")
+	assert.Contains(t, out.String(), "8942310000000000001  edge")
+
+	client.EXPECT().ListSims("virtual").Return(nil, fmt.Errorf("%w: 403", soratun.ErrSimForbidden))
+	err := listSims(client, &out)
+	assert.ErrorIs(t, err, soratun.ErrSimForbidden)
+	assert.ErrorContains(t, err, "Sim:listSims")
+}
+
+func Test_terminateSim(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	client := mock_soratun.NewMockSoracomClient(ctrl)
+
+	confirm := confirmSimTermination
+	defer func() {
+		confirmSimTermination = confirm
+		skipConfirm = false
+	}()
+
+	// declined, TerminateSim is not called
+	confirmSimTermination = func(simId string) error {
+		assert.Equal(t, "8942310000000000001", simId)
+		return errors.New("^C")
+	}
+	var out bytes.Buffer
+	assert.EqualError(t, terminateSim(client, "8942310000000000001", &out), "aborted")
+	assert.Empty(t, out.String())
+
+	// confirmed
+	confirmSimTermination = func(string) error { return nil }
+	client.EXPECT().TerminateSim("8942310000000000001").Return(&soratun.VirtualSim{SimId: "8942310000000000001", Status: "terminated"}, nil)
+	assert.NoError(t, terminateSim(client, "8942310000000000001", &out))
+	assert.Contains(t, out.String(), `"status": "terminated"`)
+
+	// --yes skips confirmation
+	skipConfirm = true
+	confirmSimTermination = func(string) error {
+		t.Error("confirmation should be skipped")
+		return nil
+	}
+	client.EXPECT().TerminateSim("8942310000000000002").Return(nil, fmt.Errorf("%w: 404", soratun.ErrSimNotFound))
+	err := terminateSim(client, "8942310000000000002", &out)
+	assert.ErrorIs(t, err, soratun.ErrSimNotFound)
+	assert.ErrorContains(t, err, "soratun sim list")
+}
+
+func Test_tagSim(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	client := mock_soratun.NewMockSoracomClient(ctrl)
+
+	tags := map[string]string{"name": "edge", "site": "tokyo"}
+	client.EXPECT().PutSimTags("8942310000000000001", tags).Return(&soratun.VirtualSim{SimId: "8942310000000000001", Tags: tags}, nil)
+	var out bytes.Buffer
+	assert.NoError(t, tagSim(client, "8942310000000000001", tags, &out))
+	assert.Contains(t, out.String(), `"name": "edge"`)
+
+	client.EXPECT().PutSimTags("8942310000000000002", tags).Return(nil, fmt.Errorf("%w: 404", soratun.ErrSimNotFound))
+	assert.ErrorIs(t, tagSim(client, "8942310000000000002", tags, &out), soratun.ErrSimNotFound)
+
+	client.EXPECT().PutSimTags("8942310000000000003", tags).Return(nil, fmt.Errorf("%w: 403", soratun.ErrSimForbidden))
+	err := tagSim(client, "8942310000000000003", tags, &out)
+	assert.ErrorIs(t, err, soratun.ErrSimForbidden)
+	assert.ErrorContains(t, err, "permission of the SAM user")
+}
+
+func Test_setSimGroup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	client := mock_soratun.NewMockSoracomClient(ctrl)
+
+	client.EXPECT().SetSimGroup("8942310000000000001", "group").Return(&soratun.VirtualSim{SimId: "8942310000000000001", GroupId: "group"}, nil)
+	var out bytes.Buffer
+	assert.NoError(t, setSimGroup(client, "8942310000000000001", "group", &out))
+	assert.Contains(t, out.String(), `"groupId": "group"`)
+
+	// unset
+	client.EXPECT().SetSimGroup("8942310000000000001", "").Return(&soratun.VirtualSim{SimId: "8942310000000000001"}, nil)
+	assert.NoError(t, setSimGroup(client, "8942310000000000001", "", &out))
+
+	client.EXPECT().SetSimGroup("8942310000000000002", "group").Return(nil, fmt.Errorf("%w: 404", soratun.ErrSimNotFound))
+	assert.ErrorIs(t, setSimGroup(client, "8942310000000000002", "group", &out), soratun.ErrSimNotFound)
+
+	client.EXPECT().SetSimGroup("8942310000000000003", "group").Return(nil, fmt.Errorf("%w: 403", soratun.ErrSimForbidden))
+	assert.ErrorIs(t, setSimGroup(client, "8942310000000000003", "group", &out), soratun.ErrSimForbidden)
+}
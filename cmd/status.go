@@ -1,22 +1,47 @@
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"os/signal"
+	"sort"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/soracom/soratun"
 	"github.com/spf13/cobra"
 	"golang.zx2c4.com/wireguard/wgctrl"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	statusOutputFormat  string
+	statusWatch         bool
+	statusWatchInterval time.Duration
 )
 
 func statusCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:     "status",
 		Aliases: []string{"s"},
 		Short:   "Display SORACOM Arc interface status",
+		Long:    "Display status of SORACOM Arc interfaces managed by running soratun. If --config is specified, only the interface in the configuration file is displayed.",
 		Args:    cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
+			if statusOutputFormat != "text" && statusOutputFormat != "json" && statusOutputFormat != "yaml" {
+				log.Fatalf("Unknown output format %q, should be one of text, json, yaml", statusOutputFormat)
+			}
+
+			if statusWatch && statusOutputFormat != "text" {
+				log.Fatal("--watch can be used only with text output")
+			}
+
 			c, err := wgctrl.New()
 			if err != nil {
 				log.Fatalf("failed to open wgctrl: %v", err)
@@ -29,63 +54,321 @@ func statusCmd() *cobra.Command {
 				}
 			}()
 
-			var devices []*wgtypes.Device
-			devices, err = c.Devices()
-			if err != nil {
-				log.Fatalf("failed to get devices: %v", err)
+			useConfig := cmd.Flags().Changed("config")
+			if statusWatch {
+				// stop watching on Ctrl-C, so that wgctrl is closed
+				watchCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+				defer stop()
+				if err := watchStatuses(watchCtx, c, useConfig, statusWatchInterval, os.Stdout); err != nil {
+					log.Fatalf("Failed to get status: %v", err)
+				}
+				return
 			}
 
-			if len(devices) == 0 {
-				fmt.Println("no SORACOM Arc device found")
+			statuses, err := collectStatuses(c, useConfig, time.Now())
+			if err != nil {
+				log.Fatalf("Failed to get status: %v", err)
 			}
-			for _, d := range devices {
-				printDevice(d)
 
-				for _, p := range d.Peers {
-					printPeer(p)
-				}
+			if err := printStatuses(statuses, statusOutputFormat, os.Stdout); err != nil {
+				log.Fatalf("Failed to print status: %v", err)
 			}
 		},
 	}
+
+	cmd.Flags().StringVar(&statusOutputFormat, "output", "text", "Output format, \"text\", \"json\" or \"yaml\"")
+	cmd.Flags().BoolVar(&statusWatch, "watch", false, "Refresh status in place until interrupted, with throughput and recent traffic")
+	cmd.Flags().DurationVar(&statusWatchInterval, "interval", 2*time.Second, "Refresh interval for --watch")
+
+	return cmd
 }
 
-func printDevice(d *wgtypes.Device) {
-	const f = `interface: %s (%s)
-  public key: %s
-  private key: (hidden)
-  listening port: %d
+// collectStatuses returns status of tunnels. See statusTargets.
+func collectStatuses(c *wgctrl.Client, useConfig bool, now time.Time) ([]*interfaceStatus, error) {
+	targets, err := statusTargets(useConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find SORACOM Arc interfaces: %w", err)
+	}
 
-`
+	statuses := []*interfaceStatus{}
+	for _, t := range targets {
+		d, err := c.Device(t.Interface)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to get device %s: %w", t.Interface, err)
+		}
+		statuses = append(statuses, newInterfaceStatus(t, d, now))
+	}
+	return statuses, nil
+}
 
-	fmt.Printf(
-		f,
-		d.Name,
-		d.Type.String(),
-		d.PublicKey.String(),
-		d.ListenPort)
+// statusTargets returns tunnels to display. If useConfig is true, only the interface in the configuration file is
+// returned even if it is not up. Otherwise, tunnels managed by running soratun processes are returned.
+func statusTargets(useConfig bool) ([]*soratun.TunnelState, error) {
+	states, err := soratun.ReadTunnelStates()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Interface < states[j].Interface
+	})
+	if !useConfig {
+		return states, nil
+	}
+
+	config, err := readEffectiveConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range states {
+		if s.ConfiguredInterface == config.Interface || s.Interface == config.Interface {
+			return []*soratun.TunnelState{s}, nil
+		}
+	}
+
+	// the tunnel may be up without the state, e.g. by older soratun
+	s := &soratun.TunnelState{
+		Interface:           config.Interface,
+		ConfiguredInterface: config.Interface,
+		SimId:               config.SimId,
+	}
+	if config.ArcSession != nil {
+		s.ArcClientPeerIpAddress = config.ArcSession.ArcClientPeerIpAddress
+	}
+	return []*soratun.TunnelState{s}, nil
+}
+
+// interfaceStatus is status of a SORACOM Arc interface.
+type interfaceStatus struct {
+	Name                   string         `json:"name" yaml:"name"`
+	Type                   string         `json:"type,omitempty" yaml:"type,omitempty"`
+	SimId                  string         `json:"simId,omitempty" yaml:"simId,omitempty"`
+	ArcClientPeerIpAddress string         `json:"arcClientPeerIpAddress,omitempty" yaml:"arcClientPeerIpAddress,omitempty"`
+	PublicKey              string         `json:"publicKey,omitempty" yaml:"publicKey,omitempty"`
+	ListenPort             int            `json:"listenPort,omitempty" yaml:"listenPort,omitempty"`
+	Health                 soratun.Health `json:"health" yaml:"health"`
+	Peers                  []*peerStatus  `json:"peers" yaml:"peers"`
+	Probes                 []*probeStatus `json:"probes,omitempty" yaml:"probes,omitempty"`
+}
+
+// peerStatus is status of the SORACOM Arc server peer.
+type peerStatus struct {
+	PublicKey       string         `json:"publicKey" yaml:"publicKey"`
+	Endpoint        string         `json:"endpoint" yaml:"endpoint"`
+	AllowedIPs      []string       `json:"allowedIPs" yaml:"allowedIPs"`
+	LatestHandshake *time.Time     `json:"latestHandshake" yaml:"latestHandshake"`
+	HandshakeAge    *float64       `json:"handshakeAgeSeconds" yaml:"handshakeAgeSeconds"`
+	ReceivedBytes   int64          `json:"receivedBytes" yaml:"receivedBytes"`
+	SentBytes       int64          `json:"sentBytes" yaml:"sentBytes"`
+	Received        string         `json:"received" yaml:"received"`
+	Sent            string         `json:"sent" yaml:"sent"`
+	Health          soratun.Health `json:"health" yaml:"health"`
+}
+
+// probeStatus is results of connectivity probes to a target, written by running soratun.
+type probeStatus struct {
+	Target      string         `json:"target" yaml:"target"`
+	Type        string         `json:"type" yaml:"type"`
+	Address     string         `json:"address" yaml:"address"`
+	Sent        int            `json:"sent" yaml:"sent"`
+	Lost        int            `json:"lost" yaml:"lost"`
+	Loss        float64        `json:"loss" yaml:"loss"`
+	RTT         float64        `json:"rttSeconds" yaml:"rttSeconds"`
+	AverageRTT  float64        `json:"averageRttSeconds" yaml:"averageRttSeconds"`
+	Jitter      float64        `json:"jitterSeconds" yaml:"jitterSeconds"`
+	LastProbeAt time.Time      `json:"lastProbeAt" yaml:"lastProbeAt"`
+	LastError   string         `json:"lastError,omitempty" yaml:"lastError,omitempty"`
+	Health      soratun.Health `json:"health" yaml:"health"`
 }
 
-func printPeer(p wgtypes.Peer) {
+// newInterfaceStatus returns status of the tunnel. d is nil if the interface is not found, and then the tunnel is down.
+func newInterfaceStatus(s *soratun.TunnelState, d *wgtypes.Device, now time.Time) *interfaceStatus {
+	status := &interfaceStatus{
+		Name:   s.Interface,
+		SimId:  s.SimId,
+		Health: soratun.HealthDown,
+		Peers:  []*peerStatus{},
+	}
+	if s.ArcClientPeerIpAddress != nil {
+		status.ArcClientPeerIpAddress = s.ArcClientPeerIpAddress.String()
+	}
+	if d == nil {
+		return status
+	}
+
+	status.Type = d.Type.String()
+	status.PublicKey = d.PublicKey.String()
+	status.ListenPort = d.ListenPort
+
+	for i, p := range d.Peers {
+		ps := newPeerStatus(p, now)
+		// the tunnel is as healthy as its worst peer, though soratun has only one peer
+		if i == 0 {
+			status.Health = ps.Health
+		} else {
+			status.Health = soratun.WorseHealth(status.Health, ps.Health)
+		}
+		status.Peers = append(status.Peers, ps)
+	}
+
+	for _, r := range s.Probes {
+		status.Probes = append(status.Probes, &probeStatus{
+			Target:      r.Target,
+			Type:        r.Type,
+			Address:     r.Address,
+			Sent:        r.Sent,
+			Lost:        r.Lost,
+			Loss:        r.Loss,
+			RTT:         r.RTT,
+			AverageRTT:  r.AverageRTT,
+			Jitter:      r.Jitter,
+			LastProbeAt: r.LastProbeAt,
+			LastError:   r.LastError,
+			Health:      r.Health,
+		})
+	}
+	status.Health = soratun.WorseHealth(status.Health, soratun.ProbeHealth(s.Probes))
+	return status
+}
+
+func newPeerStatus(p wgtypes.Peer, now time.Time) *peerStatus {
+	ps := &peerStatus{
+		PublicKey:     p.PublicKey.String(),
+		AllowedIPs:    []string{},
+		ReceivedBytes: p.ReceiveBytes,
+		SentBytes:     p.TransmitBytes,
+		Received:      humanBytes(p.ReceiveBytes),
+		Sent:          humanBytes(p.TransmitBytes),
+		Health:        soratun.PeerHealth(p.LastHandshakeTime, now),
+	}
+	if p.Endpoint != nil {
+		ps.Endpoint = p.Endpoint.String()
+	}
+	for _, ip := range p.AllowedIPs {
+		ps.AllowedIPs = append(ps.AllowedIPs, ip.String())
+	}
+	if !p.LastHandshakeTime.IsZero() {
+		t := p.LastHandshakeTime
+		age := now.Sub(t).Truncate(time.Second).Seconds()
+		ps.LatestHandshake = &t
+		ps.HandshakeAge = &age
+	}
+	return ps
+}
+
+func printStatuses(statuses []*interfaceStatus, format string, w io.Writer) error {
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(statuses, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case "yaml":
+		e := yaml.NewEncoder(w)
+		e.SetIndent(2)
+		if err := e.Encode(statuses); err != nil {
+			return err
+		}
+		return e.Close()
+	}
+
+	if len(statuses) == 0 {
+		fmt.Fprintln(w, "no SORACOM Arc device found")
+	}
+	for _, s := range statuses {
+		printDevice(s, w)
+
+		for _, p := range s.Peers {
+			printPeer(p, w)
+		}
+
+		for _, p := range s.Probes {
+			printProbe(p, w)
+		}
+	}
+	return nil
+}
+
+func printDevice(s *interfaceStatus, w io.Writer) {
+	typ := s.Type
+	if typ == "" {
+		typ = "not found"
+	}
+
+	fmt.Fprintf(w, "interface: %s (%s)\n", s.Name, typ)
+	if s.SimId != "" {
+		fmt.Fprintf(w, "  sim id: %s\n", s.SimId)
+	}
+	if s.ArcClientPeerIpAddress != "" {
+		fmt.Fprintf(w, "  client ip: %s\n", s.ArcClientPeerIpAddress)
+	}
+	if s.Type != "" {
+		fmt.Fprintf(w, `  public key: %s
+  private key: (hidden)
+  listening port: %d
+`, s.PublicKey, s.ListenPort)
+	}
+	fmt.Fprintf(w, "  health: %s\n\n", s.Health)
+}
+
+func printPeer(p *peerStatus, w io.Writer) {
 	const f = `peer: %s
   endpoint: %s
   allowed ips: %s
   latest handshake: %s
-  transfer: %d B received, %d B sent
+  transfer: %s received, %s sent
 
 `
 
-	ips := make([]string, 0, len(p.AllowedIPs))
-	for _, ip := range p.AllowedIPs {
-		ips = append(ips, ip.String())
+	handshake := "(none)"
+	if p.HandshakeAge != nil {
+		handshake = fmt.Sprintf("%s ago", time.Duration(*p.HandshakeAge)*time.Second)
 	}
 
-	fmt.Printf(
+	fmt.Fprintf(
+		w,
 		f,
-		p.PublicKey.String(),
-		p.Endpoint.String(),
-		strings.Join(ips, ", "),
-		p.LastHandshakeTime.String(),
-		p.ReceiveBytes,
-		p.TransmitBytes,
+		p.PublicKey,
+		p.Endpoint,
+		strings.Join(p.AllowedIPs, ", "),
+		handshake,
+		p.Received,
+		p.Sent,
 	)
 }
+
+func printProbe(p *probeStatus, w io.Writer) {
+	fmt.Fprintf(w, "probe: %s\n", p.Target)
+	if p.Target != fmt.Sprintf("%s %s", p.Type, p.Address) {
+		fmt.Fprintf(w, "  target: %s %s\n", p.Type, p.Address)
+	}
+	fmt.Fprintf(w, "  rtt: %s (average %s), jitter: %s\n", milliseconds(p.RTT), milliseconds(p.AverageRTT), milliseconds(p.Jitter))
+	fmt.Fprintf(w, "  loss: %.0f%% (%d/%d)\n", p.Loss*100, p.Lost, p.Sent)
+	if p.LastError != "" {
+		fmt.Fprintf(w, "  last error: %s\n", p.LastError)
+	}
+	fmt.Fprintf(w, "  health: %s\n\n", p.Health)
+}
+
+// milliseconds formats seconds in milliseconds, e.g. "12.3 ms".
+func milliseconds(seconds float64) string {
+	return fmt.Sprintf("%.1f ms", seconds*1000)
+}
+
+// humanBytes formats n bytes in binary units, e.g. "1.50 KiB".
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	v := float64(n)
+	for _, u := range []string{"KiB", "MiB", "GiB", "TiB"} {
+		v /= unit
+		if v < unit || u == "TiB" {
+			return fmt.Sprintf("%.2f %s", v, u)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/soracom/soratun"
+	"github.com/stretchr/testify/assert"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func Test_newInterfaceStatus(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	state := &soratun.TunnelState{
+		Interface:              "soratun0",
+		SimId:                  "8942310022000000000",
+		ArcClientPeerIpAddress: net.IPv4(10, 0, 0, 1),
+	}
+
+	serverKey, err := wgtypes.GeneratePrivateKey()
+	assert.NoError(t, err)
+	d := &wgtypes.Device{
+		Name: "soratun0",
+		Type: wgtypes.Userspace,
+		Peers: []wgtypes.Peer{{
+			PublicKey:         serverKey.PublicKey(),
+			Endpoint:          &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 11010},
+			LastHandshakeTime: now.Add(-65 * time.Second),
+			ReceiveBytes:      1536,
+			TransmitBytes:     100,
+			AllowedIPs:        []net.IPNet{{IP: net.IPv4(100, 127, 0, 0), Mask: net.IPv4Mask(255, 255, 0, 0)}},
+		}},
+	}
+
+	s := newInterfaceStatus(state, d, now)
+	assert.Equal(t, soratun.HealthHealthy, s.Health)
+	assert.Equal(t, "10.0.0.1", s.ArcClientPeerIpAddress)
+
+	var b bytes.Buffer
+	assert.NoError(t, printStatuses([]*interfaceStatus{s}, "text", &b))
+	assert.Contains(t, b.String(), "  sim id: 8942310022000000000\n")
+	assert.Contains(t, b.String(), "  latest handshake: 1m5s ago\n")
+	assert.Contains(t, b.String(), "  transfer: 1.50 KiB received, 100 B sent\n")
+
+	b.Reset()
+	assert.NoError(t, printStatuses([]*interfaceStatus{s}, "json", &b))
+	var decoded []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b.Bytes(), &decoded))
+	assert.Equal(t, "healthy", decoded[0]["health"])
+	assert.Equal(t, float64(65), decoded[0]["peers"].([]interface{})[0].(map[string]interface{})["handshakeAgeSeconds"])
+
+	// connectivity probes are degraded
+	state.Probes = []soratun.ProbeResult{{
+		Target:     "arc-gateway",
+		Type:       "icmp",
+		Address:    "100.127.0.1",
+		Sent:       20,
+		Lost:       1,
+		Loss:       0.05,
+		RTT:        0.0123,
+		AverageRTT: 0.011,
+		Jitter:     0.0012,
+		Health:     soratun.HealthDegraded,
+	}}
+	s = newInterfaceStatus(state, d, now)
+	assert.Equal(t, soratun.HealthDegraded, s.Health)
+	b.Reset()
+	assert.NoError(t, printStatuses([]*interfaceStatus{s}, "text", &b))
+	assert.Contains(t, b.String(), `probe: arc-gateway
+  target: icmp 100.127.0.1
+  rtt: 12.3 ms (average 11.0 ms), jitter: 1.2 ms
+  loss: 5% (1/20)
+  health: degraded
+`)
+	state.Probes = nil
+
+	// no handshake yet
+	d.Peers[0].LastHandshakeTime = time.Time{}
+	s = newInterfaceStatus(state, d, now)
+	assert.Equal(t, soratun.HealthDown, s.Health)
+	b.Reset()
+	assert.NoError(t, printStatuses([]*interfaceStatus{s}, "yaml", &b))
+	assert.Contains(t, b.String(), "latestHandshake: null\n")
+
+	// interface not found
+	s = newInterfaceStatus(state, nil, now)
+	assert.Equal(t, soratun.HealthDown, s.Health)
+	b.Reset()
+	assert.NoError(t, printStatuses([]*interfaceStatus{s}, "text", &b))
+	assert.Contains(t, b.String(), "interface: soratun0 (not found)\n")
+}
+
+func Test_humanBytes(t *testing.T) {
+	assert.Equal(t, "0 B", humanBytes(0))
+	assert.Equal(t, "1023 B", humanBytes(1023))
+	assert.Equal(t, "1.00 KiB", humanBytes(1024))
+	assert.Equal(t, "2.50 MiB", humanBytes(5*1024*1024/2))
+	assert.Equal(t, "3.00 GiB", humanBytes(3*1024*1024*1024))
+}
@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/soracom/soratun"
+	"golang.zx2c4.com/wireguard/wgctrl"
+)
+
+const (
+	// sparklineSamples is the number of recent throughput samples shown as a sparkline.
+	sparklineSamples = 30
+	// endpointChangesShown is the number of recent endpoint changes shown for each tunnel.
+	endpointChangesShown = 3
+)
+
+var sparklineBars = []rune("▁▂▃▄▅▆▇█")
+
+// tunnelHistory holds samples of a tunnel taken by statusWatcher.
+type tunnelHistory struct {
+	at              time.Time
+	received        int64
+	sent            int64
+	receiveRate     float64
+	sendRate        float64
+	rates           []float64
+	endpoint        string
+	endpointChanges []endpointChange
+}
+
+type endpointChange struct {
+	at   time.Time
+	from string
+	to   string
+}
+
+// statusWatcher computes throughput and endpoint changes from statuses taken periodically, and renders them.
+type statusWatcher struct {
+	color   bool
+	history map[string]*tunnelHistory
+}
+
+func newStatusWatcher(color bool) *statusWatcher {
+	return &statusWatcher{
+		color:   color,
+		history: map[string]*tunnelHistory{},
+	}
+}
+
+// watchStatuses refreshes status of tunnels on out every interval, until ctx is done.
+func watchStatuses(ctx context.Context, c *wgctrl.Client, useConfig bool, interval time.Duration, out *os.File) error {
+	if interval <= 0 {
+		return fmt.Errorf("--interval should be positive, but got %s", interval)
+	}
+
+	terminal := isTerminal(out)
+	w := newStatusWatcher(terminal && os.Getenv("NO_COLOR") == "")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		statuses, err := collectStatuses(c, useConfig, now)
+		if err != nil {
+			return err
+		}
+		w.update(statuses, now)
+
+		var b bytes.Buffer
+		if terminal {
+			// move the cursor to the top left and clear the screen, so that status is refreshed in place
+			b.WriteString("\x1b[H\x1b[2J")
+		}
+		w.render(statuses, now, interval, &b)
+		if _, err := out.Write(b.Bytes()); err != nil {
+			return err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// update takes new samples from statuses taken at now.
+func (w *statusWatcher) update(statuses []*interfaceStatus, now time.Time) {
+	seen := map[string]bool{}
+	for _, s := range statuses {
+		seen[s.Name] = true
+
+		var received, sent int64
+		endpoint := ""
+		for _, p := range s.Peers {
+			received += p.ReceivedBytes
+			sent += p.SentBytes
+			if endpoint == "" {
+				endpoint = p.Endpoint
+			}
+		}
+
+		h, ok := w.history[s.Name]
+		if !ok {
+			w.history[s.Name] = &tunnelHistory{at: now, received: received, sent: sent, endpoint: endpoint}
+			continue
+		}
+
+		if elapsed := now.Sub(h.at).Seconds(); elapsed > 0 {
+			// counters are reset if the tunnel has been recreated
+			h.receiveRate = math.Max(0, float64(received-h.received)/elapsed)
+			h.sendRate = math.Max(0, float64(sent-h.sent)/elapsed)
+			h.rates = append(h.rates, h.receiveRate+h.sendRate)
+			if len(h.rates) > sparklineSamples {
+				h.rates = h.rates[len(h.rates)-sparklineSamples:]
+			}
+		}
+
+		if endpoint != h.endpoint && endpoint != "" && h.endpoint != "" {
+			h.endpointChanges = append(h.endpointChanges, endpointChange{at: now, from: h.endpoint, to: endpoint})
+			if len(h.endpointChanges) > endpointChangesShown {
+				h.endpointChanges = h.endpointChanges[len(h.endpointChanges)-endpointChangesShown:]
+			}
+		}
+		if endpoint != "" {
+			h.endpoint = endpoint
+		}
+
+		h.at = now
+		h.received = received
+		h.sent = sent
+	}
+
+	for name := range w.history {
+		if !seen[name] {
+			delete(w.history, name)
+		}
+	}
+}
+
+// render writes the dashboard of statuses to out.
+func (w *statusWatcher) render(statuses []*interfaceStatus, now time.Time, interval time.Duration, out io.Writer) {
+	fmt.Fprintf(out, "soratun status, every %s: %s (press Ctrl-C to quit)\n\n", interval, now.Format("2006-01-02 15:04:05"))
+
+	if len(statuses) == 0 {
+		fmt.Fprintln(out, "no SORACOM Arc device found")
+	}
+
+	for _, s := range statuses {
+		fmt.Fprintf(out, "%s  %s", s.Name, w.colorize(s.Health, string(s.Health)))
+		if s.SimId != "" {
+			fmt.Fprintf(out, "  sim id: %s", s.SimId)
+		}
+		if s.ArcClientPeerIpAddress != "" {
+			fmt.Fprintf(out, "  client ip: %s", s.ArcClientPeerIpAddress)
+		}
+		fmt.Fprintln(out)
+
+		if s.Type == "" {
+			fmt.Fprintf(out, "  interface not found\n\n")
+			continue
+		}
+
+		for _, p := range s.Peers {
+			handshake := "(none)"
+			if p.HandshakeAge != nil {
+				handshake = fmt.Sprintf("%s ago", time.Duration(*p.HandshakeAge)*time.Second)
+			}
+			fmt.Fprintf(out, "  endpoint:         %s\n", p.Endpoint)
+			fmt.Fprintf(out, "  latest handshake: %s\n", w.colorize(p.Health, handshake))
+		}
+
+		h := w.history[s.Name]
+		if h == nil {
+			fmt.Fprintln(out)
+			continue
+		}
+		for _, c := range h.endpointChanges {
+			fmt.Fprintf(out, "  endpoint changed: %s -> %s at %s\n", c.from, c.to, c.at.Format("15:04:05"))
+		}
+		if len(h.rates) == 0 {
+			fmt.Fprintf(out, "  throughput:       (measuring)\n")
+		} else {
+			fmt.Fprintf(out, "  throughput:       %s/s received, %s/s sent\n", humanBytes(int64(h.receiveRate)), humanBytes(int64(h.sendRate)))
+		}
+		fmt.Fprintf(out, "  transfer:         %s received, %s sent\n", humanBytes(h.received), humanBytes(h.sent))
+		fmt.Fprintf(out, "  recent traffic:   %s\n", sparkline(h.rates))
+		for _, p := range s.Probes {
+			fmt.Fprintf(out, "  probe %s: %s\n", p.Target, w.colorize(p.Health, fmt.Sprintf("rtt %s, jitter %s, loss %.0f%%", milliseconds(p.RTT), milliseconds(p.Jitter), p.Loss*100)))
+		}
+		fmt.Fprintln(out)
+	}
+}
+
+// colorize colors s with the color for health: green for healthy, yellow for stale or degraded, and red for down.
+func (w *statusWatcher) colorize(health soratun.Health, s string) string {
+	if !w.color {
+		return s
+	}
+
+	color := "31"
+	switch health {
+	case soratun.HealthHealthy:
+		color = "32"
+	case soratun.HealthStale, soratun.HealthDegraded:
+		color = "33"
+	}
+	return fmt.Sprintf("\x1b[%sm%s\x1b[0m", color, s)
+}
+
+// sparkline renders values as bars, scaled to the maximum value.
+func sparkline(values []float64) string {
+	peak := 0.0
+	for _, v := range values {
+		peak = math.Max(peak, v)
+	}
+
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if peak > 0 {
+			i = int(v / peak * float64(len(sparklineBars)-1))
+		}
+		b.WriteRune(sparklineBars[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/soracom/soratun"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_statusWatcher(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	age := 10.0
+	sample := func(endpoint string, received, sent int64) []*interfaceStatus {
+		return []*interfaceStatus{{
+			Name:   "soratun0",
+			Type:   "userspace",
+			Health: soratun.HealthHealthy,
+			Peers: []*peerStatus{{
+				Endpoint:      endpoint,
+				HandshakeAge:  &age,
+				ReceivedBytes: received,
+				SentBytes:     sent,
+				Health:        soratun.HealthHealthy,
+			}},
+		}}
+	}
+
+	w := newStatusWatcher(false)
+	w.update(sample("192.0.2.1:11010", 0, 0), now)
+	var b bytes.Buffer
+	w.render(sample("192.0.2.1:11010", 0, 0), now, 2*time.Second, &b)
+	assert.Contains(t, b.String(), "  throughput:       (measuring)\n")
+
+	w.update(sample("192.0.2.1:11010", 2048, 200), now.Add(2*time.Second))
+	s := sample("192.0.2.2:11010", 4096, 400)
+	w.update(s, now.Add(4*time.Second))
+	b.Reset()
+	w.render(s, now.Add(4*time.Second), 2*time.Second, &b)
+	assert.Contains(t, b.String(), "  throughput:       1.00 KiB/s received, 100 B/s sent\n")
+	assert.Contains(t, b.String(), "  endpoint changed: 192.0.2.1:11010 -> 192.0.2.2:11010 at 12:00:04\n")
+	assert.Contains(t, b.String(), "  recent traffic:   ██\n")
+	assert.NotContains(t, b.String(), "\x1b[")
+
+	// counters are reset
+	w.update(sample("192.0.2.2:11010", 0, 0), now.Add(6*time.Second))
+	assert.Equal(t, 0.0, w.history["soratun0"].receiveRate)
+
+	w.update(nil, now.Add(8*time.Second))
+	assert.Empty(t, w.history)
+}
+
+func Test_sparkline(t *testing.T) {
+	assert.Equal(t, "", sparkline(nil))
+	assert.Equal(t, "▁▁", sparkline([]float64{0, 0}))
+	assert.Equal(t, "▁▄█", sparkline([]float64{0, 50, 100}))
+}
+
+func Test_statusWatcher_colorize(t *testing.T) {
+	w := newStatusWatcher(true)
+	assert.Equal(t, "\x1b[32mhealthy\x1b[0m", w.colorize(soratun.HealthHealthy, "healthy"))
+	assert.Equal(t, "\x1b[33mstale\x1b[0m", w.colorize(soratun.HealthStale, "stale"))
+	assert.Equal(t, "\x1b[31mdown\x1b[0m", w.colorize(soratun.HealthDown, "down"))
+}
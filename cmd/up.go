@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -14,10 +13,13 @@ import (
 )
 
 var (
-	mtu                  int
-	persistentKeepalive  int
-	additionalAllowedIPs string
-	readStdin            bool
+	mtu                   int
+	persistentKeepalive   int
+	additionalAllowedIPs  string
+	readStdin             bool
+	preflightTimeout      int
+	preflightRenewSession bool
+	tunFd                 int
 )
 
 func upCmd() *cobra.Command {
@@ -33,12 +35,11 @@ func upCmd() *cobra.Command {
 					log.Fatalf("Failed to read configuration from stdin: %v", err)
 				}
 
-				var config soratun.Config
-				err = json.Unmarshal(b, &config)
+				config, err := parseEffectiveConfig(b)
 				if err != nil {
 					log.Fatalf("Failed to read configuration from stdin: %v", err)
 				}
-				Config = &config
+				Config = config
 			} else {
 				initSoratun(cmd, args)
 			}
@@ -52,6 +53,22 @@ func upCmd() *cobra.Command {
 				Config.PersistentKeepalive = persistentKeepalive
 			}
 
+			if cmd.Flags().Changed("tun-fd") {
+				Config.TunFd = tunFd
+			}
+
+			if cmd.Flags().Changed("preflight-timeout") || cmd.Flags().Changed("preflight-renew-session") {
+				if Config.Preflight == nil {
+					Config.Preflight = &soratun.PreflightOptions{}
+				}
+				if cmd.Flags().Changed("preflight-timeout") {
+					Config.Preflight.Timeout = preflightTimeout
+				}
+				if cmd.Flags().Changed("preflight-renew-session") {
+					Config.Preflight.RenewSession = preflightRenewSession
+				}
+			}
+
 			if Config.ArcSession == nil {
 				log.Fatal("Failed to determine connection information. Please bootstrap or create a new session from the user console.")
 			}
@@ -62,26 +79,51 @@ func upCmd() *cobra.Command {
 					if err != nil {
 						log.Fatalf("Invalid CIDR is set for \"--additional-allowd-ips\": %v", err)
 					}
-					Config.ArcSession.ArcAllowedIPs = append(Config.ArcSession.ArcAllowedIPs, &soratun.IPNet{
+					Config.AdditionalAllowedIPs = append(Config.AdditionalAllowedIPs, &soratun.IPNet{
 						IP:   ipnet.IP,
 						Mask: ipnet.Mask,
 					})
 				}
 			}
 
+			invalid := false
+			for _, e := range Config.Validate() {
+				log.Printf("Configuration: %s", e)
+				invalid = invalid || !e.Warning
+			}
+			if invalid {
+				log.Fatal("Invalid configuration. Please fix the problems above, or run \"soratun config validate\" for details.")
+			}
+
 			if v := os.Getenv("SORACOM_VERBOSE"); v != "" {
 				fmt.Fprintln(os.Stderr, "--- WireGuard configuration ----------------------")
 				dumpWireGuardConfig(true, os.Stderr)
 				fmt.Fprintln(os.Stderr, "--- End of WireGuard configuration ---------------")
 			}
 
-			soratun.Up(ctx, Config)
+			var opts []soratun.UpOption
+			if !readStdin {
+				if Config.KeyRotationInterval > 0 || (Config.Preflight != nil && Config.Preflight.RenewSession) {
+					if err := checkSecretRefUpdatable("privateKey"); err != nil {
+						log.Fatalf("Key rotation and session renewal require updating the private key: %v", err)
+					}
+				}
+				opts = append(opts, soratun.WithConfigUpdatedHandler(persistArcSessionWithLock))
+				opts = append(opts, soratun.WithConfigReloader(func() (*soratun.Config, error) {
+					return readEffectiveConfig(configPath)
+				}))
+			}
+
+			soratun.Up(ctx, Config, opts...)
 		},
 	}
 
 	cmd.Flags().IntVar(&mtu, "mtu", soratun.DefaultMTU, "MTU for the interface, which will override arc.json#mtu value")
 	cmd.Flags().IntVar(&persistentKeepalive, "persistent-keepalive", soratun.DefaultPersistentKeepaliveInterval, "WireGuard \"PersistentKeepalive\" for the SORACOM Arc server, which will override arc.json#persistentKeepalive value")
 	cmd.Flags().StringVar(&additionalAllowedIPs, "additional-allowed-ips", "", "Comma separated string of additional WireGuard allowed CIDRs, which will be added to arc.json#additionalAllowedIPs array")
+	cmd.Flags().IntVar(&tunFd, "tun-fd", 0, "File descriptor of a TUN device inherited from the parent process to attach to, instead of creating a new one, which will override arc.json#tunFd value")
+	cmd.Flags().IntVar(&preflightTimeout, "preflight-timeout", 0, "Seconds to wait for the pre-flight WireGuard handshake with the SORACOM Arc server before creating the interface, which will override arc.json#preflight.timeout value. 0 disables the probe")
+	cmd.Flags().BoolVar(&preflightRenewSession, "preflight-renew-session", false, "Renew the key pair and Arc session if the pre-flight handshake times out, which will override arc.json#preflight.renewSession value")
 	cmd.Flags().BoolVar(&readStdin, "read-stdin", false, "read configuration from stdin, ignoring --config setting")
 
 	return cmd
@@ -12,6 +12,9 @@ import (
 
 const arcServerEndpointDefaultPort string = "11010"
 
+// CurrentConfigVersion is the version of the configuration format which this version of soratun writes.
+const CurrentConfigVersion = 1
+
 // UDPAddr represents the UDP address with keeping original endpoint.
 type UDPAddr struct {
 	IP          net.IP
@@ -29,6 +32,8 @@ type (
 
 // Config holds SORACOM Arc client configurations.
 type Config struct {
+	// ConfigVersion is the version of the configuration format. Older configuration is migrated to CurrentConfigVersion.
+	ConfigVersion int `json:"configVersion,omitempty"`
 	// PrivateKey is WireGuard private key.
 	PrivateKey Key `json:"privateKey"`
 	// PublicKey is WireGuard public key.
@@ -39,22 +44,101 @@ type Config struct {
 	LogLevel int `json:"logLevel"`
 	// If EnableMetrics is true, metrics will be logged when log-level is verbose.
 	EnableMetrics bool `json:"enableMetrics"`
+	// HealthListen is an address such as "127.0.0.1:9000" to serve the tunnel health over HTTP at /health. Empty
+	// disables the endpoint.
+	HealthListen string `json:"healthListen,omitempty"`
 	// Interface is name for the tunnel interface.
 	Interface string `json:"interface"`
 	// AdditionalAllowedIPs holds a set of WireGuard allowed IPs in addition to the list which will get while creating Arc session.
 	AdditionalAllowedIPs []*IPNet `json:"additionalAllowedIPs,omitempty"`
 	// Mtu of the interface.
 	Mtu int `json:"mtu,omitempty"`
-	// WireGuard PersistentKeepalive parameter.
+	// TunFd is a file descriptor of a TUN device inherited from the parent process, such as a supervisor. 0 creates
+	// a new TUN device.
+	TunFd int `json:"tunFd,omitempty"`
+	// If UsePersistentTun is true, soratun attaches to the persistent TUN device named Interface, which is pre-created
+	// with e.g. "ip tuntap add mode tun", instead of creating a new one.
+	UsePersistentTun bool `json:"usePersistentTun,omitempty"`
+	// If SkipInterfaceConfiguration is true, addresses, routes, MTU and the link state of the interface are left as
+	// they are, to be configured by others. soratun can run without any privileges along with TunFd or
+	// UsePersistentTun.
+	SkipInterfaceConfiguration bool `json:"skipInterfaceConfiguration,omitempty"`
+	// WireGuard PersistentKeepalive parameter in seconds. A negative value, PersistentKeepaliveOff, disables it.
 	PersistentKeepalive int `json:"persistentKeepalive,omitempty"`
+	// KeyRotationInterval is an interval in seconds to rotate WireGuard key pair while the tunnel is up. 0 disables the rotation.
+	KeyRotationInterval int `json:"keyRotationInterval,omitempty"`
+	// Preflight configures the pre-flight handshake probe before the interface is up.
+	Preflight *PreflightOptions `json:"preflight,omitempty"`
+	// Probes configures connectivity probes through the tunnel while the tunnel is up.
+	Probes *ProbeOptions `json:"probes,omitempty"`
+	// Watchdog configures how the tunnel health is decided for the systemd watchdog.
+	Watchdog *WatchdogOptions `json:"watchdog,omitempty"`
 	// PostUp is array of commands which will be executed after the interface is up successfully.
 	PostUp [][]string `json:"postUp,omitempty"`
 	// PostDown is array of commands which will be executed after the interface is removed successfully.
 	PostDown [][]string `json:"postDown,omitempty"`
+	// User is the user to run soratun as, after the tunnel interface is set up as root. Only CAP_NET_ADMIN is kept.
+	// Empty keeps running as the current user.
+	User string `json:"user,omitempty"`
+	// Group is the group to run soratun as. Defaults to the primary group of User.
+	Group string `json:"group,omitempty"`
+	// HookUser is the user to run PostUp and PostDown commands as. Defaults to the user soratun runs as.
+	HookUser string `json:"hookUser,omitempty"`
+	// HookGroup is the group to run PostUp and PostDown commands as. Defaults to the primary group of HookUser.
+	HookGroup string `json:"hookGroup,omitempty"`
 	// Profile is for SORACOM API access.
 	Profile *Profile `json:"profile,omitempty"`
+	// VirtualSim holds settings for a new virtual SIM, which will be used while bootstrapping with SORACOM API.
+	VirtualSim *VirtualSimOptions `json:"virtualSim,omitempty"`
 	// ArcSession holds connection information provided from SORACOM Arc server.
-	ArcSession *ArcSession `json:"arcSessionStatus,omitempty"`
+	ArcSession *ArcSession `json:"arcSession,omitempty"`
+}
+
+// PreflightOptions configures the pre-flight handshake probe, which checks the Arc session from an ephemeral device
+// before the interface is up. See ProbeHandshake.
+type PreflightOptions struct {
+	// Timeout is seconds to wait for the handshake response. 0 disables the probe.
+	Timeout int `json:"timeout,omitempty"`
+	// RenewSession creates a new key pair and Arc session with Profile if the server does not respond, then retries the
+	// probe once.
+	RenewSession bool `json:"renewSession,omitempty"`
+}
+
+// ProbeOptions configures connectivity probes, which check that packets flow to SORACOM Arc side through the tunnel.
+type ProbeOptions struct {
+	// Interval is seconds between probes. Defaults to DefaultProbeInterval.
+	Interval int `json:"interval,omitempty"`
+	// Timeout is seconds to wait for each probe. Defaults to DefaultProbeTimeout.
+	Timeout int `json:"timeout,omitempty"`
+	// Targets are probed at every interval.
+	Targets []*ProbeTarget `json:"targets"`
+}
+
+// ProbeTarget is a target of connectivity probes.
+type ProbeTarget struct {
+	// Name is shown in status and metrics instead of the type and the address.
+	Name string `json:"name,omitempty"`
+	// Type is "icmp" for ICMP echo, or "tcp" for TCP connect.
+	Type string `json:"type"`
+	// Address is an IP address or a host name for "icmp", and "host:port" for "tcp".
+	Address string `json:"address"`
+}
+
+// String returns the name of the target.
+func (t *ProbeTarget) String() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return fmt.Sprintf("%s %s", t.Type, t.Address)
+}
+
+// WatchdogOptions configures DefaultHealthPolicy, which decides whether to update the systemd watchdog timer.
+type WatchdogOptions struct {
+	// StartupGrace is seconds after the start during which the tunnel is considered alive without any handshake.
+	// Defaults to DefaultWatchdogStartupGrace.
+	StartupGrace int `json:"startupGrace,omitempty"`
+	// IgnoreProbes ignores results of connectivity probes.
+	IgnoreProbes bool `json:"ignoreProbes,omitempty"`
 }
 
 // ArcSession holds SORACOM Arc configurations received from the server.
@@ -71,6 +155,16 @@ type ArcSession struct {
 	ArcClientPeerIpAddress net.IP `json:"arcClientPeerIpAddress,omitempty"`
 }
 
+// AllowedIPs returns WireGuard allowed IPs for the SORACOM Arc server peer, which consist of IPs received while creating
+// Arc session and AdditionalAllowedIPs.
+func (c *Config) AllowedIPs() []*IPNet {
+	var ips []*IPNet
+	if c.ArcSession != nil {
+		ips = append(ips, c.ArcSession.ArcAllowedIPs...)
+	}
+	return append(ips, c.AdditionalAllowedIPs...)
+}
+
 // NewKey returns a Key from a base64-encoded string.
 func NewKey(s string) (Key, error) {
 	key, err := wgtypes.ParseKey(s)
@@ -80,6 +174,15 @@ func NewKey(s string) (Key, error) {
 	return Key(key), nil
 }
 
+// GenerateKeyPair generates a new WireGuard private key and its public key locally.
+func GenerateKeyPair() (privateKey Key, publicKey Key, err error) {
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		return Key{}, Key{}, err
+	}
+	return Key(key), Key(key.PublicKey()), nil
+}
+
 // UnmarshalText decodes a byte array of private key to the Key. If text is invalid WireGuard key, UnmarshalText returns an error.
 func (k *Key) UnmarshalText(text []byte) error {
 	key, err := wgtypes.ParseKey(string(text))
@@ -0,0 +1,335 @@
+//go:build !windows
+
+package soratun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+const (
+	// DefaultProbeInterval is the default interval in seconds of connectivity probes.
+	DefaultProbeInterval = 30
+	// DefaultProbeTimeout is the default timeout in seconds of each connectivity probe.
+	DefaultProbeTimeout = 5
+
+	// probeWindow is the number of recent probes which statistics are computed from.
+	probeWindow = 20
+	// probeDownThreshold is the number of consecutive failures after which the target is considered down.
+	probeDownThreshold = 3
+)
+
+// ProbeResult is statistics of recent probes of a target.
+type ProbeResult struct {
+	Target  string `json:"target"`
+	Type    string `json:"type"`
+	Address string `json:"address"`
+	// Sent and Lost are numbers of recent probes, up to probeWindow.
+	Sent int `json:"sent"`
+	Lost int `json:"lost"`
+	// Loss is the ratio of lost probes, from 0 to 1.
+	Loss float64 `json:"loss"`
+	// RTT is round trip time of the latest successful probe.
+	RTT float64 `json:"rttSeconds"`
+	// AverageRTT is the average of round trip times of successful probes.
+	AverageRTT float64 `json:"averageRttSeconds"`
+	// Jitter is the mean difference of round trip times of consecutive successful probes.
+	Jitter      float64   `json:"jitterSeconds"`
+	LastProbeAt time.Time `json:"lastProbeAt"`
+	LastError   string    `json:"lastError,omitempty"`
+	Health      Health    `json:"health"`
+}
+
+// ProbeHealth returns the worst health of results, or HealthHealthy if there is no result.
+func ProbeHealth(results []ProbeResult) Health {
+	h := HealthHealthy
+	for _, r := range results {
+		h = WorseHealth(h, r.Health)
+	}
+	return h
+}
+
+type probeSample struct {
+	rtt time.Duration
+	ok  bool
+}
+
+type probeStats struct {
+	samples             []probeSample
+	consecutiveFailures int
+	lastProbeAt         time.Time
+	lastError           string
+}
+
+// connectivityProber probes targets through the tunnel periodically, and keeps statistics of recent probes.
+type connectivityProber struct {
+	options *ProbeOptions
+	// source returns the IP address of the tunnel interface, so that probes are sent through the tunnel. The address
+	// may change after the key rotation.
+	source func() net.IP
+
+	mu    sync.Mutex
+	stats map[*ProbeTarget]*probeStats
+}
+
+func newConnectivityProber(options *ProbeOptions, source func() net.IP) *connectivityProber {
+	p := &connectivityProber{
+		options: options,
+		source:  source,
+		stats:   map[*ProbeTarget]*probeStats{},
+	}
+	for _, t := range options.Targets {
+		p.stats[t] = &probeStats{}
+	}
+	return p
+}
+
+// run probes targets every interval until ctx is done. updated is called after each round.
+func (p *connectivityProber) run(ctx context.Context, updated func()) {
+	interval := time.Duration(p.options.Interval) * time.Second
+	if interval <= 0 {
+		interval = DefaultProbeInterval * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p.probeAll(ctx)
+		updated()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *connectivityProber) probeAll(ctx context.Context) {
+	timeout := time.Duration(p.options.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = DefaultProbeTimeout * time.Second
+	}
+
+	source := p.source()
+	var wg sync.WaitGroup
+	for _, t := range p.options.Targets {
+		wg.Add(1)
+		go func(t *ProbeTarget) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			rtt, err := probeTarget(ctx, t, source)
+			p.record(t, rtt, err, time.Now())
+		}(t)
+	}
+	wg.Wait()
+}
+
+func (p *connectivityProber) record(t *ProbeTarget, rtt time.Duration, err error, at time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := p.stats[t]
+	s.samples = append(s.samples, probeSample{rtt: rtt, ok: err == nil})
+	if len(s.samples) > probeWindow {
+		s.samples = s.samples[len(s.samples)-probeWindow:]
+	}
+	s.lastProbeAt = at
+	if err != nil {
+		s.consecutiveFailures++
+		s.lastError = err.Error()
+	} else {
+		s.consecutiveFailures = 0
+		s.lastError = ""
+	}
+}
+
+// Results returns statistics of recent probes, in the order of targets.
+func (p *connectivityProber) Results() []ProbeResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var results []ProbeResult
+	for _, t := range p.options.Targets {
+		s := p.stats[t]
+		r := ProbeResult{
+			Target:      t.String(),
+			Type:        t.Type,
+			Address:     t.Address,
+			Sent:        len(s.samples),
+			LastProbeAt: s.lastProbeAt,
+			LastError:   s.lastError,
+			Health:      HealthHealthy,
+		}
+
+		var sum, jitter time.Duration
+		var received, pairs int
+		var previous *probeSample
+		for i := range s.samples {
+			sample := &s.samples[i]
+			if !sample.ok {
+				r.Lost++
+				continue
+			}
+			received++
+			sum += sample.rtt
+			r.RTT = sample.rtt.Seconds()
+			if previous != nil {
+				jitter += absDuration(sample.rtt - previous.rtt)
+				pairs++
+			}
+			previous = sample
+		}
+		if r.Sent > 0 {
+			r.Loss = float64(r.Lost) / float64(r.Sent)
+		}
+		if received > 0 {
+			r.AverageRTT = (sum / time.Duration(received)).Seconds()
+		}
+		if pairs > 0 {
+			r.Jitter = (jitter / time.Duration(pairs)).Seconds()
+		}
+
+		switch {
+		case s.consecutiveFailures >= probeDownThreshold:
+			r.Health = HealthDown
+		case r.Lost > 0:
+			r.Health = HealthDegraded
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// Health returns the worst health of targets.
+func (p *connectivityProber) Health() Health {
+	return ProbeHealth(p.Results())
+}
+
+func absDuration(d time.Duration) time.Duration {
+	return time.Duration(math.Abs(float64(d)))
+}
+
+// probeTarget probes t from source once, and returns the round trip time.
+func probeTarget(ctx context.Context, t *ProbeTarget, source net.IP) (time.Duration, error) {
+	switch t.Type {
+	case "icmp":
+		return pingICMP(ctx, t.Address, source)
+	case "tcp":
+		return connectTCP(ctx, t.Address, source)
+	}
+	return 0, fmt.Errorf("unknown probe type %q", t.Type)
+}
+
+func connectTCP(ctx context.Context, address string, source net.IP) (time.Duration, error) {
+	d := net.Dialer{}
+	if source != nil {
+		d.LocalAddr = &net.TCPAddr{IP: source}
+	}
+
+	start := time.Now()
+	c, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+	_ = c.Close()
+	return rtt, nil
+}
+
+var icmpSeq atomic.Uint32
+
+// pingICMP sends an ICMP echo request to address, and waits for the reply. Unprivileged ICMP socket is used if
+// available, otherwise raw socket, which requires CAP_NET_RAW.
+func pingICMP(ctx context.Context, address string, source net.IP) (time.Duration, error) {
+	dst, err := net.DefaultResolver.LookupIP(ctx, "ip4", address)
+	if err != nil {
+		return 0, err
+	}
+
+	local := "0.0.0.0"
+	if source != nil {
+		local = source.String()
+	}
+	network := "udp4"
+	c, err := icmp.ListenPacket(network, local)
+	if err != nil {
+		network = "ip4:icmp"
+		if c, err = icmp.ListenPacket(network, local); err != nil {
+			return 0, fmt.Errorf("failed to open ICMP socket: %w", err)
+		}
+	}
+	defer func() {
+		_ = c.Close()
+	}()
+
+	id := os.Getpid() & 0xffff
+	seq := int(icmpSeq.Add(1) & 0xffff)
+	b, err := (&icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("soratun")},
+	}).Marshal(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var to net.Addr = &net.IPAddr{IP: dst[0]}
+	if network == "udp4" {
+		to = &net.UDPAddr{IP: dst[0]}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := c.SetDeadline(deadline); err != nil {
+			return 0, err
+		}
+	}
+
+	start := time.Now()
+	if _, err := c.WriteTo(b, to); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := c.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return 0, fmt.Errorf("no ICMP echo reply from %s", dst[0])
+			}
+			return 0, err
+		}
+
+		m, err := icmp.ParseMessage(ipv4.ICMPTypeEcho.Protocol(), buf[:n])
+		if err != nil || m.Type != ipv4.ICMPTypeEchoReply {
+			continue
+		}
+		echo, ok := m.Body.(*icmp.Echo)
+		// the kernel rewrites ID of unprivileged ICMP socket, and delivers only replies to the socket
+		if !ok || echo.Seq != seq || (network != "udp4" && (echo.ID != id || !addrIP(from).Equal(dst[0]))) {
+			continue
+		}
+		return time.Since(start), nil
+	}
+}
+
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	return nil
+}
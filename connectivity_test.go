@@ -0,0 +1,80 @@
+//go:build !windows
+
+package soratun
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectivityProber_Results(t *testing.T) {
+	target := &ProbeTarget{Type: "tcp", Address: "100.127.0.1:80"}
+	p := newConnectivityProber(&ProbeOptions{Targets: []*ProbeTarget{target}}, func() net.IP { return nil })
+	now := time.Now()
+
+	p.record(target, 10*time.Millisecond, nil, now)
+	p.record(target, 0, errors.New("timeout"), now)
+	p.record(target, 30*time.Millisecond, nil, now)
+	p.record(target, 20*time.Millisecond, nil, now)
+
+	r := p.Results()[0]
+	assert.Equal(t, "tcp 100.127.0.1:80", r.Target)
+	assert.Equal(t, 4, r.Sent)
+	assert.Equal(t, 1, r.Lost)
+	assert.InDelta(t, 0.25, r.Loss, 1e-9)
+	assert.InDelta(t, 0.020, r.RTT, 1e-9)
+	assert.InDelta(t, 0.020, r.AverageRTT, 1e-9)
+	// |30-10| and |20-30|
+	assert.InDelta(t, 0.015, r.Jitter, 1e-9)
+	assert.Empty(t, r.LastError)
+	assert.Equal(t, HealthDegraded, r.Health)
+
+	for i := 0; i < probeDownThreshold; i++ {
+		p.record(target, 0, errors.New("timeout"), now)
+	}
+	r = p.Results()[0]
+	assert.Equal(t, "timeout", r.LastError)
+	assert.Equal(t, HealthDown, r.Health)
+	assert.Equal(t, HealthDown, p.Health())
+
+	// only recent probes count
+	for i := 0; i < probeWindow; i++ {
+		p.record(target, 10*time.Millisecond, nil, now)
+	}
+	r = p.Results()[0]
+	assert.Equal(t, probeWindow, r.Sent)
+	assert.Zero(t, r.Lost)
+	assert.Zero(t, r.Jitter)
+	assert.Equal(t, HealthHealthy, r.Health)
+}
+
+func TestConnectTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_ = c.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	target := &ProbeTarget{Name: "local", Type: "tcp", Address: l.Addr().String()}
+	rtt, err := probeTarget(ctx, target, net.IPv4(127, 0, 0, 1))
+	assert.NoError(t, err)
+	assert.Positive(t, rtt)
+
+	// nobody is listening any more
+	assert.NoError(t, l.Close())
+	_, err = probeTarget(ctx, target, nil)
+	assert.Error(t, err)
+}
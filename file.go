@@ -0,0 +1,89 @@
+package soratun
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// ReplaceFile writes data to a temporary file, calls beforeRename if not nil, then renames the temporary file to path,
+// so that the file is replaced atomically and survives crash. The owner, the group and the permission of the existing
+// file are kept, e.g. 0640 with the group of the service user, and a new file is created with 0600 permission.
+func ReplaceFile(path string, data []byte, beforeRename func() error) error {
+	// os.CreateTemp creates the file with 0600 permission, so secrets are never readable by others
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// no-op if renamed successfully
+		_ = os.Remove(f.Name())
+	}()
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := keepFileMode(f, path); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if beforeRename != nil {
+		if err := beforeRename(); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+// keepFileMode changes the owner, the group and the permission of f to those of the existing file at path.
+func keepFileMode(f *os.File, path string) error {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		// only root can change the owner, and others can change the group to one of their groups
+		if err := f.Chown(int(st.Uid), int(st.Gid)); errors.Is(err, os.ErrPermission) {
+			_ = f.Chown(-1, int(st.Gid))
+		} else if err != nil {
+			return err
+		}
+	}
+	return f.Chmod(info.Mode().Perm())
+}
+
+// syncDir flushes the directory entry, so that renamed file survives crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) {
+		return err
+	}
+	return nil
+}
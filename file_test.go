@@ -0,0 +1,52 @@
+package soratun
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplaceFile(t *testing.T) {
+	dir := t.TempDir()
+
+	// a new file is created with 0600 permission
+	path := filepath.Join(dir, "arc.json")
+	assert.NoError(t, ReplaceFile(path, []byte("{}\n"), nil))
+	info, err := os.Stat(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	// permission and owner of the existing file are kept
+	assert.NoError(t, os.Chmod(path, 0640))
+	uid, gid := os.Getuid(), os.Getgid()
+	if os.Geteuid() == 0 {
+		uid, gid = 1, 1
+		assert.NoError(t, os.Chown(path, uid, gid))
+	}
+
+	called := false
+	assert.NoError(t, ReplaceFile(path, []byte(`{"mtu": 1420}`+"\n"), func() error {
+		called = true
+		return nil
+	}))
+	assert.True(t, called)
+
+	b, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"mtu": 1420}`+"\n", string(b))
+	info, err = os.Stat(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+		st := info.Sys().(*syscall.Stat_t)
+		assert.Equal(t, uid, int(st.Uid))
+		assert.Equal(t, gid, int(st.Gid))
+	}
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
@@ -0,0 +1,124 @@
+//go:build !windows
+
+package soratun
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.zx2c4.com/wireguard/device"
+)
+
+// Health is a verdict on the health of the tunnel to the SORACOM Arc server.
+type Health string
+
+const (
+	// HealthHealthy means the latest handshake is recent enough, i.e. the session is kept alive.
+	HealthHealthy Health = "healthy"
+	// HealthStale means the latest handshake is older than expected, but the session has not expired yet.
+	HealthStale Health = "stale"
+	// HealthDegraded means some connectivity probes through the tunnel have failed recently.
+	HealthDegraded Health = "degraded"
+	// HealthDown means there has been no handshake, or the session has expired.
+	HealthDown Health = "down"
+)
+
+// PeerHealth returns the health of the peer whose latest handshake is at lastHandshake. WireGuard initiates a new
+// handshake every 2 minutes while the tunnel is in use, and the session expires after 3 minutes.
+func PeerHealth(lastHandshake, now time.Time) Health {
+	if lastHandshake.IsZero() {
+		return HealthDown
+	}
+
+	age := now.Sub(lastHandshake)
+	switch {
+	case age < watchdogTimeout:
+		return HealthHealthy
+	case age < device.RejectAfterTime:
+		return HealthStale
+	default:
+		return HealthDown
+	}
+}
+
+// WorseHealth returns the worse of a and b.
+func WorseHealth(a, b Health) Health {
+	if healthRank(b) > healthRank(a) {
+		return b
+	}
+	return a
+}
+
+func healthRank(h Health) int {
+	switch h {
+	case HealthHealthy:
+		return 0
+	case HealthStale, HealthDegraded:
+		return 1
+	}
+	return 2
+}
+
+// HealthReport is the response of the health endpoint.
+type HealthReport struct {
+	// Health is the worse of the handshake health and the connectivity probe health.
+	Health          Health        `json:"health"`
+	Interface       string        `json:"interface"`
+	LatestHandshake *time.Time    `json:"latestHandshake,omitempty"`
+	Probes          []ProbeResult `json:"probes,omitempty"`
+}
+
+// newHealthReport returns the report of the tunnel iname from the snapshot.
+func newHealthReport(iname string, s *TunnelSnapshot) HealthReport {
+	report := HealthReport{Health: HealthDown, Interface: iname, Probes: s.Probes}
+	if s.DeviceErr != nil {
+		return report
+	}
+	if !s.LatestHandshake.IsZero() {
+		t := s.LatestHandshake
+		report.LatestHandshake = &t
+	}
+	report.Health = WorseHealth(PeerHealth(s.LatestHandshake, s.Now), ProbeHealth(s.Probes))
+	return report
+}
+
+// healthHandler serves the report at /health. It responds with 503 Service Unavailable if the tunnel is down, so that
+// load balancers and monitoring tools can check the tunnel without parsing the body.
+func healthHandler(report func() HealthReport) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		rep := report()
+		w.Header().Set("Content-Type", "application/json")
+		if rep.Health == HealthDown {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(rep)
+	})
+	return mux
+}
+
+// serveHealth serves the health endpoint on l until ctx is done.
+func serveHealth(ctx context.Context, l net.Listener, report func() HealthReport, logger *device.Logger) {
+	server := &http.Server{
+		Handler:           healthHandler(report),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+
+	logger.Verbosef("health endpoint is listening on %s", l.Addr())
+	if err := server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Errorf("failed to serve health endpoint: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+//go:build !windows
+
+package soratun
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeerHealth(t *testing.T) {
+	now := time.Now()
+	assert.Equal(t, HealthDown, PeerHealth(time.Time{}, now))
+	assert.Equal(t, HealthHealthy, PeerHealth(now.Add(-time.Minute), now))
+	assert.Equal(t, HealthStale, PeerHealth(now.Add(-150*time.Second), now))
+	assert.Equal(t, HealthDown, PeerHealth(now.Add(-4*time.Minute), now))
+}
+
+func TestWorseHealth(t *testing.T) {
+	assert.Equal(t, HealthDegraded, WorseHealth(HealthHealthy, HealthDegraded))
+	assert.Equal(t, HealthDown, WorseHealth(HealthDown, HealthStale))
+	assert.Equal(t, HealthHealthy, ProbeHealth(nil))
+}
+
+func TestNewHealthReport(t *testing.T) {
+	now := time.Now()
+	r := newHealthReport("soratun0", &TunnelSnapshot{
+		Now:             now,
+		LatestHandshake: now.Add(-time.Minute),
+		Probes:          []ProbeResult{{Target: "gateway", Health: HealthDegraded}},
+	})
+	assert.Equal(t, HealthDegraded, r.Health)
+	assert.Equal(t, "soratun0", r.Interface)
+	assert.NotNil(t, r.LatestHandshake)
+
+	r = newHealthReport("soratun0", &TunnelSnapshot{Now: now, DeviceErr: errors.New("file does not exist")})
+	assert.Equal(t, HealthDown, r.Health)
+}
+
+func TestHealthHandler(t *testing.T) {
+	report := HealthReport{
+		Health:    HealthDegraded,
+		Interface: "soratun0",
+		Probes:    []ProbeResult{{Target: "icmp 100.127.0.1", Type: "icmp", Address: "100.127.0.1", Sent: 2, Lost: 1, Loss: 0.5, Health: HealthDegraded}},
+	}
+	server := httptest.NewServer(healthHandler(func() HealthReport { return report }))
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/health")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	var decoded HealthReport
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&decoded))
+	_ = res.Body.Close()
+	assert.Equal(t, HealthDegraded, decoded.Health)
+	assert.Equal(t, 0.5, decoded.Probes[0].Loss)
+
+	report.Health = HealthDown
+	res, err = http.Get(server.URL + "/health")
+	assert.NoError(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+
+	res, err = http.Post(server.URL+"/health", "application/json", nil)
+	assert.NoError(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+}
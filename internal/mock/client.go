@@ -55,18 +55,92 @@ func (mr *MockSoracomClientMockRecorder) CreateArcSession(simId, publicKey any)
 }
 
 // CreateVirtualSim mocks base method.
-func (m *MockSoracomClient) CreateVirtualSim() (*soratun.VirtualSim, error) {
+func (m *MockSoracomClient) CreateVirtualSim(options soratun.VirtualSimOptions) (*soratun.VirtualSim, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateVirtualSim")
+	ret := m.ctrl.Call(m, "CreateVirtualSim", options)
 	ret0, _ := ret[0].(*soratun.VirtualSim)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateVirtualSim indicates an expected call of CreateVirtualSim.
-func (mr *MockSoracomClientMockRecorder) CreateVirtualSim() *gomock.Call {
+func (mr *MockSoracomClientMockRecorder) CreateVirtualSim(options any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateVirtualSim", reflect.TypeOf((*MockSoracomClient)(nil).CreateVirtualSim))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateVirtualSim", reflect.TypeOf((*MockSoracomClient)(nil).CreateVirtualSim), options)
+}
+
+// DeleteArcSession mocks base method.
+func (m *MockSoracomClient) DeleteArcSession(simId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteArcSession", simId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteArcSession indicates an expected call of DeleteArcSession.
+func (mr *MockSoracomClientMockRecorder) DeleteArcSession(simId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteArcSession", reflect.TypeOf((*MockSoracomClient)(nil).DeleteArcSession), simId)
+}
+
+// GetSim mocks base method.
+func (m *MockSoracomClient) GetSim(simId string) (*soratun.VirtualSim, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSim", simId)
+	ret0, _ := ret[0].(*soratun.VirtualSim)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSim indicates an expected call of GetSim.
+func (mr *MockSoracomClientMockRecorder) GetSim(simId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSim", reflect.TypeOf((*MockSoracomClient)(nil).GetSim), simId)
+}
+
+// ListSims mocks base method.
+func (m *MockSoracomClient) ListSims(simType string) ([]soratun.VirtualSim, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListSims", simType)
+	ret0, _ := ret[0].([]soratun.VirtualSim)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListSims indicates an expected call of ListSims.
+func (mr *MockSoracomClientMockRecorder) ListSims(simType any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListSims", reflect.TypeOf((*MockSoracomClient)(nil).ListSims), simType)
+}
+
+// PutSimTags mocks base method.
+func (m *MockSoracomClient) PutSimTags(simId string, tags map[string]string) (*soratun.VirtualSim, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PutSimTags", simId, tags)
+	ret0, _ := ret[0].(*soratun.VirtualSim)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PutSimTags indicates an expected call of PutSimTags.
+func (mr *MockSoracomClientMockRecorder) PutSimTags(simId, tags any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutSimTags", reflect.TypeOf((*MockSoracomClient)(nil).PutSimTags), simId, tags)
+}
+
+// SetSimGroup mocks base method.
+func (m *MockSoracomClient) SetSimGroup(simId, groupId string) (*soratun.VirtualSim, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetSimGroup", simId, groupId)
+	ret0, _ := ret[0].(*soratun.VirtualSim)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetSimGroup indicates an expected call of SetSimGroup.
+func (mr *MockSoracomClientMockRecorder) SetSimGroup(simId, groupId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetSimGroup", reflect.TypeOf((*MockSoracomClient)(nil).SetSimGroup), simId, groupId)
 }
 
 // SetVerbose mocks base method.
@@ -81,6 +155,21 @@ func (mr *MockSoracomClientMockRecorder) SetVerbose(v any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetVerbose", reflect.TypeOf((*MockSoracomClient)(nil).SetVerbose), v)
 }
 
+// TerminateSim mocks base method.
+func (m *MockSoracomClient) TerminateSim(simId string) (*soratun.VirtualSim, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TerminateSim", simId)
+	ret0, _ := ret[0].(*soratun.VirtualSim)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TerminateSim indicates an expected call of TerminateSim.
+func (mr *MockSoracomClientMockRecorder) TerminateSim(simId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TerminateSim", reflect.TypeOf((*MockSoracomClient)(nil).TerminateSim), simId)
+}
+
 // Verbose mocks base method.
 func (m *MockSoracomClient) Verbose() bool {
 	m.ctrl.T.Helper()
@@ -2,6 +2,7 @@ package soratun
 
 import (
 	"fmt"
+	"net"
 
 	"golang.zx2c4.com/wireguard/device"
 )
@@ -15,12 +16,12 @@ func ConfigureInterface(iname string, config *Config) error {
 
 	command := []string{"sudo", "ifconfig", iname, config.ArcSession.ArcClientPeerIpAddress.String(), config.ArcSession.ArcClientPeerIpAddress.String()}
 	logger.Verbosef("assign IP address: %s", command)
-	_, err := runCommand(command)
+	_, err := runCommand(command, nil)
 	if err != nil {
 		return err
 	}
 
-	for _, allowedIP := range config.ArcSession.ArcAllowedIPs {
+	for _, allowedIP := range config.AllowedIPs() {
 		prefix, _ := allowedIP.Mask.Size()
 		if prefix == 32 {
 			command = []string{"sudo", "route", "add", "-host", allowedIP.IP.String(), "-interface", iname}
@@ -28,7 +29,7 @@ func ConfigureInterface(iname string, config *Config) error {
 			command = []string{"sudo", "route", "add", "-net", fmt.Sprintf("%s/%d", allowedIP.IP, prefix), "-interface", iname}
 		}
 		logger.Verbosef("update routing table: %s", command)
-		result, err := runCommand(command)
+		result, err := runCommand(command, nil)
 		if err != nil {
 			return err
 		}
@@ -36,3 +37,34 @@ func ConfigureInterface(iname string, config *Config) error {
 	}
 	return nil
 }
+
+// localRoutes returns IPv4 networks of interfaces, except for loopback and the interface specified with exclude.
+func localRoutes(exclude string) ([]localRoute, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []localRoute
+	for _, iface := range ifaces {
+		if iface.Name == exclude || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.To4() == nil {
+				continue
+			}
+			result = append(result, localRoute{
+				Dst:       &net.IPNet{IP: ipnet.IP.Mask(ipnet.Mask), Mask: ipnet.Mask},
+				Interface: iface.Name,
+			})
+		}
+	}
+	return result, nil
+}
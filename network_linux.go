@@ -32,7 +32,7 @@ func ConfigureInterface(iname string, config *Config) error {
 		Peer:  nil,
 	}
 
-	if err := netlink.AddrAdd(iface, addr); err != nil {
+	if err := netlink.AddrReplace(iface, addr); err != nil {
 		return err
 	}
 
@@ -41,7 +41,7 @@ func ConfigureInterface(iname string, config *Config) error {
 		return err
 	}
 
-	for _, allowedIP := range config.ArcSession.ArcAllowedIPs {
+	for _, allowedIP := range config.AllowedIPs() {
 		prefix, _ := allowedIP.Mask.Size()
 		logger.Verbosef("add route: %s/%d", allowedIP.IP, prefix)
 		route := netlink.Route{
@@ -56,3 +56,32 @@ func ConfigureInterface(iname string, config *Config) error {
 
 	return nil
 }
+
+// localRoutes returns IPv4 routes in the main routing table, except for the default route and routes on the interface
+// specified with exclude.
+func localRoutes(exclude string) ([]localRoute, error) {
+	routes, err := netlink.RouteList(nil, netlink.FAMILY_V4)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []localRoute
+	for _, r := range routes {
+		if r.Dst == nil {
+			continue
+		}
+		if ones, _ := r.Dst.Mask.Size(); ones == 0 {
+			continue
+		}
+
+		name := ""
+		if link, err := netlink.LinkByIndex(r.LinkIndex); err == nil {
+			name = link.Attrs().Name
+		}
+		if name == exclude {
+			continue
+		}
+		result = append(result, localRoute{Dst: r.Dst, Interface: name})
+	}
+	return result, nil
+}
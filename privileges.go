@@ -0,0 +1,61 @@
+//go:build !windows
+
+package soratun
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// lookupCredential returns the credential of the user name and the group. The group defaults to the primary group of
+// the user. Both accept numeric IDs.
+func lookupCredential(name, group string) (*syscall.Credential, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		if u, err = user.LookupId(name); err != nil {
+			return nil, fmt.Errorf("unknown user %q", name)
+		}
+	}
+
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uid of user %q: %s", name, u.Uid)
+	}
+
+	gidString := u.Gid
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			if g, err = user.LookupGroupId(group); err != nil {
+				return nil, fmt.Errorf("unknown group %q", group)
+			}
+		}
+		gidString = g.Gid
+	}
+	gid, err := strconv.ParseUint(gidString, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gid of group %q: %s", group, gidString)
+	}
+
+	cred := &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid), Groups: []uint32{uint32(gid)}}
+	// supplementary groups of the user, e.g. "dialout" for the modem
+	if ids, err := u.GroupIds(); err == nil {
+		for _, id := range ids {
+			if v, err := strconv.ParseUint(id, 10, 32); err == nil && uint32(v) != cred.Gid {
+				cred.Groups = append(cred.Groups, uint32(v))
+			}
+		}
+	}
+	return cred, nil
+}
+
+// hookCredential returns the credential to run PostUp and PostDown commands with, or nil to run them as soratun
+// itself, i.e. as "user" if privileges have been dropped.
+func hookCredential(config *Config) (*syscall.Credential, error) {
+	if config.HookUser == "" {
+		return nil, nil
+	}
+	return lookupCredential(config.HookUser, config.HookGroup)
+}
@@ -0,0 +1,19 @@
+package soratun
+
+import (
+	"errors"
+	"syscall"
+)
+
+// dropPrivileges is not supported on macOS, since changing routes after the key rotation requires root.
+func dropPrivileges(_ *Config, _ string) error {
+	return errors.New("dropping privileges is not supported on macOS")
+}
+
+// hookSysProcAttr returns attributes to run hooks as cred.
+func hookSysProcAttr(cred *syscall.Credential) *syscall.SysProcAttr {
+	if cred == nil {
+		return nil
+	}
+	return &syscall.SysProcAttr{Credential: cred}
+}
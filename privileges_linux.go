@@ -0,0 +1,100 @@
+package soratun
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// wireguardSocketDirectory is the directory of UAPI sockets, which golang.zx2c4.com/wireguard/ipc does not export.
+const wireguardSocketDirectory = "/var/run/wireguard"
+
+// dropPrivileges switches to config.User and config.Group after the tunnel interface, addresses, routes and the UAPI
+// socket have been set up as root. Only CAP_NET_ADMIN is kept, to change addresses after the key rotation, and it is
+// also raised as an ambient capability so that hooks can change routes. CAP_SETUID and CAP_SETGID are kept as well if
+// hooks run as config.HookUser.
+func dropPrivileges(config *Config, iname string) error {
+	cred, err := lookupCredential(config.User, config.Group)
+	if err != nil {
+		return err
+	}
+
+	// the UAPI socket is owned by root with mode 0700, and the tunnel state is updated while the tunnel is up
+	if err := os.Chown(filepath.Join(wireguardSocketDirectory, iname+".sock"), int(cred.Uid), int(cred.Gid)); err != nil {
+		return fmt.Errorf("failed to change owner of UAPI socket: %w", err)
+	}
+	if err := prepareTunnelState(iname, int(cred.Uid), int(cred.Gid)); err != nil {
+		return err
+	}
+
+	keep := []uintptr{unix.CAP_NET_ADMIN}
+	if config.HookUser != "" {
+		keep = append(keep, unix.CAP_SETUID, unix.CAP_SETGID)
+	}
+
+	// capabilities are per thread, so every syscall below is applied to all threads of the process. It is not
+	// supported if soratun is built with cgo.
+	if _, _, errno := syscall.AllThreadsSyscall(syscall.SYS_PRCTL, unix.PR_SET_KEEPCAPS, 1, 0); errno != 0 {
+		if errors.Is(errno, syscall.ENOTSUP) {
+			return errors.New("dropping privileges is not supported by soratun built with cgo, build it with CGO_ENABLED=0")
+		}
+		return fmt.Errorf("failed to keep capabilities: %w", errno)
+	}
+	if err := syscall.Setgroups(intSlice(cred.Groups)); err != nil {
+		return fmt.Errorf("failed to set supplementary groups: %w", err)
+	}
+	if err := syscall.Setgid(int(cred.Gid)); err != nil {
+		return fmt.Errorf("failed to set gid: %w", err)
+	}
+	if err := syscall.Setuid(int(cred.Uid)); err != nil {
+		return fmt.Errorf("failed to set uid: %w", err)
+	}
+
+	// setuid clears effective capabilities, and keeps permitted ones with PR_SET_KEEPCAPS
+	header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	data := capabilityData(keep, unix.CAP_NET_ADMIN)
+	if _, _, errno := syscall.AllThreadsSyscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&data[0])), 0); errno != 0 {
+		return fmt.Errorf("failed to set capabilities: %w", errno)
+	}
+	if _, _, errno := syscall.AllThreadsSyscall6(syscall.SYS_PRCTL, unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_RAISE, unix.CAP_NET_ADMIN, 0, 0, 0); errno != 0 {
+		return fmt.Errorf("failed to raise ambient capability: %w", errno)
+	}
+	if _, _, errno := syscall.AllThreadsSyscall(syscall.SYS_PRCTL, unix.PR_SET_KEEPCAPS, 0, 0); errno != 0 {
+		return fmt.Errorf("failed to reset keeping capabilities: %w", errno)
+	}
+	return nil
+}
+
+// capabilityData returns capabilities for capset(2), with keep effective and permitted, and inheritable inheritable.
+func capabilityData(keep []uintptr, inheritable ...uintptr) [2]unix.CapUserData {
+	var data [2]unix.CapUserData
+	for _, c := range keep {
+		data[c/32].Effective |= 1 << (c % 32)
+		data[c/32].Permitted |= 1 << (c % 32)
+	}
+	for _, c := range inheritable {
+		data[c/32].Inheritable |= 1 << (c % 32)
+	}
+	return data
+}
+
+// hookSysProcAttr returns attributes to run hooks as cred, keeping CAP_NET_ADMIN so that hooks can change routes.
+func hookSysProcAttr(cred *syscall.Credential) *syscall.SysProcAttr {
+	if cred == nil {
+		return nil
+	}
+	return &syscall.SysProcAttr{Credential: cred, AmbientCaps: []uintptr{unix.CAP_NET_ADMIN}}
+}
+
+func intSlice(v []uint32) []int {
+	var r []int
+	for _, i := range v {
+		r = append(r, int(i))
+	}
+	return r
+}
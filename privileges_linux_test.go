@@ -0,0 +1,33 @@
+package soratun
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestLookupCredential(t *testing.T) {
+	cred, err := lookupCredential("root", "")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(0), cred.Uid)
+	assert.Equal(t, uint32(0), cred.Gid)
+	assert.Contains(t, cred.Groups, uint32(0))
+
+	cred, err = lookupCredential("0", "0")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(0), cred.Uid)
+
+	_, err = lookupCredential("soratun-no-such-user", "")
+	assert.EqualError(t, err, `unknown user "soratun-no-such-user"`)
+	_, err = lookupCredential("root", "soratun-no-such-group")
+	assert.EqualError(t, err, `unknown group "soratun-no-such-group"`)
+}
+
+func TestCapabilityData(t *testing.T) {
+	data := capabilityData([]uintptr{unix.CAP_NET_ADMIN, unix.CAP_SETUID, unix.CAP_SETGID}, unix.CAP_NET_ADMIN)
+	assert.Equal(t, uint32(1<<unix.CAP_NET_ADMIN|1<<unix.CAP_SETUID|1<<unix.CAP_SETGID), data[0].Effective)
+	assert.Equal(t, data[0].Effective, data[0].Permitted)
+	assert.Equal(t, uint32(1<<unix.CAP_NET_ADMIN), data[0].Inheritable)
+	assert.Zero(t, data[1].Effective)
+}
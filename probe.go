@@ -0,0 +1,163 @@
+//go:build !windows
+
+package soratun
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun"
+)
+
+// ErrNoHandshake is returned by ProbeHandshake if the SORACOM Arc server does not respond to the handshake.
+var ErrNoHandshake = errors.New("no handshake response from SORACOM Arc server")
+
+// ProbeHandshake performs a WireGuard handshake with the SORACOM Arc server in config, from an ephemeral userspace
+// device which has no tunnel interface, so that the key pair, the Arc session and reachability of the endpoint can be
+// checked without touching host networking. It returns how long the handshake took, or ErrNoHandshake if the server
+// does not respond until ctx is done.
+//
+// Note that the server accepts only one endpoint per session, so probing while the tunnel with the same key pair is up
+// disturbs the tunnel until its next handshake.
+func ProbeHandshake(ctx context.Context, config *Config) (time.Duration, error) {
+	if config.ArcSession == nil || config.ArcSession.ArcServerEndpoint == nil {
+		return 0, errors.New("Arc session is missing")
+	}
+
+	d := device.NewDevice(newNullTUN(), conn.NewDefaultBind(), device.NewLogger(device.LogLevelSilent, ""))
+	defer d.Close()
+
+	endpoint := net.JoinHostPort(config.ArcSession.ArcServerEndpoint.IP.String(), strconv.Itoa(config.ArcSession.ArcServerEndpoint.Port))
+	// persistent keepalive makes the device initiate a handshake as soon as it is up, and no allowed IPs are needed
+	uapi := fmt.Sprintf("private_key=%s\npublic_key=%s\nendpoint=%s\npersistent_keepalive_interval=1\n",
+		config.PrivateKey.AsHexString(),
+		config.ArcSession.ArcServerPeerPublicKey.AsHexString(),
+		endpoint,
+	)
+
+	start := time.Now()
+	if err := d.IpcSet(uapi); err != nil {
+		return 0, fmt.Errorf("failed to configure probe device: %w", err)
+	}
+	if err := d.Up(); err != nil {
+		return 0, fmt.Errorf("failed to start probe device: %w", err)
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return 0, ErrNoHandshake
+		case <-ticker.C:
+			ok, err := handshakeCompleted(d)
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				return time.Since(start), nil
+			}
+		}
+	}
+}
+
+func handshakeCompleted(d *device.Device) (bool, error) {
+	s, err := d.IpcGet()
+	if err != nil {
+		return false, fmt.Errorf("failed to get probe device status: %w", err)
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		if v, ok := strings.CutPrefix(scanner.Text(), "last_handshake_time_sec="); ok && v != "0" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// preflightHandshake probes the SORACOM Arc server before the interface is up. If the server does not respond and
+// config.Preflight.RenewSession is true, the Arc session is renewed, persisted with handler, and probed again.
+func preflightHandshake(ctx context.Context, config *Config, handler func(config *Config) error, logger *device.Logger) error {
+	timeout := time.Duration(config.Preflight.Timeout) * time.Second
+	probe := func() error {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		elapsed, err := ProbeHandshake(ctx, config)
+		if err != nil {
+			return err
+		}
+		logger.Verbosef("pre-flight handshake completed in %s", elapsed)
+		return nil
+	}
+
+	err := probe()
+	if !errors.Is(err, ErrNoHandshake) || !config.Preflight.RenewSession {
+		return err
+	}
+	if handler == nil {
+		return fmt.Errorf("%w, and the Arc session is not renewed since it can't be persisted", err)
+	}
+
+	logger.Verbosef("no pre-flight handshake response in %s, renewing Arc session", timeout)
+	if err := RotateKeysWithProfile(config); err != nil {
+		return fmt.Errorf("%w, and failed to renew Arc session: %v", ErrNoHandshake, err)
+	}
+	if err := handler(config); err != nil {
+		return fmt.Errorf("failed to persist renewed Arc session: %w", err)
+	}
+	return probe()
+}
+
+// nullTUN is a tun.Device which never reads packets and discards packets written, for the ephemeral device of
+// ProbeHandshake.
+type nullTUN struct {
+	events chan tun.Event
+	closed chan struct{}
+}
+
+func newNullTUN() *nullTUN {
+	t := &nullTUN{
+		events: make(chan tun.Event, 1),
+		closed: make(chan struct{}),
+	}
+	t.events <- tun.EventUp
+	return t
+}
+
+func (t *nullTUN) File() *os.File { return nil }
+
+func (t *nullTUN) Read(_ [][]byte, _ []int, _ int) (int, error) {
+	<-t.closed
+	return 0, os.ErrClosed
+}
+
+func (t *nullTUN) Write(bufs [][]byte, _ int) (int, error) { return len(bufs), nil }
+
+func (t *nullTUN) MTU() (int, error) { return DefaultMTU, nil }
+
+func (t *nullTUN) Name() (string, error) { return "probe", nil }
+
+func (t *nullTUN) Events() <-chan tun.Event { return t.events }
+
+func (t *nullTUN) Close() error {
+	select {
+	case <-t.closed:
+	default:
+		close(t.closed)
+		close(t.events)
+	}
+	return nil
+}
+
+func (t *nullTUN) BatchSize() int { return 1 }
@@ -0,0 +1,135 @@
+//go:build !windows
+
+package soratun
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+)
+
+// newProbeServer starts a WireGuard device on loopback as SORACOM Arc server, and returns the device, its public key and
+// its endpoint.
+func newProbeServer(t *testing.T) (*device.Device, Key, *UDPAddr) {
+	privateKey, publicKey, err := GenerateKeyPair()
+	assert.NoError(t, err)
+
+	server := device.NewDevice(newNullTUN(), conn.NewDefaultBind(), device.NewLogger(device.LogLevelSilent, ""))
+	t.Cleanup(server.Close)
+	assert.NoError(t, server.IpcSet(fmt.Sprintf("private_key=%s\nlisten_port=0\n", privateKey.AsHexString())))
+	assert.NoError(t, server.Up())
+
+	s, err := server.IpcGet()
+	assert.NoError(t, err)
+	port := 0
+	for _, line := range strings.Split(s, "\n") {
+		if v, ok := strings.CutPrefix(line, "listen_port="); ok {
+			port, _ = strconv.Atoi(v)
+		}
+	}
+	assert.NotZero(t, port)
+
+	return server, publicKey, &UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}
+}
+
+func allowProbePeer(t *testing.T, server *device.Device, publicKey Key) {
+	assert.NoError(t, server.IpcSet(fmt.Sprintf("replace_peers=true\npublic_key=%s\nallowed_ip=10.0.0.1/32\n", publicKey.AsHexString())))
+}
+
+func TestProbeHandshake(t *testing.T) {
+	server, serverPublicKey, endpoint := newProbeServer(t)
+
+	clientPrivateKey, clientPublicKey, err := GenerateKeyPair()
+	assert.NoError(t, err)
+	allowProbePeer(t, server, clientPublicKey)
+
+	config := &Config{
+		PrivateKey: clientPrivateKey,
+		PublicKey:  clientPublicKey,
+		ArcSession: &ArcSession{
+			ArcServerPeerPublicKey: serverPublicKey,
+			ArcServerEndpoint:      endpoint,
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = ProbeHandshake(ctx, config)
+	assert.NoError(t, err)
+
+	// the server does not know the key
+	config.PrivateKey, _, err = GenerateKeyPair()
+	assert.NoError(t, err)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = ProbeHandshake(ctx, config)
+	assert.ErrorIs(t, err, ErrNoHandshake)
+}
+
+func TestPreflightHandshake(t *testing.T) {
+	server, serverPublicKey, endpoint := newProbeServer(t)
+
+	// SORACOM API which registers the public key of a new Arc session to the server
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/sims/8942310022000000000/sessions/arc", r.URL.Path)
+
+		var req struct {
+			ArcClientPeerPublicKey Key `json:"arcClientPeerPublicKey"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		allowProbePeer(t, server, req.ArcClientPeerPublicKey)
+
+		_, _ = fmt.Fprintf(w, `{"arcServerPeerPublicKey":"%s","arcServerEndpoint":"127.0.0.1:%d","arcAllowedIPs":["100.127.0.0/16"],"arcClientPeerIpAddress":"10.0.0.1"}`,
+			serverPublicKey, endpoint.Port)
+	}))
+	defer api.Close()
+
+	staleKey, stalePublicKey, err := GenerateKeyPair()
+	assert.NoError(t, err)
+	config := &Config{
+		PrivateKey: staleKey,
+		PublicKey:  stalePublicKey,
+		SimId:      "8942310022000000000",
+		Profile:    &Profile{APIKey: "api-key", Token: "token", Endpoint: api.URL},
+		Preflight:  &PreflightOptions{Timeout: 1},
+		ArcSession: &ArcSession{
+			ArcServerPeerPublicKey: serverPublicKey,
+			ArcServerEndpoint:      endpoint,
+		},
+	}
+	logger := device.NewLogger(device.LogLevelSilent, "")
+
+	err = preflightHandshake(context.Background(), config, nil, logger)
+	assert.ErrorIs(t, err, ErrNoHandshake)
+
+	config.Preflight.RenewSession = true
+	err = preflightHandshake(context.Background(), config, nil, logger)
+	assert.ErrorContains(t, err, "can't be persisted")
+
+	unpersisted := *config
+	err = preflightHandshake(context.Background(), &unpersisted, func(c *Config) error {
+		return errors.New("read-only file system")
+	}, logger)
+	assert.ErrorContains(t, err, "failed to persist renewed Arc session")
+
+	persisted := false
+	err = preflightHandshake(context.Background(), config, func(c *Config) error {
+		persisted = true
+		return nil
+	}, logger)
+	assert.NoError(t, err)
+	assert.True(t, persisted)
+	assert.NotEqual(t, stalePublicKey, config.PublicKey)
+}
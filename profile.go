@@ -0,0 +1,90 @@
+package soratun
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// soracomCliProfile is a profile of soracom-cli. See https://github.com/soracom/soracom-cli
+type soracomCliProfile struct {
+	Sandbox      bool   `json:"sandbox,omitempty"`
+	CoverageType string `json:"coverageType"`
+	AuthKeyID    string `json:"authKeyId,omitempty"`
+	AuthKey      string `json:"authKey,omitempty"`
+	OperatorID   string `json:"operatorId,omitempty"`
+	Username     string `json:"username,omitempty"`
+	Email        string `json:"email,omitempty"`
+	Password     string `json:"password,omitempty"`
+	Endpoint     string `json:"endpoint,omitempty"`
+}
+
+// SoracomCliProfileDir returns a directory where soracom-cli profiles are stored, $SORACOM_PROFILE_DIR or ~/.soracom.
+func SoracomCliProfileDir() (string, error) {
+	if dir := os.Getenv("SORACOM_PROFILE_DIR"); dir != "" {
+		return dir, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".soracom"), nil
+}
+
+// LoadSoracomCliProfile loads a soracom-cli profile with the name, including credentials for auth key, SAM user or root
+// user authentication, coverage type and endpoint.
+func LoadSoracomCliProfile(name string) (*Profile, error) {
+	dir, err := SoracomCliProfileDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find soracom-cli profile directory: %w", err)
+	}
+
+	path := filepath.Join(dir, name+".json")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open soracom-cli profile %q: %w", name, err)
+	}
+
+	var p soracomCliProfile
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("error while reading soracom-cli profile %s: %w", path, err)
+	}
+
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint, err = CoverageEndpoint(p.CoverageType, p.Sandbox)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading soracom-cli profile %s: %w", path, err)
+		}
+	}
+
+	return &Profile{
+		AuthKey:    p.AuthKey,
+		AuthKeyID:  p.AuthKeyID,
+		OperatorID: p.OperatorID,
+		UserName:   p.Username,
+		Email:      p.Email,
+		Password:   p.Password,
+		Endpoint:   endpoint,
+	}, nil
+}
+
+var coverageEndpoints = map[string]struct{ production, sandbox string }{
+	"g":  {production: "https://g.api.soracom.io", sandbox: "https://g.api-sandbox.soracom.io"},
+	"jp": {production: "https://api.soracom.io", sandbox: "https://api-sandbox.soracom.io"},
+}
+
+// CoverageEndpoint returns SORACOM API endpoint for the coverage type, "g" for Global, "jp" for Japan.
+func CoverageEndpoint(coverageType string, sandbox bool) (string, error) {
+	endpoints, ok := coverageEndpoints[coverageType]
+	if !ok {
+		return "", fmt.Errorf("unknown coverage type %q, it should be \"g\" or \"jp\"", coverageType)
+	}
+
+	if sandbox {
+		return endpoints.sandbox, nil
+	}
+	return endpoints.production, nil
+}
@@ -0,0 +1,28 @@
+package soratun
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadSoracomCliProfile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SORACOM_PROFILE_DIR", dir)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "default.json"), []byte(`{"coverageType":"g","authKeyId":"keyId-xxx","authKey":"secret-xxx"}`), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "custom.json"), []byte(`{"coverageType":"jp","authKeyId":"keyId-yyy","authKey":"secret-yyy","endpoint":"https://example.com"}`), 0600))
+
+	p, err := LoadSoracomCliProfile("default")
+	assert.NoError(t, err)
+	assert.Equal(t, &Profile{AuthKeyID: "keyId-xxx", AuthKey: "secret-xxx", Endpoint: "https://g.api.soracom.io"}, p)
+
+	p, err = LoadSoracomCliProfile("custom")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com", p.Endpoint)
+
+	_, err = LoadSoracomCliProfile("missing")
+	assert.Error(t, err)
+}
@@ -0,0 +1,48 @@
+package soratun
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// RotateKeys generates a new WireGuard key pair locally, and creates a new Arc session with the new public key. config
+// will be updated with the new key pair and Arc session only if the session is created successfully.
+func RotateKeys(client SoracomClient, config *Config) error {
+	if config.SimId == "" {
+		return errors.New("no SIM ID found in the configuration")
+	}
+
+	privateKey, publicKey, err := GenerateKeyPair()
+	if err != nil {
+		return fmt.Errorf("failed to generate WireGuard key pair: %w", err)
+	}
+
+	arcSession, err := client.CreateArcSession(config.SimId, publicKey.String())
+	if err != nil {
+		return fmt.Errorf("failed to create a new Arc session: %w", err)
+	}
+
+	config.PrivateKey = privateKey
+	config.PublicKey = publicKey
+	config.ArcSession = arcSession
+	return nil
+}
+
+// RotateKeysWithProfile does RotateKeys with SORACOM API client created from config.Profile.
+func RotateKeysWithProfile(config *Config) error {
+	if config.Profile == nil {
+		return errors.New("no SORACOM API profile found in the configuration. Please bootstrap with \"soratun bootstrap authkey\"")
+	}
+
+	client, err := NewDefaultSoracomClient(*config.Profile)
+	if err != nil {
+		return err
+	}
+
+	if v := os.Getenv("SORACOM_VERBOSE"); v != "" {
+		client.SetVerbose(true)
+	}
+
+	return RotateKeys(client, config)
+}
@@ -0,0 +1,96 @@
+package soratun_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/soracom/soratun"
+	mock_soratun "github.com/soracom/soratun/internal/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestRotateKeys(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	client := mock_soratun.NewMockSoracomClient(ctrl)
+
+	oldPrivateKey, oldPublicKey, err := soratun.GenerateKeyPair()
+	assert.NoError(t, err)
+	oldSession := &soratun.ArcSession{ArcClientPeerIpAddress: []byte{10, 0, 0, 1}}
+	newSession := &soratun.ArcSession{ArcClientPeerIpAddress: []byte{10, 0, 0, 2}}
+
+	config := &soratun.Config{SimId: "8942310022000000000", PrivateKey: oldPrivateKey, PublicKey: oldPublicKey, ArcSession: oldSession}
+
+	// the session and the keys are kept if the session is not created
+	client.EXPECT().CreateArcSession("8942310022000000000", gomock.Any()).Return(nil, soratun.ErrSimForbidden)
+	err = soratun.RotateKeys(client, config)
+	assert.ErrorIs(t, err, soratun.ErrSimForbidden)
+	assert.Equal(t, oldPrivateKey, config.PrivateKey)
+	assert.Equal(t, oldPublicKey, config.PublicKey)
+	assert.Same(t, oldSession, config.ArcSession)
+
+	// the new public key is sent, and the session and the keys are swapped
+	var sentPublicKey string
+	client.EXPECT().CreateArcSession("8942310022000000000", gomock.Any()).DoAndReturn(func(simId, publicKey string) (*soratun.ArcSession, error) {
+		sentPublicKey = publicKey
+		return newSession, nil
+	})
+	assert.NoError(t, soratun.RotateKeys(client, config))
+	assert.Equal(t, config.PublicKey.String(), sentPublicKey)
+	assert.NotEqual(t, oldPublicKey, config.PublicKey)
+	assert.NotEqual(t, oldPrivateKey, config.PrivateKey)
+	assert.Same(t, newSession, config.ArcSession)
+
+	// no API call without SIM ID
+	assert.Error(t, soratun.RotateKeys(client, &soratun.Config{}))
+}
+
+func TestRotateKeysWithProfile(t *testing.T) {
+	_, serverPublicKey, err := soratun.GenerateKeyPair()
+	assert.NoError(t, err)
+
+	fail := false
+	var sentPublicKey string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/sims/8942310022000000000/sessions/arc", r.URL.Path)
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var req struct {
+			ArcClientPeerPublicKey string `json:"arcClientPeerPublicKey"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		sentPublicKey = req.ArcClientPeerPublicKey
+
+		_, _ = fmt.Fprintf(w, `{"arcServerPeerPublicKey":"%s","arcServerEndpoint":"192.0.2.1:11010","arcAllowedIPs":["100.127.0.0/16"],"arcClientPeerIpAddress":"10.0.0.2"}`, serverPublicKey)
+	}))
+	defer api.Close()
+
+	_, oldPublicKey, err := soratun.GenerateKeyPair()
+	assert.NoError(t, err)
+	config := &soratun.Config{
+		SimId:     "8942310022000000000",
+		PublicKey: oldPublicKey,
+		Profile:   &soratun.Profile{APIKey: "api-key", Token: "token", Endpoint: api.URL},
+	}
+
+	fail = true
+	assert.Error(t, soratun.RotateKeysWithProfile(config))
+	assert.Equal(t, oldPublicKey, config.PublicKey)
+	assert.Nil(t, config.ArcSession)
+
+	fail = false
+	assert.NoError(t, soratun.RotateKeysWithProfile(config))
+	assert.Equal(t, config.PublicKey.String(), sentPublicKey)
+	if assert.NotNil(t, config.ArcSession) {
+		assert.Equal(t, "10.0.0.2", config.ArcSession.ArcClientPeerIpAddress.String())
+	}
+
+	err = soratun.RotateKeysWithProfile(&soratun.Config{SimId: "8942310022000000000"})
+	assert.ErrorContains(t, err, "no SORACOM API profile")
+}
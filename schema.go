@@ -0,0 +1,383 @@
+package soratun
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//go:embed docs/schema/soratun-config.en.schema.json
+var configSchemaJSON []byte
+
+// A ValidationError is a problem found in the configuration.
+type ValidationError struct {
+	// Path is the path to the field, e.g. "arcSession.arcAllowedIPs[0]". Empty for the whole configuration.
+	Path string
+	// Line and Column are 1-based position of the field in the configuration file, or 0 if unknown.
+	Line   int
+	Column int
+	// Message describes the problem.
+	Message string
+	// Warning is true if the problem does not prevent soratun from working.
+	Warning bool
+}
+
+func (e ValidationError) Error() string {
+	var b strings.Builder
+	if e.Line > 0 {
+		fmt.Fprintf(&b, "%d:%d: ", e.Line, e.Column)
+	}
+	if e.Warning {
+		b.WriteString("warning: ")
+	}
+	if e.Path != "" {
+		fmt.Fprintf(&b, "%s: ", e.Path)
+	}
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+// jsonSchema is the subset of JSON Schema used by soratun configuration schema.
+type jsonSchema struct {
+	Type                 schemaTypes            `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *additionalProperties  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	Pattern              string                 `json:"pattern"`
+	Format               string                 `json:"format"`
+}
+
+// schemaTypes is "type" keyword, which is a string or an array of strings.
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*t = []string{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(t))
+}
+
+// additionalProperties is "additionalProperties" keyword, which is a boolean or a schema.
+type additionalProperties struct {
+	allowed bool
+	schema  *jsonSchema
+}
+
+func (a *additionalProperties) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &a.allowed); err == nil {
+		return nil
+	}
+	a.allowed = true
+	return json.Unmarshal(b, &a.schema)
+}
+
+var configSchema = func() *jsonSchema {
+	var s jsonSchema
+	if err := json.Unmarshal(configSchemaJSON, &s); err != nil {
+		panic(fmt.Sprintf("invalid embedded configuration schema: %v", err))
+	}
+	return &s
+}()
+
+// ValidateConfigSchema validates the configuration in JSON against the configuration schema, and returns problems with
+// their positions.
+func ValidateConfigSchema(b []byte) []ValidationError {
+	root, err := parseJSONNode(b)
+	if err != nil {
+		// the streaming decoder may report a misleading error, so prefer the one of the standard decoder
+		var v interface{}
+		if uerr := json.Unmarshal(b, &v); uerr != nil {
+			err = uerr
+		}
+		line, column := 0, 0
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			line, column = lineColumn(b, int(syntaxErr.Offset))
+		}
+		return []ValidationError{{Line: line, Column: column, Message: err.Error()}}
+	}
+
+	errs := configSchema.validate(root, "")
+	for i := range errs {
+		errs[i].Line, errs[i].Column = root.position(b, errs[i].Path)
+	}
+	return errs
+}
+
+// LocateValidationErrors fills positions of errs, which are found in the configuration b.
+func LocateValidationErrors(b []byte, errs []ValidationError) {
+	root, err := parseJSONNode(b)
+	if err != nil {
+		return
+	}
+	for i := range errs {
+		if errs[i].Line == 0 {
+			errs[i].Line, errs[i].Column = root.position(b, errs[i].Path)
+		}
+	}
+}
+
+func (s *jsonSchema) validate(n *jsonNode, path string) []ValidationError {
+	if len(s.Type) > 0 && !s.hasType(n) {
+		return []ValidationError{{Path: path, Message: fmt.Sprintf("should be %s, but got %s", strings.Join(s.Type, " or "), n.typeName())}}
+	}
+
+	var errs []ValidationError
+	add := func(format string, a ...interface{}) {
+		errs = append(errs, ValidationError{Path: path, Message: fmt.Sprintf(format, a...)})
+	}
+
+	switch v := n.value.(type) {
+	case string:
+		length := len([]rune(v))
+		if s.MinLength != nil && length < *s.MinLength {
+			add("should be at least %d characters, but got %d", *s.MinLength, length)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			add("should be at most %d characters, but got %d", *s.MaxLength, length)
+		}
+		if s.Pattern != "" {
+			if re, err := regexp.Compile(s.Pattern); err == nil && !re.MatchString(v) {
+				add("%q does not match pattern %q", v, s.Pattern)
+			}
+		}
+		if s.Format == "ipv4" {
+			if ip := net.ParseIP(v); ip == nil || ip.To4() == nil {
+				add("%q is not an IPv4 address", v)
+			}
+		}
+	case json.Number:
+		f, _ := v.Float64()
+		if s.Minimum != nil && f < *s.Minimum {
+			add("should be greater than or equal to %v, but got %v", *s.Minimum, v)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			add("should be less than or equal to %v, but got %v", *s.Maximum, v)
+		}
+	case []*jsonNode:
+		if s.Items != nil {
+			for i, item := range v {
+				errs = append(errs, s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case map[string]*jsonNode:
+		for _, key := range s.Required {
+			if _, ok := v[key]; !ok {
+				add("required property %q is missing", key)
+			}
+		}
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return v[keys[i]].offset < v[keys[j]].offset })
+
+		for _, key := range keys {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+
+			if p, ok := s.Properties[key]; ok {
+				errs = append(errs, p.validate(v[key], childPath)...)
+				continue
+			}
+			if s.AdditionalProperties == nil {
+				continue
+			}
+			if !s.AdditionalProperties.allowed {
+				errs = append(errs, ValidationError{Path: childPath, Message: "unknown property"})
+			} else if s.AdditionalProperties.schema != nil {
+				errs = append(errs, s.AdditionalProperties.schema.validate(v[key], childPath)...)
+			}
+		}
+	}
+	return errs
+}
+
+func (s *jsonSchema) hasType(n *jsonNode) bool {
+	for _, t := range s.Type {
+		switch t {
+		case n.typeName():
+			return true
+		case "number":
+			if n.typeName() == "integer" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonNode is a JSON value with its offset in the source.
+type jsonNode struct {
+	// value is one of nil, bool, string, json.Number, []*jsonNode and map[string]*jsonNode.
+	value  interface{}
+	offset int
+}
+
+func (n *jsonNode) typeName() string {
+	switch v := n.value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []*jsonNode:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// position returns line and column of the node at the path, or of the nearest existing parent.
+func (n *jsonNode) position(b []byte, path string) (int, int) {
+	node := n
+	for _, part := range splitJSONPath(path) {
+		var next *jsonNode
+		switch v := node.value.(type) {
+		case map[string]*jsonNode:
+			next = v[part.key]
+		case []*jsonNode:
+			if part.index >= 0 && part.index < len(v) {
+				next = v[part.index]
+			}
+		}
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	return lineColumn(b, node.offset)
+}
+
+type jsonPathPart struct {
+	key   string
+	index int
+}
+
+// splitJSONPath splits a path such as "a.b[0]" into parts.
+func splitJSONPath(path string) []jsonPathPart {
+	var parts []jsonPathPart
+	if path == "" {
+		return parts
+	}
+	for _, key := range strings.Split(path, ".") {
+		indexes := ""
+		if i := strings.Index(key, "["); i >= 0 {
+			key, indexes = key[:i], key[i:]
+		}
+		parts = append(parts, jsonPathPart{key: key, index: -1})
+		for _, s := range strings.Split(indexes, "[") {
+			var index int
+			if _, err := fmt.Sscanf(s, "%d]", &index); err == nil {
+				parts = append(parts, jsonPathPart{index: index})
+			}
+		}
+	}
+	return parts
+}
+
+func parseJSONNode(b []byte) (*jsonNode, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+
+	n, err := parseJSONNodeValue(d, b)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := d.Token(); err == nil {
+		return nil, errors.New("invalid character after top-level value")
+	}
+	return n, nil
+}
+
+func parseJSONNodeValue(d *json.Decoder, b []byte) (*jsonNode, error) {
+	offset := skipJSONSeparators(b, int(d.InputOffset()))
+	t, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	n := &jsonNode{value: t, offset: offset}
+	switch t {
+	case json.Delim('{'):
+		obj := map[string]*jsonNode{}
+		for d.More() {
+			keyOffset := skipJSONSeparators(b, int(d.InputOffset()))
+			t, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, _ := t.(string)
+			v, err := parseJSONNodeValue(d, b)
+			if err != nil {
+				return nil, err
+			}
+			// point the key rather than the value, which is more natural for errors
+			v.offset = keyOffset
+			obj[key] = v
+		}
+		if _, err := d.Token(); err != nil {
+			return nil, err
+		}
+		n.value = obj
+	case json.Delim('['):
+		arr := []*jsonNode{}
+		for d.More() {
+			v, err := parseJSONNodeValue(d, b)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		if _, err := d.Token(); err != nil {
+			return nil, err
+		}
+		n.value = arr
+	}
+	return n, nil
+}
+
+// skipJSONSeparators returns the offset of the next token, skipping white spaces, commas and colons.
+func skipJSONSeparators(b []byte, offset int) int {
+	for offset < len(b) {
+		switch b[offset] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			offset++
+		default:
+			return offset
+		}
+	}
+	return offset
+}
+
+// lineColumn converts the offset in b into 1-based line and column.
+func lineColumn(b []byte, offset int) (int, int) {
+	if offset > len(b) {
+		offset = len(b)
+	}
+	line := 1 + bytes.Count(b[:offset], []byte("\n"))
+	column := offset - bytes.LastIndexByte(b[:offset], '\n')
+	return line, column
+}
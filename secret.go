@@ -0,0 +1,208 @@
+package soratun
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// encryptedSecretPrefix is the prefix of passphrase-encrypted secret, followed by base64-encoded scrypt salt,
+// XChaCha20-Poly1305 nonce and cipher text.
+const encryptedSecretPrefix = "soratun:v1:"
+
+const (
+	scryptN       = 1 << 15
+	scryptR       = 8
+	scryptP       = 1
+	scryptSaltLen = 16
+)
+
+// SecretRef refers to a secret which is stored outside of the configuration file, instead of embedding it in plain
+// text. Exactly one of the fields should be set.
+type SecretRef struct {
+	// Env is a name of the environment variable which holds the secret.
+	Env string `json:"env,omitempty"`
+	// File is a path to the file which holds the secret.
+	File string `json:"file,omitempty"`
+	// Credential is a name of systemd credential, which is read from $CREDENTIALS_DIRECTORY. See LoadCredential= in
+	// systemd.exec(5).
+	Credential string `json:"credential,omitempty"`
+	// Exec is a command and its arguments, which prints the secret to stdout.
+	Exec []string `json:"exec,omitempty"`
+	// Encrypted is the secret encrypted with passphrase. See EncryptSecret.
+	Encrypted string `json:"encrypted,omitempty"`
+}
+
+// A PassphraseFunc returns the passphrase for encrypted secrets.
+type PassphraseFunc func() (string, error)
+
+// Resolve returns the secret which r refers to. Leading and trailing white spaces are removed, except for encrypted
+// secrets. passphrase is called only for encrypted secrets.
+func (r *SecretRef) Resolve(passphrase PassphraseFunc) (string, error) {
+	switch {
+	case r.Env != "":
+		v, ok := os.LookupEnv(r.Env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", r.Env)
+		}
+		return strings.TrimSpace(v), nil
+	case r.File != "":
+		b, err := os.ReadFile(r.File)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(b)), nil
+	case r.Credential != "":
+		dir := os.Getenv("CREDENTIALS_DIRECTORY")
+		if dir == "" {
+			return "", fmt.Errorf("credential %s is referred but $CREDENTIALS_DIRECTORY is not set. Use LoadCredential= in the systemd unit", r.Credential)
+		}
+		b, err := os.ReadFile(filepath.Join(dir, r.Credential))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(b)), nil
+	case len(r.Exec) > 0:
+		var stderr bytes.Buffer
+		cmd := exec.Command(r.Exec[0], r.Exec[1:]...)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("failed to execute %s: %w: %s", r.Exec[0], err, strings.TrimSpace(stderr.String()))
+		}
+		return strings.TrimSpace(string(out)), nil
+	case r.Encrypted != "":
+		if passphrase == nil {
+			return "", errors.New("passphrase is required to decrypt secret")
+		}
+		p, err := passphrase()
+		if err != nil {
+			return "", err
+		}
+		return DecryptSecret(r.Encrypted, p)
+	default:
+		return "", errors.New("empty secret reference. One of env, file, credential, exec or encrypted is required")
+	}
+}
+
+// Update stores a new value of the secret, and returns the reference to it. Secrets in a file or encrypted can be
+// updated, while secrets in environment variables, systemd credentials and from commands are read-only.
+func (r *SecretRef) Update(value string, passphrase PassphraseFunc) (*SecretRef, error) {
+	switch {
+	case r.File != "":
+		if err := ReplaceFile(r.File, []byte(value+"\n"), nil); err != nil {
+			return nil, err
+		}
+		return r, nil
+	case r.Encrypted != "":
+		if passphrase == nil {
+			return nil, errors.New("passphrase is required to encrypt secret")
+		}
+		p, err := passphrase()
+		if err != nil {
+			return nil, err
+		}
+		encrypted, err := EncryptSecret(value, p)
+		if err != nil {
+			return nil, err
+		}
+		return &SecretRef{Encrypted: encrypted}, nil
+	default:
+		return nil, r.CheckUpdatable()
+	}
+}
+
+// CheckUpdatable returns an error if Update can not store a new value of the secret, so that callers can reject
+// operations which replace the secret before making any change.
+func (r *SecretRef) CheckUpdatable() error {
+	if r.File != "" || r.Encrypted != "" {
+		return nil
+	}
+	return fmt.Errorf("secret in %s can not be updated by soratun. Please update it manually", r.source())
+}
+
+func (r *SecretRef) source() string {
+	switch {
+	case r.Env != "":
+		return "environment variable " + r.Env
+	case r.Credential != "":
+		return "systemd credential " + r.Credential
+	case len(r.Exec) > 0:
+		return "output of " + r.Exec[0]
+	default:
+		return "unknown source"
+	}
+}
+
+// EncryptSecret encrypts value with a key derived from passphrase using scrypt, and returns it in the form of
+// "soratun:v1:<base64>".
+func EncryptSecret(value, passphrase string) (string, error) {
+	if passphrase == "" {
+		return "", errors.New("empty passphrase")
+	}
+
+	salt := make([]byte, scryptSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	aead, err := newSecretAEAD(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	b := append(salt, nonce...)
+	b = aead.Seal(b, nonce, []byte(value), []byte(encryptedSecretPrefix))
+	return encryptedSecretPrefix + base64.StdEncoding.EncodeToString(b), nil
+}
+
+// DecryptSecret decrypts a secret encrypted with EncryptSecret.
+func DecryptSecret(encrypted, passphrase string) (string, error) {
+	if !strings.HasPrefix(encrypted, encryptedSecretPrefix) {
+		return "", fmt.Errorf("unsupported encrypted secret, which should start with %q", encryptedSecretPrefix)
+	}
+
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encrypted, encryptedSecretPrefix))
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted secret: %w", err)
+	}
+	if len(b) < scryptSaltLen+chacha20poly1305.NonceSizeX {
+		return "", errors.New("malformed encrypted secret: too short")
+	}
+
+	salt, b := b[:scryptSaltLen], b[scryptSaltLen:]
+	aead, err := newSecretAEAD(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+
+	nonce, b := b[:aead.NonceSize()], b[aead.NonceSize():]
+	value, err := aead.Open(nil, nonce, b, []byte(encryptedSecretPrefix))
+	if err != nil {
+		return "", errors.New("failed to decrypt secret. The passphrase may be wrong")
+	}
+	return string(value), nil
+}
+
+func newSecretAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	return chacha20poly1305.NewX(key)
+}
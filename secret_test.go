@@ -0,0 +1,20 @@
+package soratun
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptSecret(t *testing.T) {
+	encrypted, err := EncryptSecret("secret-xxx", "passphrase")
+	assert.NoError(t, err)
+	assert.Regexp(t, "^soratun:v1:", encrypted)
+
+	decrypted, err := DecryptSecret(encrypted, "passphrase")
+	assert.NoError(t, err)
+	assert.Equal(t, "secret-xxx", decrypted)
+
+	_, err = DecryptSecret(encrypted, "wrong passphrase")
+	assert.Error(t, err)
+}
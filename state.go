@@ -0,0 +1,271 @@
+//go:build !windows
+
+package soratun
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// StateDir is the directory where soratun writes the state of running tunnels.
+var StateDir = "/var/run/soratun"
+
+var errInvalidState = errors.New("invalid tunnel state")
+
+// TunnelState is the state of a tunnel which soratun writes to StateDir while the tunnel is up, so that other commands
+// such as "soratun status" can tell tunnels managed by soratun from other WireGuard interfaces.
+type TunnelState struct {
+	// Interface is the actual name of the tunnel interface.
+	Interface string `json:"interface"`
+	// ConfiguredInterface is the interface name in the configuration, which may differ from Interface, e.g. "utun" on
+	// macOS.
+	ConfiguredInterface string `json:"configuredInterface"`
+	// PID is the process ID of soratun which manages the tunnel.
+	PID int `json:"pid"`
+	// UID is the user ID of soratun which manages the tunnel, which is not 0 if it has dropped privileges.
+	UID int `json:"uid"`
+	// SimId is the SIM ID of the virtual SIM.
+	SimId string `json:"simId,omitempty"`
+	// ArcClientPeerIpAddress is the IP address of this client.
+	ArcClientPeerIpAddress net.IP `json:"arcClientPeerIpAddress,omitempty"`
+	// StartedAt is when the tunnel is up.
+	StartedAt time.Time `json:"startedAt"`
+	// Probes holds results of connectivity probes through the tunnel.
+	Probes []ProbeResult `json:"probes,omitempty"`
+
+	mu sync.Mutex
+	// inPlace is true if the state file is prepared by prepareTunnelState, and has to be written in place since the
+	// process can't create files in StateDir.
+	inPlace bool
+	// owner is the user ID of the state file read by ReadTunnelStates.
+	owner int
+}
+
+func tunnelStatePath(iname string) string {
+	return filepath.Join(StateDir, iname+".json")
+}
+
+func newTunnelState(iname string, config *Config) *TunnelState {
+	s := &TunnelState{
+		Interface:           iname,
+		ConfiguredInterface: config.Interface,
+		PID:                 os.Getpid(),
+		UID:                 os.Getuid(),
+		SimId:               config.SimId,
+		StartedAt:           time.Now(),
+		inPlace:             config.User != "",
+	}
+	if config.ArcSession != nil {
+		s.ArcClientPeerIpAddress = config.ArcSession.ArcClientPeerIpAddress
+	}
+	return s
+}
+
+// update calls f with the state locked, then writes the state. The state is updated concurrently, e.g. by the key
+// rotation and connectivity probes.
+func (s *TunnelState) update(f func(s *TunnelState)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f(s)
+	return s.writeLocked()
+}
+
+func (s *TunnelState) write() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.writeLocked()
+}
+
+// writeLocked writes the state atomically so that readers never see a partially written file.
+func (s *TunnelState) writeLocked() error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := tunnelStatePath(s.Interface)
+	if s.inPlace {
+		return writeStateInPlace(path, b)
+	}
+
+	if err := os.MkdirAll(StateDir, 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// prepareTunnelState creates the state file of the interface owned by uid and gid, so that soratun can write the state
+// after dropping privileges. StateDir is kept writable only by root, since root trusts the state files, e.g. "soratun
+// rotate-keys" sends a signal to the process in the state.
+func prepareTunnelState(iname string, uid, gid int) error {
+	if err := os.MkdirAll(StateDir, 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	// older soratun made the directory writable by the group
+	if err := os.Chown(StateDir, 0, 0); err != nil {
+		return fmt.Errorf("failed to change owner of state directory: %w", err)
+	}
+	if err := os.Chmod(StateDir, 0755); err != nil {
+		return fmt.Errorf("failed to change mode of state directory: %w", err)
+	}
+
+	f, err := os.OpenFile(tunnelStatePath(iname), os.O_WRONLY|os.O_CREATE|os.O_TRUNC|syscall.O_NOFOLLOW, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create tunnel state: %w", err)
+	}
+	defer f.Close()
+
+	if err := f.Chown(uid, gid); err != nil {
+		return fmt.Errorf("failed to change owner of tunnel state: %w", err)
+	}
+	return nil
+}
+
+// writeStateInPlace overwrites the state file with b, holding an exclusive lock so that readers never see a partially
+// written file.
+func writeStateInPlace(path string, b []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	return err
+}
+
+// readState reads the state file, holding a shared lock. See writeStateInPlace.
+func readState(path string) (*TunnelState, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_SH); err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		// left by the process which has dropped privileges, see remove
+		return nil, nil
+	}
+
+	var s TunnelState
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidState, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	s.owner = int(info.Sys().(*syscall.Stat_t).Uid)
+	return &s, nil
+}
+
+// clientIPAddress returns ArcClientPeerIpAddress, which may be updated by the key rotation.
+func (s *TunnelState) clientIPAddress() net.IP {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.ArcClientPeerIpAddress
+}
+
+func (s *TunnelState) remove() error {
+	if s.inPlace {
+		// the file can't be removed without write permission of StateDir, and is emptied instead
+		return writeStateInPlace(tunnelStatePath(s.Interface), nil)
+	}
+
+	err := os.Remove(tunnelStatePath(s.Interface))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Running returns true if the process which manages the tunnel is still running.
+func (s *TunnelState) Running() bool {
+	if s.PID <= 0 {
+		return false
+	}
+	err := syscall.Kill(s.PID, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// VerifyProcess returns an error unless the process in the state is soratun run by the owner of the state file, so that
+// a state file written by a user can't make root signal other processes.
+func (s *TunnelState) VerifyProcess() error {
+	name, uid, err := processInfo(s.PID)
+	if err != nil {
+		return fmt.Errorf("failed to find process %d: %w", s.PID, err)
+	}
+	if name != executableName() {
+		return fmt.Errorf("process %d is not soratun but %s", s.PID, name)
+	}
+	if uid != s.owner || uid != s.UID {
+		return fmt.Errorf("process %d is run by user %d, which does not own the state of %s", s.PID, uid, s.Interface)
+	}
+	return nil
+}
+
+// ReadTunnelStates returns states of tunnels which are managed by running soratun processes. States left by processes
+// which have exited, and states which can't be parsed, are ignored.
+func ReadTunnelStates() ([]*TunnelState, error) {
+	entries, err := os.ReadDir(StateDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state directory: %w", err)
+	}
+
+	var states []*TunnelState
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+
+		s, err := readState(filepath.Join(StateDir, e.Name()))
+		if errors.Is(err, os.ErrNotExist) {
+			// removed by the process which has just exited
+			continue
+		}
+		if errors.Is(err, errInvalidState) {
+			// a broken file should not hide other tunnels
+			fmt.Fprintf(os.Stderr, "WARNING: ignoring tunnel state %s: %v\n", filepath.Join(StateDir, e.Name()), err)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tunnel state: %w", err)
+		}
+		if s != nil && s.Running() {
+			states = append(states, s)
+		}
+	}
+	return states, nil
+}
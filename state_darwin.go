@@ -0,0 +1,33 @@
+package soratun
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxComLen is the maximum length of the process name in the kernel, MAXCOMLEN.
+const maxComLen = 16
+
+// processInfo returns the executable name, truncated to maxComLen, and the user ID of the process.
+func processInfo(pid int) (string, int, error) {
+	p, err := unix.SysctlKinfoProc("kern.proc.pid", pid)
+	if err != nil {
+		return "", 0, err
+	}
+	return unix.ByteSliceToString(p.Proc.P_comm[:]), int(p.Eproc.Ucred.Uid), nil
+}
+
+// executableName returns the executable name of this process, to be compared with processInfo.
+func executableName() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	name := filepath.Base(exe)
+	if len(name) > maxComLen {
+		name = name[:maxComLen]
+	}
+	return name
+}
@@ -0,0 +1,33 @@
+package soratun
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// processInfo returns the executable name and the user ID of the process.
+func processInfo(pid int) (string, int, error) {
+	dir := fmt.Sprintf("/proc/%d", pid)
+	exe, err := os.Readlink(filepath.Join(dir, "exe"))
+	if err != nil {
+		return "", 0, err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", 0, err
+	}
+	// the executable may have been replaced by an upgrade
+	return filepath.Base(strings.TrimSuffix(exe, " (deleted)")), int(info.Sys().(*syscall.Stat_t).Uid), nil
+}
+
+// executableName returns the executable name of this process, to be compared with processInfo.
+func executableName() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(exe)
+}
@@ -0,0 +1,63 @@
+//go:build !windows
+
+package soratun
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTunnelState_inPlace(t *testing.T) {
+	stateDir := StateDir
+	StateDir = filepath.Join(t.TempDir(), "soratun")
+	defer func() {
+		StateDir = stateDir
+	}()
+
+	if os.Geteuid() == 0 {
+		assert.NoError(t, prepareTunnelState("soratun0", os.Getuid(), os.Getgid()))
+		info, err := os.Stat(StateDir)
+		if assert.NoError(t, err) {
+			assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+		}
+	} else {
+		assert.NoError(t, os.MkdirAll(StateDir, 0755))
+		assert.NoError(t, os.WriteFile(tunnelStatePath("soratun0"), nil, 0644))
+	}
+
+	// the state is written to the prepared file, and emptied when the tunnel is down
+	s := newTunnelState("soratun0", &Config{Interface: "soratun0", User: "soratun"})
+	assert.NoError(t, s.write())
+	states, err := ReadTunnelStates()
+	if assert.NoError(t, err) && assert.Len(t, states, 1) {
+		assert.Equal(t, os.Getpid(), states[0].PID)
+		assert.Equal(t, os.Getuid(), states[0].UID)
+		assert.NoError(t, states[0].VerifyProcess())
+	}
+
+	assert.NoError(t, s.remove())
+	states, err = ReadTunnelStates()
+	assert.NoError(t, err)
+	assert.Empty(t, states)
+}
+
+func TestTunnelState_VerifyProcess(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("failed to start sleep: %v", err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	s := &TunnelState{Interface: "soratun0", PID: cmd.Process.Pid, UID: os.Getuid(), owner: os.Getuid()}
+	assert.ErrorContains(t, s.VerifyProcess(), "is not soratun but sleep")
+
+	s = &TunnelState{Interface: "soratun0", PID: os.Getpid(), UID: os.Getuid(), owner: os.Getuid() + 1}
+	assert.ErrorContains(t, s.VerifyProcess(), "does not own the state of soratun0")
+}
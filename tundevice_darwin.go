@@ -0,0 +1,33 @@
+package soratun
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+	"golang.zx2c4.com/wireguard/tun"
+)
+
+// createTUN creates a new utun device, or attaches to the utun device specified with config.TunFd. It returns whether
+// the device is monitored, which is always true on macOS.
+func createTUN(config *Config) (tun.Device, bool, error) {
+	if config.UsePersistentTun {
+		return nil, false, errors.New("persistent TUN device is not supported on macOS")
+	}
+
+	if config.TunFd > 0 {
+		// the file descriptor must be non-blocking before it is handed to the runtime poller
+		if err := unix.SetNonblock(config.TunFd, true); err != nil {
+			return nil, false, fmt.Errorf("failed to attach to utun device (fd %d): %w", config.TunFd, err)
+		}
+		t, err := tun.CreateTUNFromFile(os.NewFile(uintptr(config.TunFd), "utun"), config.Mtu)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to attach to utun device (fd %d): %w", config.TunFd, err)
+		}
+		return t, true, nil
+	}
+
+	t, err := tun.CreateTUN(config.Interface, config.Mtu)
+	return t, true, err
+}
@@ -0,0 +1,84 @@
+package soratun
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+	"golang.zx2c4.com/wireguard/tun"
+)
+
+const tunCloneDevicePath = "/dev/net/tun"
+
+// createTUN creates a new TUN device, or attaches to the TUN device specified with config.TunFd or
+// config.UsePersistentTun. Setting MTU of the device requires CAP_NET_ADMIN, so the device is left unmonitored if
+// config.SkipInterfaceConfiguration is true, and the caller has to bring up the WireGuard device by itself. It returns
+// whether the device is monitored.
+func createTUN(config *Config) (tun.Device, bool, error) {
+	var fd int
+	switch {
+	case config.TunFd > 0:
+		fd = config.TunFd
+	case config.UsePersistentTun:
+		var err error
+		if fd, err = openPersistentTUN(config.Interface); err != nil {
+			return nil, false, err
+		}
+	default:
+		t, err := tun.CreateTUN(config.Interface, config.Mtu)
+		return t, true, err
+	}
+
+	if config.SkipInterfaceConfiguration {
+		t, _, err := tun.CreateUnmonitoredTUNFromFD(fd)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to attach to TUN device (fd %d): %w", fd, err)
+		}
+		return t, false, nil
+	}
+
+	// the file descriptor must be non-blocking before it is handed to the runtime poller
+	if err := unix.SetNonblock(fd, true); err != nil {
+		return nil, false, fmt.Errorf("failed to attach to TUN device (fd %d): %w", fd, err)
+	}
+	t, err := tun.CreateTUNFromFile(os.NewFile(uintptr(fd), tunCloneDevicePath), config.Mtu)
+	if errors.Is(err, unix.EPERM) {
+		return nil, false, fmt.Errorf("failed to attach to TUN device (fd %d): %w. Enable skipInterfaceConfiguration to attach without CAP_NET_ADMIN", fd, err)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to attach to TUN device (fd %d): %w", fd, err)
+	}
+	return t, true, nil
+}
+
+// openPersistentTUN attaches to the persistent TUN device, and returns its file descriptor. It does not require any
+// privileges if the device is owned by the user or the group of the process.
+func openPersistentTUN(name string) (int, error) {
+	// TUNSETIFF creates a new device if there is no device with the name
+	if _, err := net.InterfaceByName(name); err != nil {
+		return -1, fmt.Errorf("persistent TUN device %s is not found. Create it with \"ip tuntap add dev %s mode tun user <user>\"", name, name)
+	}
+
+	fd, err := unix.Open(tunCloneDevicePath, unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, fmt.Errorf("failed to open %s: %w", tunCloneDevicePath, err)
+	}
+
+	ifr, err := unix.NewIfreq(name)
+	if err != nil {
+		_ = unix.Close(fd)
+		return -1, err
+	}
+	// same flags as tun.CreateTUN, IFF_VNET_HDR is set per attachment and does not have to match the device
+	ifr.SetUint16(unix.IFF_TUN | unix.IFF_NO_PI | unix.IFF_VNET_HDR)
+	if err := unix.IoctlIfreq(fd, unix.TUNSETIFF, ifr); err != nil {
+		_ = unix.Close(fd)
+		if errors.Is(err, unix.EPERM) {
+			return -1, fmt.Errorf("failed to attach to persistent TUN device %s, which is not owned by the user or the group: %w", name, err)
+		}
+		return -1, fmt.Errorf("failed to attach to persistent TUN device %s: %w", name, err)
+	}
+	return fd, nil
+}
@@ -0,0 +1,47 @@
+package soratun
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+)
+
+func TestCreateTUN_persistent(t *testing.T) {
+	_, _, err := createTUN(&Config{Interface: "soratun-none", UsePersistentTun: true})
+	assert.ErrorContains(t, err, "persistent TUN device soratun-none is not found")
+
+	if os.Geteuid() != 0 {
+		t.Skip("creating a persistent TUN device requires root")
+	}
+	link := &netlink.Tuntap{LinkAttrs: netlink.LinkAttrs{Name: "soratun-test"}, Mode: netlink.TUNTAP_MODE_TUN, Flags: netlink.TUNTAP_NO_PI}
+	if err := netlink.LinkAdd(link); err != nil {
+		t.Skipf("failed to create a persistent TUN device: %v", err)
+	}
+	defer func() {
+		_ = netlink.LinkDel(link)
+	}()
+	for _, f := range link.Fds {
+		_ = f.Close()
+	}
+
+	d, monitored, err := createTUN(&Config{Interface: "soratun-test", UsePersistentTun: true, SkipInterfaceConfiguration: true})
+	if assert.NoError(t, err) {
+		assert.False(t, monitored)
+		name, _ := d.Name()
+		assert.Equal(t, "soratun-test", name)
+		assert.NoError(t, d.Close())
+	}
+
+	fd, err := openPersistentTUN("soratun-test")
+	if assert.NoError(t, err) {
+		d, monitored, err = createTUN(&Config{Interface: "ignored", TunFd: fd, Mtu: 1280})
+		if assert.NoError(t, err) {
+			assert.True(t, monitored)
+			mtu, _ := d.MTU()
+			assert.Equal(t, 1280, mtu)
+			assert.NoError(t, d.Close())
+		}
+	}
+}
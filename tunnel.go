@@ -5,6 +5,7 @@ package soratun
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -20,7 +21,6 @@ import (
 	"golang.zx2c4.com/wireguard/conn"
 	"golang.zx2c4.com/wireguard/device"
 	"golang.zx2c4.com/wireguard/ipc"
-	"golang.zx2c4.com/wireguard/tun"
 	"golang.zx2c4.com/wireguard/wgctrl"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
@@ -42,12 +42,53 @@ const (
 	LogLevelSilent = device.LogLevelSilent
 	// DefaultPersistentKeepaliveInterval defines WireGuard persistent keepalive interval to SORACOM Arc.
 	DefaultPersistentKeepaliveInterval = 60
+	// PersistentKeepaliveOff disables WireGuard persistent keepalive, since 0 means DefaultPersistentKeepaliveInterval.
+	PersistentKeepaliveOff = -1
 	// DefaultMTU is MTU for the configured interface.
 	DefaultMTU = device.DefaultMTU
 )
 
+// An UpOption configures optional behavior of Up.
+type UpOption func(*upOptions)
+
+type upOptions struct {
+	configUpdatedHandler func(config *Config) error
+	configReloader       func() (*Config, error)
+	healthPolicy         HealthPolicy
+}
+
+// WithConfigUpdatedHandler sets a handler which will be called when Up updates config while the tunnel is up, e.g. after
+// the key rotation. The handler is expected to persist config.
+func WithConfigUpdatedHandler(handler func(config *Config) error) UpOption {
+	return func(o *upOptions) {
+		o.configUpdatedHandler = handler
+	}
+}
+
+// WithConfigReloader sets a function which reads the configuration again when Up receives SIGHUP, e.g. from "soratun
+// rotate-keys". Only the key pair and the Arc session are applied to the running tunnel. It is not used after dropping
+// privileges, when they are read from the device instead.
+func WithConfigReloader(reloader func() (*Config, error)) UpOption {
+	return func(o *upOptions) {
+		o.configReloader = reloader
+	}
+}
+
+// WithHealthPolicy sets a policy which decides whether to update the systemd watchdog timer, instead of
+// DefaultHealthPolicy.
+func WithHealthPolicy(policy HealthPolicy) UpOption {
+	return func(o *upOptions) {
+		o.healthPolicy = policy
+	}
+}
+
 // Up ups new SORACOM Arc tunnel with given ArcSession.
-func Up(ctx context.Context, config *Config) {
+func Up(ctx context.Context, config *Config, opts ...UpOption) {
+	var options upOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	iname := config.Interface
 
 	logger := device.NewLogger(
@@ -56,15 +97,22 @@ func Up(ctx context.Context, config *Config) {
 	)
 
 	if isWatchdogEnabled() {
-		logger.Verbosef("systemd watchdog is available. Will update watchdog timer every %s seconds", watchdogTimeout)
+		logger.Verbosef("systemd watchdog is available. Will update watchdog timer every %s", watchdogInterval())
 		_, err := daemon.SdNotify(false, daemon.SdNotifyReloading)
 		if err != nil {
 			logger.Errorf("failed to notify reloading to systemd")
 		}
 	}
 
+	if config.Preflight != nil && config.Preflight.Timeout > 0 {
+		if err := preflightHandshake(ctx, config, options.configUpdatedHandler, logger); err != nil {
+			logger.Errorf("pre-flight handshake with %s:%d failed: %v", config.ArcSession.ArcServerEndpoint.IP, config.ArcSession.ArcServerEndpoint.Port, err)
+			os.Exit(1)
+		}
+	}
+
 	// specified interface name and actual interface name may vary
-	t, err := tun.CreateTUN(iname, config.Mtu)
+	t, monitored, err := createTUN(config)
 	if err != nil {
 		logger.Errorf("failed to create new tunnel: %v", err)
 		os.Exit(1)
@@ -130,40 +178,55 @@ func Up(ctx context.Context, config *Config) {
 		}
 	}()
 
-	var allowedIPs []net.IPNet
-	for _, v := range config.ArcSession.ArcAllowedIPs {
-		allowedIPs = append(allowedIPs, (net.IPNet)(*v))
-	}
-
-	err = client.ConfigureDevice(iname, wgtypes.Config{
-		PrivateKey:   config.PrivateKey.AsWgKey(),
-		FirewallMark: nil,
-		ReplacePeers: true,
-		Peers: []wgtypes.PeerConfig{
-			{
-				PublicKey: *config.ArcSession.ArcServerPeerPublicKey.AsWgKey(),
-				Endpoint: &net.UDPAddr{
-					IP:   config.ArcSession.ArcServerEndpoint.IP,
-					Port: config.ArcSession.ArcServerEndpoint.Port,
-				},
-				PersistentKeepaliveInterval: duration(time.Duration(config.PersistentKeepalive) * time.Second),
-				ReplaceAllowedIPs:           true,
-				AllowedIPs:                  allowedIPs,
-			},
-		},
-	})
+	err = client.ConfigureDevice(iname, deviceConfig(config))
 	if err != nil {
 		logger.Errorf("failed to configure new device %s: %v", iname, err)
 		d.Close()
 		os.Exit(1)
 	}
 
-	if err = ConfigureInterface(iname, config); err != nil {
+	if config.SkipInterfaceConfiguration {
+		logger.Verbosef("skipped configuring %s, assign IP address %s to it", iname, config.ArcSession.ArcClientPeerIpAddress)
+	} else if err = ConfigureInterface(iname, config); err != nil {
 		logger.Errorf("error: %s\n", err)
 		d.Close()
 		os.Exit(1)
 	}
 
+	// an unmonitored device is not brought up by the link state of the interface
+	if !monitored {
+		if err := d.Up(); err != nil {
+			logger.Errorf("failed to bring up device: %v", err)
+			d.Close()
+			os.Exit(1)
+		}
+	}
+
+	// the health endpoint may listen on a privileged port
+	var healthListener net.Listener
+	if config.HealthListen != "" {
+		healthListener, err = net.Listen("tcp", config.HealthListen)
+		if err != nil {
+			logger.Errorf("failed to listen on %s for health endpoint: %v", config.HealthListen, err)
+		}
+	}
+
+	if config.User != "" {
+		if err := dropPrivileges(config, iname); err != nil {
+			logger.Errorf("failed to drop privileges to user %s: %v", config.User, err)
+			d.Close()
+			os.Exit(1)
+		}
+		logger.Verbosef("dropped privileges to user %s, keeping CAP_NET_ADMIN", config.User)
+	}
+
+	hookCred, err := hookCredential(config)
+	if err != nil {
+		logger.Errorf("failed to find user for hooks: %v", err)
+		d.Close()
+		os.Exit(1)
+	}
+
 	if len(config.PostUp) > 0 {
 		for i, com := range config.PostUp {
 			if len(com) == 0 || com[0] == "" {
@@ -172,7 +235,7 @@ func Up(ctx context.Context, config *Config) {
 
 			command := replaceInterfaceName(com, iname)
 			logger.Verbosef("executing PostUp(%d): %s", i, command)
-			result, err := runCommand(command)
+			result, err := runCommand(command, hookCred)
 			if err != nil {
 				logger.Errorf("failed to do PostUp(%d): %s\n", i, err)
 				d.Close()
@@ -182,36 +245,178 @@ func Up(ctx context.Context, config *Config) {
 		}
 	}
 
+	state := newTunnelState(iname, config)
+	if err := state.write(); err != nil {
+		logger.Errorf("failed to write tunnel state: %v", err)
+	}
+	defer func() {
+		if err := state.remove(); err != nil {
+			logger.Errorf("failed to remove tunnel state: %v", err)
+		}
+	}()
+
+	// background tasks below stop when the tunnel is down
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var prober *connectivityProber
+	if config.Probes != nil && len(config.Probes.Targets) > 0 {
+		prober = newConnectivityProber(config.Probes, state.clientIPAddress)
+		go prober.run(runCtx, func() {
+			results := prober.Results()
+			if err := state.update(func(s *TunnelState) { s.Probes = results }); err != nil {
+				logger.Errorf("failed to write tunnel state: %v", err)
+			}
+			for _, r := range results {
+				if r.LastError != "" {
+					logger.Verbosef("connectivity probe to %s failed: %s", r.Target, r.LastError)
+				}
+				if config.EnableMetrics {
+					logger.Verbosef("soratun_probe_rtt_seconds{simId=\"%s\",interface=\"%s\",target=\"%s\"} %f", config.SimId, iname, r.Target, r.RTT)
+					logger.Verbosef("soratun_probe_jitter_seconds{simId=\"%s\",interface=\"%s\",target=\"%s\"} %f", config.SimId, iname, r.Target, r.Jitter)
+					logger.Verbosef("soratun_probe_loss_ratio{simId=\"%s\",interface=\"%s\",target=\"%s\"} %f", config.SimId, iname, r.Target, r.Loss)
+				}
+			}
+		})
+	}
+
+	snapshot := func() *TunnelSnapshot {
+		s := &TunnelSnapshot{Now: time.Now(), StartedAt: state.StartedAt}
+		d, err := client.Device(iname)
+		if err != nil {
+			s.DeviceErr = err
+		} else {
+			for _, p := range d.Peers {
+				s.LatestHandshake = p.LastHandshakeTime
+			}
+		}
+		if prober != nil {
+			s.Probes = prober.Results()
+		}
+		return s
+	}
+
+	if healthListener != nil {
+		go serveHealth(runCtx, healthListener, func() HealthReport {
+			return newHealthReport(iname, snapshot())
+		}, logger)
+	}
+
 	if isWatchdogEnabled() {
+		policy := options.healthPolicy
+		if policy == nil {
+			policy = NewDefaultHealthPolicy(config)
+		}
+
 		_, err = daemon.SdNotify(false, daemon.SdNotifyReady)
 		if err != nil {
 			logger.Errorf("failed to notify ready to systemd")
 		}
 		go func() {
-			ticker := time.NewTicker(watchdogTimeout)
+			ticker := time.NewTicker(watchdogInterval())
 			defer ticker.Stop()
 
+			wasAlive := true
 			for {
-				<-ticker.C
-				d, err := client.Device(iname)
+				alive, reason := policy.Check(snapshot())
+				if alive != wasAlive {
+					if alive {
+						logger.Verbosef("tunnel is healthy again: %s", reason)
+					} else {
+						logger.Errorf("tunnel is unhealthy, watchdog timer will not be updated: %s", reason)
+					}
+					wasAlive = alive
+				}
+				_, err := daemon.SdNotify(false, watchdogNotification(alive, reason))
 				if err != nil {
 					logger.Errorf("failed to update watchdog timer to systemd")
-				} else {
-					for _, p := range d.Peers {
-						if time.Since(p.LastHandshakeTime) < watchdogTimeout {
-							_, err := daemon.SdNotify(false, daemon.SdNotifyWatchdog)
-							if err != nil {
-								logger.Errorf("failed to update watchdog timer to systemd")
-							} else {
-								logger.Verbosef("update watchdog timer")
-							}
-						}
-					}
+				} else if alive {
+					logger.Verbosef("update watchdog timer")
+				}
+
+				select {
+				case <-runCtx.Done():
+					return
+				case <-ticker.C:
 				}
 			}
 		}()
 	}
 
+	var rotation <-chan time.Time
+	if config.KeyRotationInterval > 0 {
+		if options.configUpdatedHandler == nil {
+			logger.Errorf("key rotation is disabled since rotated keys can't be persisted")
+		} else {
+			logger.Verbosef("keys will be rotated every %d seconds", config.KeyRotationInterval)
+			ticker := time.NewTicker(time.Duration(config.KeyRotationInterval) * time.Second)
+			defer ticker.Stop()
+			rotation = ticker.C
+		}
+	}
+
+	// "soratun rotate-keys" sends SIGHUP to reload the key pair and the Arc session from the configuration file. After
+	// dropping privileges, the configuration file may not be readable, and "soratun rotate-keys" applies them to the
+	// device instead, so that they are read from the device.
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+
+	// the goroutine below owns the key pair and the Arc session after the tunnel is up, and replaces them with copies
+	// of config, so that config is never modified while other goroutines read it
+	go func() {
+		current := config
+		sessionUpdated := func(next *Config) {
+			ip := next.ArcSession.ArcClientPeerIpAddress
+			if config.SkipInterfaceConfiguration && !ip.Equal(state.clientIPAddress()) {
+				logger.Errorf("IP address has changed to %s, assign it to %s", ip, iname)
+			}
+			if err := state.update(func(s *TunnelState) { s.ArcClientPeerIpAddress = ip }); err != nil {
+				logger.Errorf("failed to write tunnel state: %v", err)
+			}
+			current = next
+		}
+
+		for {
+			select {
+			case <-runCtx.Done():
+				return
+			case <-rotation:
+				rotated, err := rotateDeviceKeys(client, iname, current, options.configUpdatedHandler)
+				if rotated != nil {
+					logger.Verbosef("rotated keys, new public key: %s", rotated.PublicKey)
+					sessionUpdated(rotated)
+				}
+				if err != nil {
+					logger.Errorf("failed to rotate keys: %v", err)
+				}
+			case <-reload:
+				if config.User != "" {
+					synced, err := syncDeviceKeys(client, iname, current)
+					if err != nil {
+						logger.Errorf("failed to read keys from %s: %v", iname, err)
+						continue
+					}
+					logger.Verbosef("reloaded keys from %s, public key: %s", iname, synced.PublicKey)
+					sessionUpdated(synced)
+					continue
+				}
+				if options.configReloader == nil {
+					logger.Errorf("ignored SIGHUP since the configuration can't be reloaded")
+					continue
+				}
+				reloaded, err := reloadDeviceKeys(client, iname, current, options.configReloader)
+				if reloaded != nil {
+					logger.Verbosef("reloaded keys, public key: %s", reloaded.PublicKey)
+					sessionUpdated(reloaded)
+				}
+				if err != nil {
+					logger.Errorf("failed to reload keys: %v", err)
+				}
+			}
+		}
+	}()
+
 	if config.EnableMetrics {
 		go func() {
 			ticker := time.NewTicker(time.Second * 60)
@@ -243,6 +448,8 @@ func Up(ctx context.Context, config *Config) {
 	case <-ctx.Done():
 	}
 
+	// stop background tasks before closing the device
+	cancel()
 	d.Close()
 
 	if len(config.PostDown) > 0 {
@@ -253,7 +460,7 @@ func Up(ctx context.Context, config *Config) {
 
 			command := replaceInterfaceName(com, iname)
 			logger.Verbosef("executing PostDown(%d): %s", i, command)
-			result, err := runCommand(command)
+			result, err := runCommand(command, hookCred)
 			if err != nil {
 				logger.Errorf("failed to do PostDown(%d): %s\n", i, err)
 				os.Exit(1)
@@ -265,6 +472,143 @@ func Up(ctx context.Context, config *Config) {
 	logger.Verbosef("shutting down")
 }
 
+// UpdateDevice applies the key pair and the SORACOM Arc server peer in config to the running tunnel interface.
+func UpdateDevice(iname string, config *Config) error {
+	client, err := wgctrl.New()
+	if err != nil {
+		return fmt.Errorf("failed to open wgctrl: %w", err)
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	return client.ConfigureDevice(iname, deviceConfig(config))
+}
+
+// rotateDeviceKeys rotates keys of a copy of config with RotateKeysWithProfile, applies them to the running tunnel
+// interface, then persists them with the handler. The new keys are applied even if they can't be persisted, since the
+// old keys are unusable once a new session is created. It returns the rotated copy, or nil if no new session is
+// created.
+func rotateDeviceKeys(client *wgctrl.Client, iname string, config *Config, handler func(config *Config) error) (*Config, error) {
+	rotated := *config
+	if err := RotateKeysWithProfile(&rotated); err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	if err := applyDeviceKeys(client, iname, config, &rotated); err != nil {
+		errs = append(errs, err)
+	}
+	if err := handler(&rotated); err != nil {
+		errs = append(errs, fmt.Errorf("failed to persist rotated keys, the configuration file has old keys which are no longer usable: %w", err))
+	}
+	return &rotated, errors.Join(errs...)
+}
+
+// reloadDeviceKeys reloads the key pair and the Arc session with the reloader, and applies them to the running tunnel
+// interface. Other fields of config are kept as they are. It returns the updated copy of config, or nil if the
+// configuration can't be reloaded.
+func reloadDeviceKeys(client *wgctrl.Client, iname string, config *Config, reloader func() (*Config, error)) (*Config, error) {
+	c, err := reloader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reload configuration: %w", err)
+	}
+	if c.ArcSession == nil {
+		return nil, errors.New("no Arc session found in the configuration")
+	}
+
+	reloaded := *config
+	reloaded.PrivateKey = c.PrivateKey
+	reloaded.PublicKey = c.PublicKey
+	reloaded.ArcSession = c.ArcSession
+	return &reloaded, applyDeviceKeys(client, iname, config, &reloaded)
+}
+
+// syncDeviceKeys returns a copy of config with the key pair and the Arc session read from the running tunnel interface,
+// which have been applied by others, e.g. "soratun rotate-keys".
+func syncDeviceKeys(client *wgctrl.Client, iname string, config *Config) (*Config, error) {
+	dev, err := client.Device(iname)
+	if err != nil {
+		return nil, err
+	}
+	iface, err := net.InterfaceByName(iname)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	return sessionFromDevice(config, dev, addrs)
+}
+
+// sessionFromDevice returns a copy of config with the key pair and the Arc session of dev. The client IP address is
+// taken from addrs of the interface, and kept as is if the interface has no IPv4 address.
+func sessionFromDevice(config *Config, dev *wgtypes.Device, addrs []net.Addr) (*Config, error) {
+	if len(dev.Peers) != 1 {
+		return nil, fmt.Errorf("%s should have exactly one peer, but has %d", dev.Name, len(dev.Peers))
+	}
+	peer := dev.Peers[0]
+
+	synced := *config
+	synced.PrivateKey = Key(dev.PrivateKey)
+	synced.PublicKey = Key(dev.PublicKey)
+
+	session := *config.ArcSession
+	session.ArcServerPeerPublicKey = Key(peer.PublicKey)
+	if peer.Endpoint != nil {
+		session.ArcServerEndpoint = &UDPAddr{IP: peer.Endpoint.IP, Port: peer.Endpoint.Port}
+	}
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+			session.ArcClientPeerIpAddress = ipnet.IP
+			break
+		}
+	}
+	synced.ArcSession = &session
+	return &synced, nil
+}
+
+// applyDeviceKeys applies the key pair and the Arc session of next to the running tunnel interface, and assigns the new
+// IP address to the interface if it differs from previous.
+func applyDeviceKeys(client *wgctrl.Client, iname string, previous, next *Config) error {
+	if err := client.ConfigureDevice(iname, deviceConfig(next)); err != nil {
+		return fmt.Errorf("failed to configure device with new keys: %w", err)
+	}
+
+	if !previous.ArcSession.ArcClientPeerIpAddress.Equal(next.ArcSession.ArcClientPeerIpAddress) && !next.SkipInterfaceConfiguration {
+		if err := ConfigureInterface(iname, next); err != nil {
+			return fmt.Errorf("failed to configure interface with new IP address: %w", err)
+		}
+	}
+	return nil
+}
+
+func deviceConfig(config *Config) wgtypes.Config {
+	var allowedIPs []net.IPNet
+	for _, v := range config.AllowedIPs() {
+		allowedIPs = append(allowedIPs, (net.IPNet)(*v))
+	}
+
+	return wgtypes.Config{
+		PrivateKey:   config.PrivateKey.AsWgKey(),
+		FirewallMark: nil,
+		ReplacePeers: true,
+		Peers: []wgtypes.PeerConfig{
+			{
+				PublicKey: *config.ArcSession.ArcServerPeerPublicKey.AsWgKey(),
+				Endpoint: &net.UDPAddr{
+					IP:   config.ArcSession.ArcServerEndpoint.IP,
+					Port: config.ArcSession.ArcServerEndpoint.Port,
+				},
+				PersistentKeepaliveInterval: duration(time.Duration(max(config.PersistentKeepalive, 0)) * time.Second),
+				ReplaceAllowedIPs:           true,
+				AllowedIPs:                  allowedIPs,
+			},
+		},
+	}
+}
+
 func duration(d time.Duration) *time.Duration { return &d }
 
 func isWatchdogEnabled() bool {
@@ -281,8 +625,11 @@ func DefaultInterfaceName() string {
 	return iname
 }
 
-func runCommand(c []string) (string, error) {
-	result, err := exec.Command(c[0], c[1:]...).CombinedOutput()
+// runCommand runs c as cred, or as soratun itself if cred is nil.
+func runCommand(c []string, cred *syscall.Credential) (string, error) {
+	cmd := exec.Command(c[0], c[1:]...)
+	cmd.SysProcAttr = hookSysProcAttr(cred)
+	result, err := cmd.CombinedOutput()
 
 	if err != nil {
 		return "", fmt.Errorf(
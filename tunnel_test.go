@@ -0,0 +1,108 @@
+//go:build !windows
+
+package soratun
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestSessionFromDevice(t *testing.T) {
+	privateKey, publicKey, err := GenerateKeyPair()
+	assert.NoError(t, err)
+	_, serverKey, err := GenerateKeyPair()
+	assert.NoError(t, err)
+	oldPrivateKey, _, err := GenerateKeyPair()
+	assert.NoError(t, err)
+
+	config := &Config{
+		Interface:  "soratun0",
+		PrivateKey: oldPrivateKey,
+		User:       "soratun",
+		ArcSession: &ArcSession{
+			ArcServerEndpoint:      &UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 11010},
+			ArcAllowedIPs:          []*IPNet{{IP: net.IPv4(100, 127, 0, 0), Mask: net.IPv4Mask(255, 255, 0, 0)}},
+			ArcClientPeerIpAddress: net.IPv4(10, 0, 0, 1),
+		},
+	}
+
+	// keys applied by "soratun rotate-keys" as root are read from the device after dropping privileges
+	dev := &wgtypes.Device{
+		Name:       "soratun0",
+		PrivateKey: wgtypes.Key(privateKey),
+		PublicKey:  wgtypes.Key(publicKey),
+		Peers: []wgtypes.Peer{{
+			PublicKey: wgtypes.Key(serverKey),
+			Endpoint:  &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 11010},
+		}},
+	}
+	addrs := []net.Addr{
+		&net.IPNet{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)},
+		&net.IPNet{IP: net.IPv4(10, 0, 0, 2), Mask: net.CIDRMask(32, 32)},
+	}
+
+	synced, err := sessionFromDevice(config, dev, addrs)
+	if assert.NoError(t, err) {
+		assert.Equal(t, privateKey, synced.PrivateKey)
+		assert.Equal(t, publicKey, synced.PublicKey)
+		assert.Equal(t, serverKey, synced.ArcSession.ArcServerPeerPublicKey)
+		assert.Equal(t, "192.0.2.2", synced.ArcSession.ArcServerEndpoint.IP.String())
+		assert.Equal(t, "10.0.0.2", synced.ArcSession.ArcClientPeerIpAddress.String())
+		assert.Equal(t, config.ArcSession.ArcAllowedIPs, synced.ArcSession.ArcAllowedIPs)
+	}
+	// config is never modified
+	assert.Equal(t, oldPrivateKey, config.PrivateKey)
+	assert.Equal(t, "10.0.0.1", config.ArcSession.ArcClientPeerIpAddress.String())
+
+	dev.Peers = nil
+	_, err = sessionFromDevice(config, dev, addrs)
+	assert.Error(t, err)
+}
+
+func TestRotateDeviceKeys(t *testing.T) {
+	_, serverPublicKey, err := GenerateKeyPair()
+	assert.NoError(t, err)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"arcServerPeerPublicKey":"%s","arcServerEndpoint":"192.0.2.1:11010","arcAllowedIPs":["100.127.0.0/16"],"arcClientPeerIpAddress":"10.0.0.2"}`, serverPublicKey)
+	}))
+	defer api.Close()
+
+	client, err := wgctrl.New()
+	if err != nil {
+		t.Skipf("wgctrl is not available: %v", err)
+	}
+	defer client.Close()
+
+	privateKey, publicKey, err := GenerateKeyPair()
+	assert.NoError(t, err)
+	config := &Config{
+		SimId:      "8942310022000000000",
+		PrivateKey: privateKey,
+		PublicKey:  publicKey,
+		Profile:    &Profile{APIKey: "api-key", Token: "token", Endpoint: api.URL},
+		ArcSession: &ArcSession{ArcServerPeerPublicKey: serverPublicKey, ArcClientPeerIpAddress: net.ParseIP("10.0.0.1")},
+	}
+
+	// the rotated keys are returned to be used from now on, and the failures are reported
+	rotated, err := rotateDeviceKeys(client, "soratun-missing", config, func(c *Config) error {
+		return errors.New("read-only file system")
+	})
+	assert.ErrorContains(t, err, "failed to configure device with new keys")
+	assert.ErrorContains(t, err, "failed to persist rotated keys")
+	assert.ErrorContains(t, err, "read-only file system")
+	if assert.NotNil(t, rotated) {
+		assert.NotEqual(t, publicKey, rotated.PublicKey)
+		assert.Equal(t, "10.0.0.2", rotated.ArcSession.ArcClientPeerIpAddress.String())
+	}
+	// the original is not modified
+	assert.Equal(t, publicKey, config.PublicKey)
+	assert.Equal(t, "10.0.0.1", config.ArcSession.ArcClientPeerIpAddress.String())
+}
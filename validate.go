@@ -0,0 +1,156 @@
+package soratun
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+)
+
+const (
+	// MinMTU is the minimum MTU for the interface, which is the minimum datagram size every IPv4 host must accept.
+	MinMTU = 576
+	// MaxMTU is the maximum recommended MTU for the interface. Encapsulated packets larger than Ethernet MTU will be
+	// fragmented.
+	MaxMTU = 1500
+)
+
+// localRoute is a route in the routing table of the host.
+type localRoute struct {
+	Dst       *net.IPNet
+	Interface string
+}
+
+// Validate checks semantic rules of the configuration, which can not be expressed with the schema, such as consistency
+// between fields and conflicts with the host.
+func (c *Config) Validate() []ValidationError {
+	var errs []ValidationError
+	add := func(path string, warning bool, format string, a ...interface{}) {
+		errs = append(errs, ValidationError{Path: path, Warning: warning, Message: fmt.Sprintf(format, a...)})
+	}
+
+	if c.PrivateKey == (Key{}) {
+		add("privateKey", false, "private key is empty")
+	} else if c.PublicKey != (Key{}) && Key(c.PrivateKey.AsWgKey().PublicKey()) != c.PublicKey {
+		add("publicKey", false, "does not match privateKey, whose public key is %s", Key(c.PrivateKey.AsWgKey().PublicKey()))
+	}
+
+	if c.ArcSession == nil {
+		add("arcSession", false, "Arc session is missing. Please bootstrap or create a new session")
+	} else {
+		if c.ArcSession.ArcServerPeerPublicKey == (Key{}) {
+			add("arcSession.arcServerPeerPublicKey", false, "public key of SORACOM Arc server is missing")
+		}
+		if c.ArcSession.ArcServerEndpoint == nil {
+			add("arcSession.arcServerEndpoint", false, "endpoint of SORACOM Arc server is missing")
+		}
+		if c.ArcSession.ArcClientPeerIpAddress == nil {
+			add("arcSession.arcClientPeerIpAddress", false, "IP address of this client is missing")
+		}
+	}
+
+	if c.Mtu != 0 && c.Mtu < MinMTU {
+		add("mtu", false, "should be at least %d, but got %d", MinMTU, c.Mtu)
+	} else if c.Mtu > MaxMTU {
+		add("mtu", true, "%d is larger than %d, and encapsulated packets will be fragmented", c.Mtu, MaxMTU)
+	}
+
+	if c.TunFd < 0 {
+		add("tunFd", false, "should be a file descriptor, but got %d", c.TunFd)
+	} else if c.TunFd > 0 && c.UsePersistentTun {
+		add("usePersistentTun", false, "can't be used with tunFd")
+	}
+
+	if c.Preflight != nil && c.Preflight.RenewSession && c.Profile == nil {
+		add("preflight.renewSession", true, "Arc session can't be renewed without profile")
+	}
+
+	// "soratun up" can't ask the MFA code, and whether MFA is enabled is only known when authenticating
+	if c.Profile != nil && c.Profile.Email != "" {
+		if c.KeyRotationInterval > 0 {
+			add("keyRotationInterval", true, "keys can't be rotated if MFA is enabled for the root user in profile. Use SAM user or API token instead")
+		}
+		if c.Preflight != nil && c.Preflight.RenewSession {
+			add("preflight.renewSession", true, "Arc session can't be renewed if MFA is enabled for the root user in profile. Use SAM user or API token instead")
+		}
+	}
+
+	if c.Probes != nil {
+		for i, t := range c.Probes.Targets {
+			path := fmt.Sprintf("probes.targets[%d]", i)
+			switch t.Type {
+			case "icmp":
+				if t.Address == "" {
+					add(path+".address", false, "address is empty")
+				}
+			case "tcp":
+				if _, _, err := net.SplitHostPort(t.Address); err != nil {
+					add(path+".address", false, "should be host:port for tcp, but got %q", t.Address)
+				}
+			default:
+				add(path+".type", false, "should be icmp or tcp, but got %q", t.Type)
+			}
+		}
+	}
+
+	if c.User != "" {
+		if _, err := lookupCredential(c.User, c.Group); err != nil {
+			add("user", false, "%v", err)
+		}
+		if c.KeyRotationInterval > 0 {
+			add("keyRotationInterval", false, "can't be used with user, since the configuration file can't be updated after switching to the user")
+		}
+	} else if c.Group != "" {
+		add("group", true, "group is ignored without user")
+	}
+	if c.HookUser != "" {
+		if _, err := lookupCredential(c.HookUser, c.HookGroup); err != nil {
+			add("hookUser", false, "%v", err)
+		}
+	} else if c.HookGroup != "" {
+		add("hookGroup", true, "hookGroup is ignored without hookUser")
+	}
+
+	if c.HealthListen != "" {
+		if _, _, err := net.SplitHostPort(c.HealthListen); err != nil {
+			add("healthListen", false, "should be host:port, but got %q", c.HealthListen)
+		}
+	}
+
+	routes, err := localRoutes(c.Interface)
+	if err != nil {
+		add("", true, "failed to get local routes: %v", err)
+	}
+	check := func(path string, ipnet *IPNet) {
+		for _, r := range routes {
+			if r.Dst.Contains(ipnet.IP) || (*net.IPNet)(ipnet).Contains(r.Dst.IP) {
+				add(path, true, "%s overlaps with local route %s on %s", (*net.IPNet)(ipnet), r.Dst, r.Interface)
+			}
+		}
+	}
+	if c.ArcSession != nil {
+		for i, ipnet := range c.ArcSession.ArcAllowedIPs {
+			check(fmt.Sprintf("arcSession.arcAllowedIPs[%d]", i), ipnet)
+		}
+	}
+	for i, ipnet := range c.AdditionalAllowedIPs {
+		check(fmt.Sprintf("additionalAllowedIPs[%d]", i), ipnet)
+	}
+
+	for _, hooks := range []struct {
+		name     string
+		commands [][]string
+	}{{"postUp", c.PostUp}, {"postDown", c.PostDown}} {
+		for i, hook := range hooks.commands {
+			path := fmt.Sprintf("%s[%d]", hooks.name, i)
+			if len(hook) == 0 || hook[0] == "" {
+				add(path, true, "command is empty, and is skipped")
+				continue
+			}
+			if _, err := exec.LookPath(hook[0]); err != nil {
+				add(path, false, "command %q is not found", hook[0])
+			}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,102 @@
+package soratun
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateConfigSchema(t *testing.T) {
+	conf := `{
+  "privateKey": "8K4cUrwYpyE3jYeKyFvX3r3Ty+rOSYRKBr7QdGCBY1w=",
+  "publicKey": "5dTfnbPQrKRJhHBhazqHIzVKxA6Ga89rWWvdXnr0OCA=",
+  "simId": "8942310022000000000",
+  "logLevel": 2,
+  "enableMetrics": true,
+  "mtu": "1420",
+  "postUp": [["echo", 1]]
+}`
+	errs := ValidateConfigSchema([]byte(conf))
+	assert.Equal(t, []ValidationError{
+		{Path: "", Line: 1, Column: 1, Message: `required property "interface" is missing`},
+		{Path: "mtu", Line: 7, Column: 3, Message: "should be number, but got string"},
+		{Path: "postUp[0][1]", Line: 8, Column: 23, Message: "should be string, but got integer"},
+	}, errs)
+
+	errs = ValidateConfigSchema([]byte("{\n  \"mtu\": 1420,\n}"))
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, 3, errs[0].Line)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	conf := `{
+  "privateKey": "8K4cUrwYpyE3jYeKyFvX3r3Ty+rOSYRKBr7QdGCBY1w=",
+  "publicKey": "5dTfnbPQrKRJhHBhazqHIzVKxA6Ga89rWWvdXnr0OCA=",
+  "mtu": 9000,
+  "keyRotationInterval": 3600,
+  "tunFd": 3,
+  "usePersistentTun": true,
+  "preflight": {"timeout": 5, "renewSession": true},
+  "probes": {"targets": [{"type": "udp", "address": "100.127.0.1"}, {"type": "tcp", "address": "100.127.0.1"}]},
+  "healthListen": "9000",
+  "postUp": [["soratun-no-such-command"]],
+  "postDown": [[""]],
+  "user": "soratun-no-such-user",
+  "hookGroup": "nogroup"
+}`
+	var config Config
+	assert.NoError(t, json.Unmarshal([]byte(conf), &config))
+
+	errs := config.Validate()
+	LocateValidationErrors([]byte(conf), errs)
+
+	paths := map[string]ValidationError{}
+	for _, e := range errs {
+		paths[e.Path] = e
+	}
+	assert.Contains(t, paths, "publicKey")
+	assert.Contains(t, paths, "arcSession")
+	assert.Contains(t, paths, "postUp[0]")
+	assert.True(t, paths["postDown[0]"].Warning)
+	if assert.Contains(t, paths, "preflight.renewSession") {
+		assert.True(t, paths["preflight.renewSession"].Warning)
+	}
+	assert.Contains(t, paths, "probes.targets[0].type")
+	assert.Contains(t, paths, "probes.targets[1].address")
+	assert.Contains(t, paths, "healthListen")
+	assert.Contains(t, paths, "usePersistentTun")
+	assert.Equal(t, `unknown user "soratun-no-such-user"`, paths["user"].Message)
+	assert.Contains(t, paths, "keyRotationInterval")
+	assert.True(t, paths["hookGroup"].Warning)
+	if assert.Contains(t, paths, "mtu") {
+		assert.Equal(t, 4, paths["mtu"].Line)
+		assert.True(t, paths["mtu"].Warning)
+	}
+}
+
+func TestConfig_Validate_rootUser(t *testing.T) {
+	config := Config{
+		KeyRotationInterval: 3600,
+		Preflight:           &PreflightOptions{Timeout: 5, RenewSession: true},
+		Profile:             &Profile{Email: "root@example.com", Password: "password"},
+	}
+
+	paths := map[string]ValidationError{}
+	for _, e := range config.Validate() {
+		paths[e.Path] = e
+	}
+	for _, path := range []string{"keyRotationInterval", "preflight.renewSession"} {
+		if assert.Contains(t, paths, path) {
+			assert.True(t, paths[path].Warning)
+			assert.Contains(t, paths[path].Message, "MFA")
+		}
+	}
+
+	// SAM user and API token can be used
+	config.Profile = &Profile{AuthKeyID: "keyId-xxx", AuthKey: "secret-xxx"}
+	for _, e := range config.Validate() {
+		assert.NotContains(t, e.Message, "MFA")
+	}
+}
@@ -0,0 +1,99 @@
+package soratun
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// DefaultSubscription is the subscription for a new virtual SIM.
+const DefaultSubscription = "planArc01"
+
+// VirtualSimOptions holds settings which will be applied while creating a new virtual SIM. Name and values of Tags are
+// text/template, and can use following functions:
+//
+//	{{hostname}}       host name of this device
+//	{{machineId}}      machine ID of this device, from /etc/machine-id or /var/lib/dbus/machine-id
+//	{{env "NAME"}}     value of the environment variable
+type VirtualSimOptions struct {
+	// Name is name of the virtual SIM.
+	Name string `json:"name,omitempty"`
+	// Tags holds tags of the virtual SIM.
+	Tags map[string]string `json:"tags,omitempty"`
+	// GroupId is ID of the group which the virtual SIM will belong to.
+	GroupId string `json:"groupId,omitempty"`
+	// Subscription is subscription of the virtual SIM, DefaultSubscription if empty.
+	Subscription string `json:"subscription,omitempty"`
+}
+
+var machineIdPaths = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+var virtualSimTemplateFuncs = template.FuncMap{
+	"hostname": os.Hostname,
+	"machineId": func() (string, error) {
+		for _, path := range machineIdPaths {
+			b, err := os.ReadFile(path)
+			if err == nil && len(bytes.TrimSpace(b)) > 0 {
+				return string(bytes.TrimSpace(b)), nil
+			}
+		}
+		return "", errors.New("machine ID is not available on this device")
+	},
+	"env": os.Getenv,
+}
+
+// Expand returns a copy of VirtualSimOptions whose Name and values of Tags are expanded, and Subscription is filled
+// with DefaultSubscription if empty.
+func (o VirtualSimOptions) Expand() (VirtualSimOptions, error) {
+	expanded := VirtualSimOptions{
+		GroupId:      o.GroupId,
+		Subscription: o.Subscription,
+	}
+
+	if expanded.Subscription == "" {
+		expanded.Subscription = DefaultSubscription
+	}
+
+	name, err := expandVirtualSimTemplate(o.Name)
+	if err != nil {
+		return VirtualSimOptions{}, fmt.Errorf("invalid virtual SIM name %q: %w", o.Name, err)
+	}
+	expanded.Name = name
+
+	if len(o.Tags) > 0 {
+		expanded.Tags = make(map[string]string, len(o.Tags))
+		for k, v := range o.Tags {
+			value, err := expandVirtualSimTemplate(v)
+			if err != nil {
+				return VirtualSimOptions{}, fmt.Errorf("invalid value for virtual SIM tag %q: %w", k, err)
+			}
+			expanded.Tags[k] = value
+		}
+	}
+
+	return expanded, nil
+}
+
+func (o VirtualSimOptions) isZero() bool {
+	return o.Name == "" && len(o.Tags) == 0 && o.GroupId == "" && o.Subscription == ""
+}
+
+func expandVirtualSimTemplate(text string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	t, err := template.New("").Funcs(virtualSimTemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	if err := t.Execute(&b, nil); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,36 @@
+package soratun
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVirtualSimOptions_Expand(t *testing.T) {
+	t.Setenv("SORATUN_TEST_LOCATION", "tokyo")
+	hostname, err := os.Hostname()
+	assert.NoError(t, err)
+
+	expanded, err := VirtualSimOptions{
+		Name: "arc-{{hostname}}",
+		Tags: map[string]string{
+			"location": `{{env "SORATUN_TEST_LOCATION"}}`,
+			"role":     "gateway",
+		},
+		GroupId: "group-id",
+	}.Expand()
+	assert.NoError(t, err)
+	assert.Equal(t, VirtualSimOptions{
+		Name: "arc-" + hostname,
+		Tags: map[string]string{
+			"location": "tokyo",
+			"role":     "gateway",
+		},
+		GroupId:      "group-id",
+		Subscription: DefaultSubscription,
+	}, expanded)
+
+	_, err = VirtualSimOptions{Name: "{{unknown}}"}.Expand()
+	assert.Error(t, err)
+}
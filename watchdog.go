@@ -0,0 +1,118 @@
+//go:build !windows
+
+package soratun
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-systemd/daemon"
+)
+
+// DefaultWatchdogStartupGrace is the default period in seconds after the start, during which the tunnel is considered
+// alive without any handshake. The first handshake may take a while on slow or lossy networks.
+const DefaultWatchdogStartupGrace = 180
+
+// TunnelSnapshot is the observed state of a tunnel, which HealthPolicy decides on.
+type TunnelSnapshot struct {
+	Now       time.Time
+	StartedAt time.Time
+	// DeviceErr is an error while getting the device, e.g. the interface has been removed.
+	DeviceErr error
+	// LatestHandshake is zero if there has been no handshake yet.
+	LatestHandshake time.Time
+	// Probes are results of connectivity probes, or nil if probes are not configured.
+	Probes []ProbeResult
+}
+
+// HealthPolicy decides whether the tunnel is alive, i.e. soratun should keep updating the systemd watchdog timer. If
+// not, systemd restarts soratun once the timer expires. The reason is published as the status of the service.
+type HealthPolicy interface {
+	Check(s *TunnelSnapshot) (alive bool, reason string)
+}
+
+// HealthPolicyFunc is an adapter to use a function as HealthPolicy.
+type HealthPolicyFunc func(s *TunnelSnapshot) (alive bool, reason string)
+
+// Check calls f(s).
+func (f HealthPolicyFunc) Check(s *TunnelSnapshot) (bool, string) {
+	return f(s)
+}
+
+// DefaultHealthPolicy considers the tunnel alive while the Arc session has not expired, with grace for the first
+// handshake, and unless any connectivity probe is down.
+type DefaultHealthPolicy struct {
+	// StartupGrace is the period after the start during which no handshake is tolerated.
+	StartupGrace time.Duration
+	// IgnoreProbes ignores results of connectivity probes.
+	IgnoreProbes bool
+}
+
+// NewDefaultHealthPolicy returns DefaultHealthPolicy configured with config.Watchdog.
+func NewDefaultHealthPolicy(config *Config) *DefaultHealthPolicy {
+	p := &DefaultHealthPolicy{StartupGrace: DefaultWatchdogStartupGrace * time.Second}
+	if config.Watchdog != nil {
+		if config.Watchdog.StartupGrace > 0 {
+			p.StartupGrace = time.Duration(config.Watchdog.StartupGrace) * time.Second
+		}
+		p.IgnoreProbes = config.Watchdog.IgnoreProbes
+	}
+	return p
+}
+
+// Check implements HealthPolicy.
+func (p *DefaultHealthPolicy) Check(s *TunnelSnapshot) (bool, string) {
+	if s.DeviceErr != nil {
+		return false, fmt.Sprintf("failed to get the device: %v", s.DeviceErr)
+	}
+
+	if s.LatestHandshake.IsZero() {
+		uptime := s.Now.Sub(s.StartedAt).Truncate(time.Second)
+		if uptime < p.StartupGrace {
+			return true, fmt.Sprintf("waiting for the first handshake, %s since start", uptime)
+		}
+		return false, fmt.Sprintf("no handshake in %s since start", uptime)
+	}
+
+	age := s.Now.Sub(s.LatestHandshake).Truncate(time.Second)
+	if PeerHealth(s.LatestHandshake, s.Now) == HealthDown {
+		return false, fmt.Sprintf("Arc session expired, latest handshake %s ago", age)
+	}
+
+	var degraded []string
+	if !p.IgnoreProbes {
+		for _, r := range s.Probes {
+			switch r.Health {
+			case HealthDown:
+				return false, fmt.Sprintf("probe %s is down: %s", r.Target, r.LastError)
+			case HealthDegraded:
+				degraded = append(degraded, fmt.Sprintf("probe %s lost %.0f%%", r.Target, r.Loss*100))
+			}
+		}
+	}
+
+	reason := fmt.Sprintf("latest handshake %s ago", age)
+	if len(degraded) > 0 {
+		reason += ", " + strings.Join(degraded, ", ")
+	}
+	return true, reason
+}
+
+// watchdogInterval returns the interval to update the systemd watchdog timer, which is half of WatchdogSec as
+// sd_watchdog_enabled(3) recommends, or 0 if the watchdog is disabled.
+func watchdogInterval() time.Duration {
+	d, _ := daemon.SdWatchdogEnabled(false)
+	return d / 2
+}
+
+// watchdogNotification returns the sd_notify message for the decision of HealthPolicy. The timer is updated only if
+// the tunnel is alive, while the reason is always published as STATUS.
+func watchdogNotification(alive bool, reason string) string {
+	// STATUS is a single line
+	status := strings.ReplaceAll(reason, "\n", " ")
+	if alive {
+		return daemon.SdNotifyWatchdog + "\nSTATUS=" + status
+	}
+	return "STATUS=unhealthy, " + status
+}
@@ -0,0 +1,99 @@
+//go:build !windows
+
+package soratun
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultHealthPolicy(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := NewDefaultHealthPolicy(&Config{})
+	assert.Equal(t, DefaultWatchdogStartupGrace*time.Second, p.StartupGrace)
+
+	tests := []struct {
+		name     string
+		snapshot TunnelSnapshot
+		alive    bool
+		reason   string
+	}{
+		{
+			name:     "device is gone",
+			snapshot: TunnelSnapshot{Now: now, StartedAt: now.Add(-time.Hour), DeviceErr: errors.New("file does not exist")},
+			reason:   "failed to get the device: file does not exist",
+		},
+		{
+			name:     "slow first handshake",
+			snapshot: TunnelSnapshot{Now: now, StartedAt: now.Add(-150 * time.Second)},
+			alive:    true,
+			reason:   "waiting for the first handshake, 2m30s since start",
+		},
+		{
+			name:     "no handshake after grace",
+			snapshot: TunnelSnapshot{Now: now, StartedAt: now.Add(-5 * time.Minute)},
+			reason:   "no handshake in 5m0s since start",
+		},
+		{
+			name:     "healthy",
+			snapshot: TunnelSnapshot{Now: now, StartedAt: now.Add(-time.Hour), LatestHandshake: now.Add(-30 * time.Second)},
+			alive:    true,
+			reason:   "latest handshake 30s ago",
+		},
+		{
+			name:     "stale but not expired",
+			snapshot: TunnelSnapshot{Now: now, StartedAt: now.Add(-time.Hour), LatestHandshake: now.Add(-150 * time.Second)},
+			alive:    true,
+			reason:   "latest handshake 2m30s ago",
+		},
+		{
+			name:     "expired",
+			snapshot: TunnelSnapshot{Now: now, StartedAt: now.Add(-time.Hour), LatestHandshake: now.Add(-4 * time.Minute)},
+			reason:   "Arc session expired, latest handshake 4m0s ago",
+		},
+		{
+			name: "probe is degraded",
+			snapshot: TunnelSnapshot{Now: now, StartedAt: now.Add(-time.Hour), LatestHandshake: now.Add(-30 * time.Second),
+				Probes: []ProbeResult{{Target: "gateway", Loss: 0.1, Health: HealthDegraded}}},
+			alive:  true,
+			reason: "latest handshake 30s ago, probe gateway lost 10%",
+		},
+		{
+			name: "probe is down",
+			snapshot: TunnelSnapshot{Now: now, StartedAt: now.Add(-time.Hour), LatestHandshake: now.Add(-30 * time.Second),
+				Probes: []ProbeResult{{Target: "gateway", LastError: "i/o timeout", Health: HealthDown}}},
+			reason: "probe gateway is down: i/o timeout",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alive, reason := p.Check(&tt.snapshot)
+			assert.Equal(t, tt.alive, alive)
+			assert.Equal(t, tt.reason, reason)
+		})
+	}
+
+	p = NewDefaultHealthPolicy(&Config{Watchdog: &WatchdogOptions{StartupGrace: 600, IgnoreProbes: true}})
+	alive, _ := p.Check(&TunnelSnapshot{Now: now, StartedAt: now.Add(-5 * time.Minute)})
+	assert.True(t, alive)
+	alive, _ = p.Check(&tests[len(tests)-1].snapshot)
+	assert.True(t, alive)
+}
+
+func TestHealthPolicyFunc(t *testing.T) {
+	var p HealthPolicy = HealthPolicyFunc(func(s *TunnelSnapshot) (bool, string) {
+		return s.DeviceErr == nil, "custom"
+	})
+	alive, reason := p.Check(&TunnelSnapshot{})
+	assert.True(t, alive)
+	assert.Equal(t, "custom", reason)
+}
+
+func TestWatchdogNotification(t *testing.T) {
+	assert.Equal(t, "WATCHDOG=1\nSTATUS=latest handshake 30s ago", watchdogNotification(true, "latest handshake 30s ago"))
+	assert.Equal(t, "STATUS=unhealthy, no handshake in 5m0s since start", watchdogNotification(false, "no handshake in 5m0s since start"))
+	assert.Equal(t, "STATUS=unhealthy, a b", watchdogNotification(false, "a\nb"))
+}
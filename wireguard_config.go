@@ -0,0 +1,190 @@
+package soratun
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ignoredWireGuardConfigKeys are wg-quick keys which soratun does not support, but are safe to ignore.
+var ignoredWireGuardConfigKeys = map[string]bool{
+	"interface.dns":        true,
+	"interface.listenport": true,
+	"interface.table":      true,
+	"interface.saveconfig": true,
+	"interface.fwmark":     true,
+	"interface.preup":      true,
+	"interface.predown":    true,
+}
+
+// ParseWireGuardConfig parses WireGuard configuration in wg-quick format, which has one [Interface] and one [Peer]
+// section, into a Config with ArcSession. PostUp and PostDown commands are run by "/bin/sh -c" if they contain shell
+// syntax. Keys which soratun does not support are ignored and returned as warnings.
+func ParseWireGuardConfig(b []byte) (*Config, []ValidationError, error) {
+	config := &Config{ArcSession: &ArcSession{}}
+	var warnings []ValidationError
+
+	section := ""
+	sectionLines := map[string]int{}
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for lineNumber := 1; s.Scan(); lineNumber++ {
+		line := s.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			if section != "interface" && section != "peer" {
+				return nil, nil, fmt.Errorf("line %d: unknown section %s", lineNumber, line)
+			}
+			if first, ok := sectionLines[section]; ok {
+				if section == "peer" {
+					return nil, nil, fmt.Errorf("line %d: multiple [Peer] sections are found (the first one is at line %d), but soratun supports only one peer, SORACOM Arc server", lineNumber, first)
+				}
+				return nil, nil, fmt.Errorf("line %d: multiple [Interface] sections are found (the first one is at line %d)", lineNumber, first)
+			}
+			sectionLines[section] = lineNumber
+			continue
+		}
+
+		if section == "" {
+			return nil, nil, fmt.Errorf("line %d: key is found outside of [Interface] or [Peer] section", lineNumber)
+		}
+
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, nil, fmt.Errorf("line %d: invalid line %q, should be in the form of \"Key = Value\"", lineNumber, line)
+		}
+		key := strings.TrimSpace(line[:i])
+		value := strings.TrimSpace(line[i+1:])
+
+		path := section + "." + strings.ToLower(key)
+		if ignoredWireGuardConfigKeys[path] {
+			warnings = append(warnings, ValidationError{Path: key, Line: lineNumber, Column: 1, Message: "not supported by soratun, ignored", Warning: true})
+			continue
+		}
+
+		if err := config.setWireGuardConfigValue(path, value); err != nil {
+			return nil, nil, fmt.Errorf("line %d: %s: %w", lineNumber, key, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if _, ok := sectionLines["interface"]; !ok {
+		return nil, nil, fmt.Errorf("[Interface] section is missing")
+	}
+	if _, ok := sectionLines["peer"]; !ok {
+		return nil, nil, fmt.Errorf("[Peer] section is missing")
+	}
+	if config.PrivateKey == (Key{}) {
+		return nil, nil, fmt.Errorf("PrivateKey is missing in [Interface] section")
+	}
+	if config.ArcSession.ArcClientPeerIpAddress == nil {
+		return nil, nil, fmt.Errorf("Address is missing in [Interface] section")
+	}
+	if config.ArcSession.ArcServerPeerPublicKey == (Key{}) {
+		return nil, nil, fmt.Errorf("PublicKey is missing in [Peer] section")
+	}
+	if config.ArcSession.ArcServerEndpoint == nil {
+		return nil, nil, fmt.Errorf("Endpoint is missing in [Peer] section")
+	}
+
+	config.PublicKey = Key(config.PrivateKey.AsWgKey().PublicKey())
+	return config, warnings, nil
+}
+
+func (c *Config) setWireGuardConfigValue(path, value string) error {
+	switch path {
+	case "interface.privatekey":
+		key, err := NewKey(value)
+		if err != nil {
+			return err
+		}
+		c.PrivateKey = key
+	case "interface.address":
+		if c.ArcSession.ArcClientPeerIpAddress != nil {
+			return fmt.Errorf("multiple addresses are not supported")
+		}
+		addresses := strings.Split(value, ",")
+		if len(addresses) > 1 {
+			return fmt.Errorf("multiple addresses are not supported")
+		}
+		s := strings.TrimSpace(addresses[0])
+		ip := net.ParseIP(s)
+		if ip == nil {
+			var err error
+			if ip, _, err = net.ParseCIDR(s); err != nil {
+				return err
+			}
+		}
+		c.ArcSession.ArcClientPeerIpAddress = ip
+	case "interface.mtu":
+		mtu, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		c.Mtu = mtu
+	case "interface.postup":
+		c.PostUp = append(c.PostUp, hookCommand(value))
+	case "interface.postdown":
+		c.PostDown = append(c.PostDown, hookCommand(value))
+	case "peer.publickey":
+		key, err := NewKey(value)
+		if err != nil {
+			return err
+		}
+		c.ArcSession.ArcServerPeerPublicKey = key
+	case "peer.allowedips":
+		for _, s := range strings.Split(value, ",") {
+			var ipnet IPNet
+			if err := ipnet.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+				return err
+			}
+			c.ArcSession.ArcAllowedIPs = append(c.ArcSession.ArcAllowedIPs, &ipnet)
+		}
+	case "peer.endpoint":
+		var endpoint UDPAddr
+		if err := endpoint.UnmarshalText([]byte(value)); err != nil {
+			return err
+		}
+		c.ArcSession.ArcServerEndpoint = &endpoint
+	case "peer.persistentkeepalive":
+		// 0 in Config means the default interval, while 0 in wg-quick disables it
+		if value == "off" || value == "0" {
+			c.PersistentKeepalive = PersistentKeepaliveOff
+			return nil
+		}
+		interval, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if interval < 0 {
+			return fmt.Errorf("should be off or a positive number, but got %d", interval)
+		}
+		c.PersistentKeepalive = interval
+	case "peer.presharedkey":
+		return fmt.Errorf("preshared key is not supported by SORACOM Arc")
+	default:
+		return fmt.Errorf("unknown key")
+	}
+	return nil
+}
+
+// hookCommand converts a wg-quick hook, which is run by bash, into a command for PostUp and PostDown. A simple command
+// is split into arguments, otherwise it is run by "/bin/sh -c".
+func hookCommand(s string) []string {
+	if strings.ContainsAny(s, "\"'`$\\|&;<>(){}*?[]~!") {
+		return []string{"/bin/sh", "-c", s}
+	}
+	return strings.Fields(s)
+}
@@ -0,0 +1,75 @@
+package soratun
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const wireGuardConfig = `[Interface]
+PrivateKey = 8K4cUrwYpyE3jYeKyFvX3r3Ty+rOSYRKBr7QdGCBY1w=
+Address = 10.123.45.67/32
+MTU = 1420
+DNS = 1.1.1.1
+PostUp = /bin/echo up %i
+PostDown = ip route del 192.0.2.0/24 dev %i || true
+
+[Peer]
+# SORACOM Arc server
+PublicKey = 5dTfnbPQrKRJhHBhazqHIzVKxA6Ga89rWWvdXnr0OCA=
+AllowedIPs = 100.127.0.0/16, 192.0.2.0/24
+Endpoint = 192.0.2.1:11010
+PersistentKeepalive = 60
+`
+
+func TestParseWireGuardConfig(t *testing.T) {
+	config, warnings, err := ParseWireGuardConfig([]byte(wireGuardConfig))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "8K4cUrwYpyE3jYeKyFvX3r3Ty+rOSYRKBr7QdGCBY1w=", config.PrivateKey.String())
+	assert.Equal(t, "hiTL1IsjrklEDfWjMP1Uw7/62YZ1TVxzk+mR1knQKAQ=", config.PublicKey.String())
+	assert.Equal(t, 1420, config.Mtu)
+	assert.Equal(t, 60, config.PersistentKeepalive)
+	assert.Equal(t, [][]string{{"/bin/echo", "up", "%i"}}, config.PostUp)
+	assert.Equal(t, [][]string{{"/bin/sh", "-c", "ip route del 192.0.2.0/24 dev %i || true"}}, config.PostDown)
+
+	assert.Equal(t, "5dTfnbPQrKRJhHBhazqHIzVKxA6Ga89rWWvdXnr0OCA=", config.ArcSession.ArcServerPeerPublicKey.String())
+	assert.True(t, net.IPv4(10, 123, 45, 67).Equal(config.ArcSession.ArcClientPeerIpAddress))
+	assert.True(t, net.IPv4(192, 0, 2, 1).Equal(config.ArcSession.ArcServerEndpoint.IP))
+	assert.Equal(t, 11010, config.ArcSession.ArcServerEndpoint.Port)
+	if assert.Len(t, config.ArcSession.ArcAllowedIPs, 2) {
+		assert.Equal(t, "192.0.2.0/24", (*net.IPNet)(config.ArcSession.ArcAllowedIPs[1]).String())
+	}
+
+	assert.Equal(t, []ValidationError{{Path: "DNS", Line: 5, Column: 1, Message: "not supported by soratun, ignored", Warning: true}}, warnings)
+}
+
+func TestParseWireGuardConfig_MultiplePeers(t *testing.T) {
+	conf := wireGuardConfig + `
+[Peer]
+PublicKey = 8K4cUrwYpyE3jYeKyFvX3r3Ty+rOSYRKBr7QdGCBY1w=
+AllowedIPs = 10.0.0.0/8
+`
+	_, _, err := ParseWireGuardConfig([]byte(conf))
+	assert.EqualError(t, err, "line 16: multiple [Peer] sections are found (the first one is at line 9), but soratun supports only one peer, SORACOM Arc server")
+}
+
+func TestParseWireGuardConfig_PersistentKeepalive(t *testing.T) {
+	for value, want := range map[string]int{"25": 25, "off": PersistentKeepaliveOff, "0": PersistentKeepaliveOff} {
+		conf := strings.Replace(wireGuardConfig, "PersistentKeepalive = 60", "PersistentKeepalive = "+value, 1)
+		config, _, err := ParseWireGuardConfig([]byte(conf))
+		if assert.NoError(t, err, value) {
+			assert.Equal(t, want, config.PersistentKeepalive, value)
+		}
+	}
+
+	// not specified
+	config, _, err := ParseWireGuardConfig([]byte(strings.Replace(wireGuardConfig, "PersistentKeepalive = 60\n", "", 1)))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, config.PersistentKeepalive)
+
+	_, _, err = ParseWireGuardConfig([]byte(strings.Replace(wireGuardConfig, "PersistentKeepalive = 60", "PersistentKeepalive = -1", 1)))
+	assert.Error(t, err)
+}